@@ -0,0 +1,217 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// AggregateCommand is an expression command that aggregates its input series into one
+// series per group, point by point: the value at a timestamp is the aggregation of the
+// values of the series of the group at that timestamp. Numbers are aggregated into one
+// number per group. Null and NaN values are skipped.
+type AggregateCommand struct {
+	VarToAggregate string
+	// Operation is one of sum, avg, min, max or count.
+	Operation string
+	// By is the list of labels the input is grouped by. The result of each group only
+	// has these labels. When empty, the whole input is aggregated into a single value.
+	By    []string
+	refID string
+}
+
+var supportedAggregateOperations = []string{"sum", "avg", "min", "max", "count"}
+
+// NewAggregateCommand creates a new AggregateCommand.
+func NewAggregateCommand(refID, varToAggregate, operation string, by []string) (*AggregateCommand, error) {
+	if !isSupported(operation, supportedAggregateOperations) {
+		return nil, fmt.Errorf("aggregate operation %q is not supported. Supported: %v", operation, supportedAggregateOperations)
+	}
+	return &AggregateCommand{
+		VarToAggregate: varToAggregate,
+		Operation:      operation,
+		By:             by,
+		refID:          refID,
+	}, nil
+}
+
+// UnmarshalAggregateCommand creates an AggregateCommand from Grafana's frontend query.
+func UnmarshalAggregateCommand(rn *rawNode) (*AggregateCommand, error) {
+	refID, err := rn.outputRefID(TypeAggregate)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToAggregate, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToAggregate = strings.TrimPrefix(varToAggregate, "$")
+
+	rawOperation, ok := rn.Query["operation"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "operation"}
+	}
+	operation, ok := rawOperation.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "operation", "a string", rawOperation)
+	}
+
+	var by []string
+	if rawBy, ok := rn.Query["by"]; ok {
+		list, ok := rawBy.([]interface{})
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "by", "an array of strings", rawBy)
+		}
+		for _, l := range list {
+			label, ok := l.(string)
+			if !ok {
+				return nil, newErrInvalidInputType(rn.RefID, "by", "an array of strings", l)
+			}
+			by = append(by, label)
+		}
+	}
+
+	return NewAggregateCommand(refID, varToAggregate, operation, by)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (ac *AggregateCommand) NeedsVars() []string {
+	return []string{ac.VarToAggregate}
+}
+
+// RefID returns the refID that names the results of the command.
+func (ac *AggregateCommand) RefID() string {
+	return ac.refID
+}
+
+// aggregateGroup holds the values of the input that have the same group labels.
+type aggregateGroup struct {
+	labels data.Labels
+	// points holds the values of the group per timestamp, and numbers the values of its numbers.
+	points  map[time.Time][]float64
+	numbers []float64
+	series  bool
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. Groups are returned in the order they first appear in the input.
+func (ac *AggregateCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	var groups []*aggregateGroup
+	byKey := make(map[string]*aggregateGroup)
+	group := func(labels data.Labels) *aggregateGroup {
+		groupLabels := data.Labels{}
+		for _, name := range ac.By {
+			if v, ok := labels[name]; ok {
+				groupLabels[name] = v
+			}
+		}
+		key := groupLabels.String()
+		g, ok := byKey[key]
+		if !ok {
+			g = &aggregateGroup{labels: groupLabels, points: make(map[time.Time][]float64)}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		return g
+	}
+
+	for _, val := range vars[ac.VarToAggregate].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			g := group(v.GetLabels())
+			g.series = true
+			for i := 0; i < v.Len(); i++ {
+				t, f := v.GetPoint(i)
+				t = t.UTC()
+				if _, ok := g.points[t]; !ok {
+					g.points[t] = nil
+				}
+				if f != nil && !math.IsNaN(*f) {
+					g.points[t] = append(g.points[t], *f)
+				}
+			}
+		case mathexp.Number:
+			g := group(v.GetLabels())
+			if f := v.GetFloat64Value(); f != nil && !math.IsNaN(*f) {
+				g.numbers = append(g.numbers, *f)
+			}
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: ac.refID, Input: ac.VarToAggregate, Command: TypeAggregate, Expected: parse.TypeVariantSet, Actual: val.Type()}
+		}
+	}
+
+	for _, g := range groups {
+		if g.series && len(g.numbers) > 0 {
+			return newRes, fmt.Errorf("aggregate expression '%s' cannot aggregate series and numbers together", ac.refID)
+		}
+		if !g.series {
+			n := mathexp.NewNumber(ac.refID, g.labels)
+			n.SetValue(ac.aggregate(g.numbers))
+			newRes.Values = append(newRes.Values, n)
+			continue
+		}
+		times := make([]time.Time, 0, len(g.points))
+		for t := range g.points {
+			times = append(times, t)
+		}
+		sort.Slice(times, func(i, j int) bool {
+			return times[i].Before(times[j])
+		})
+		s := mathexp.NewSeries(ac.refID, g.labels, len(times))
+		for i, t := range times {
+			s.SetPoint(i, t, ac.aggregate(g.points[t]))
+		}
+		newRes.Values = append(newRes.Values, s)
+	}
+	return newRes, nil
+}
+
+// aggregate returns the aggregation of values by the operation. It is null when there
+// are no values, except for count which is 0.
+func (ac *AggregateCommand) aggregate(values []float64) *float64 {
+	if ac.Operation == "count" {
+		f := float64(len(values))
+		return &f
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	f := values[0]
+	switch ac.Operation {
+	case "sum", "avg":
+		for _, v := range values[1:] {
+			f += v
+		}
+		if ac.Operation == "avg" {
+			f /= float64(len(values))
+		}
+	case "min":
+		for _, v := range values[1:] {
+			f = math.Min(f, v)
+		}
+	case "max":
+		for _, v := range values[1:] {
+			f = math.Max(f, v)
+		}
+	}
+	return &f
+}
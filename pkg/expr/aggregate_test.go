@@ -0,0 +1,104 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestAggregateCommand(t *testing.T) {
+	series := func(labels data.Labels, values ...*float64) mathexp.Series {
+		s := mathexp.NewSeries("A", labels, len(values))
+		for i, v := range values {
+			s.SetPoint(i, time.Unix(int64(i*60), 0), v)
+		}
+		return s
+	}
+	type point struct {
+		sec   int64
+		value *float64
+	}
+	points := func(s mathexp.Series) []point {
+		res := make([]point, 0, s.Len())
+		for i := 0; i < s.Len(); i++ {
+			pt, f := s.GetPoint(i)
+			res = append(res, point{pt.Unix(), f})
+		}
+		return res
+	}
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{
+		series(data.Labels{"dc": "eu", "host": "a"}, ptr.Float64(1), ptr.Float64(2), ptr.Float64(3)),
+		series(data.Labels{"dc": "us", "host": "b"}, ptr.Float64(10), nil, ptr.Float64(30)),
+		series(data.Labels{"dc": "eu", "host": "c"}, ptr.Float64(5), ptr.Float64(6)),
+	}}}
+
+	t.Run("ungrouped sum", func(t *testing.T) {
+		cmd, err := UnmarshalAggregateCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "operation": "sum"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+		res, err := cmd.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		s, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Empty(t, s.GetLabels())
+		require.Equal(t, []point{{0, ptr.Float64(16)}, {60, ptr.Float64(8)}, {120, ptr.Float64(33)}}, points(s))
+	})
+
+	t.Run("avg grouped by label", func(t *testing.T) {
+		cmd, err := UnmarshalAggregateCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "operation": "avg", "by": []interface{}{"dc"}},
+		})
+		require.NoError(t, err)
+
+		res, err := cmd.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 2)
+
+		eu, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"dc": "eu"}, eu.GetLabels())
+		require.Equal(t, []point{{0, ptr.Float64(3)}, {60, ptr.Float64(4)}, {120, ptr.Float64(3)}}, points(eu))
+
+		us, ok := res.Values[1].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"dc": "us"}, us.GetLabels())
+		require.Equal(t, []point{{0, ptr.Float64(10)}, {60, nil}, {120, ptr.Float64(30)}}, points(us))
+	})
+
+	t.Run("count of numbers", func(t *testing.T) {
+		cmd, err := NewAggregateCommand("B", "A", "count", nil)
+		require.NoError(t, err)
+
+		number := func(f *float64) mathexp.Number {
+			n := mathexp.NewNumber("A", nil)
+			n.SetValue(f)
+			return n
+		}
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{number(ptr.Float64(1)), number(nil), number(ptr.Float64(2))}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, ptr.Float64(2), res.Values[0].(mathexp.Number).GetFloat64Value())
+	})
+
+	t.Run("should fail on an unknown operation", func(t *testing.T) {
+		_, err := UnmarshalAggregateCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "operation": "median"},
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,152 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// BroadcastCommand is an expression command that turns a number into a series
+// shaped like a reference series: the number's value is repeated at each
+// timestamp of the reference, and the result carries the reference's labels.
+type BroadcastCommand struct {
+	ValueVar string
+	ShapeVar string
+	refID    string
+}
+
+// NewBroadcastCommand creates a new BroadcastCommand.
+func NewBroadcastCommand(refID, valueVar, shapeVar string) *BroadcastCommand {
+	return &BroadcastCommand{
+		ValueVar: valueVar,
+		ShapeVar: shapeVar,
+		refID:    refID,
+	}
+}
+
+// UnmarshalBroadcastCommand creates a BroadcastCommand from Grafana's frontend query.
+func UnmarshalBroadcastCommand(rn *rawNode) (*BroadcastCommand, error) {
+	refID, err := rn.outputRefID(TypeBroadcast)
+	if err != nil {
+		return nil, err
+	}
+	valueVar, err := unmarshalBroadcastVar(rn, "valueExpression")
+	if err != nil {
+		return nil, err
+	}
+	shapeVar, err := unmarshalBroadcastVar(rn, "shapeExpression")
+	if err != nil {
+		return nil, err
+	}
+	return NewBroadcastCommand(refID, valueVar, shapeVar), nil
+}
+
+func unmarshalBroadcastVar(rn *rawNode, key string) (string, error) {
+	rawVar, ok := rn.Query[key]
+	if !ok {
+		return "", fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: key})
+	}
+	v, ok := rawVar.(string)
+	if !ok {
+		return "", newErrInvalidInputType(rn.RefID, key, "a string", rawVar)
+	}
+	v = strings.TrimPrefix(v, "$")
+	if v == "" {
+		return "", fmt.Errorf("%w: it must not be empty", ErrMissingField{RefID: rn.RefID, Field: key})
+	}
+	return v, nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (bc *BroadcastCommand) NeedsVars() []string {
+	return []string{bc.ValueVar, bc.ShapeVar}
+}
+
+// RefID returns the refID that names the results of the command.
+func (bc *BroadcastCommand) RefID() string {
+	return bc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. Each reference series is paired with the number that has
+// the same labels or, if the value expression returns a single number, with that
+// number. Reference series without a matching number are dropped.
+func (bc *BroadcastCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+
+	var numbers []mathexp.Value
+	for _, val := range vars[bc.ValueVar].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Number, mathexp.Scalar:
+			numbers = append(numbers, v)
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: bc.refID, Input: bc.ValueVar, Command: TypeBroadcast, Expected: parse.TypeNumberSet, Actual: val.Type()}
+		}
+	}
+
+	for _, val := range vars[bc.ShapeVar].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			num := broadcastValueFor(v, numbers)
+			if num == nil {
+				continue
+			}
+			newRes.Values = append(newRes.Values, broadcast(bc.refID, num, v))
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: bc.refID, Input: bc.ShapeVar, Command: TypeBroadcast, Expected: parse.TypeSeriesSet, Actual: val.Type()}
+		}
+	}
+
+	return newRes, nil
+}
+
+// broadcastValueFor returns the value of numbers to broadcast to the shape of s, or nil if there is none.
+func broadcastValueFor(s mathexp.Series, numbers []mathexp.Value) mathexp.Value {
+	if len(numbers) == 1 {
+		return numbers[0]
+	}
+	for _, num := range numbers {
+		if num.GetLabels().Equals(s.GetLabels()) {
+			return num
+		}
+	}
+	return nil
+}
+
+// broadcast returns a series named name with the value of num at each timestamp of shape.
+func broadcast(name string, num mathexp.Value, shape mathexp.Series) mathexp.Series {
+	var f *float64
+	switch v := num.(type) {
+	case mathexp.Number:
+		f = v.GetFloat64Value()
+	case mathexp.Scalar:
+		f = v.GetFloat64Value()
+	}
+
+	res := mathexp.NewSeries(name, shape.GetLabels().Copy(), shape.Len())
+	for i := 0; i < shape.Len(); i++ {
+		t, _ := shape.GetPoint(i)
+		var p *float64
+		if f != nil {
+			v := *f
+			p = &v
+		}
+		res.SetPoint(i, t, p)
+	}
+	return res
+}
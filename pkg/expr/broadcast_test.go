@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestBroadcastCommand(t *testing.T) {
+	reference := mathexp.NewSeries("A", data.Labels{"host": "a"}, 10)
+	for i := 0; i < 10; i++ {
+		reference.SetPoint(i, time.Unix(int64(i*10), 0), ptr.Float64(float64(i)))
+	}
+
+	number := func(labels data.Labels, f float64) mathexp.Number {
+		n := mathexp.NewNumber("B", labels)
+		n.SetValue(&f)
+		return n
+	}
+
+	unmarshal := func(t *testing.T) *BroadcastCommand {
+		t.Helper()
+		cmd, err := UnmarshalBroadcastCommand(&rawNode{
+			RefID: "C",
+			Query: map[string]interface{}{
+				"valueExpression": "$B",
+				"shapeExpression": "A",
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"B", "A"}, cmd.NeedsVars())
+		return cmd
+	}
+
+	requireBroadcast := func(t *testing.T, res mathexp.Results, check func(f *float64)) {
+		t.Helper()
+		require.Len(t, res.Values, 1)
+		s, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, "C", s.GetName())
+		require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+		require.Equal(t, reference.Len(), s.Len())
+		for i := 0; i < s.Len(); i++ {
+			refTime, _ := reference.GetPoint(i)
+			tm, f := s.GetPoint(i)
+			require.Equal(t, refTime, tm)
+			check(f)
+		}
+	}
+
+	t.Run("should fill the reference series with the number", func(t *testing.T) {
+		cmd := unmarshal(t)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{reference}},
+			"B": mathexp.Results{Values: mathexp.Values{number(nil, 42)}},
+		})
+		require.NoError(t, err)
+		requireBroadcast(t, res, func(f *float64) {
+			require.NotNil(t, f)
+			require.Equal(t, 42.0, *f)
+		})
+	})
+
+	t.Run("should fill the reference series with NaN", func(t *testing.T) {
+		cmd := unmarshal(t)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{reference}},
+			"B": mathexp.Results{Values: mathexp.Values{mathexp.NewScalar("B", ptr.Float64(math.NaN()))}},
+		})
+		require.NoError(t, err)
+		requireBroadcast(t, res, func(f *float64) {
+			require.NotNil(t, f)
+			require.True(t, math.IsNaN(*f))
+		})
+	})
+
+	t.Run("should pair numbers and series by labels", func(t *testing.T) {
+		cmd := unmarshal(t)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{reference}},
+			"B": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"host": "b"}, 1),
+				number(data.Labels{"host": "a"}, 2),
+			}},
+		})
+		require.NoError(t, err)
+		requireBroadcast(t, res, func(f *float64) {
+			require.NotNil(t, f)
+			require.Equal(t, 2.0, *f)
+		})
+	})
+
+	t.Run("should return NoData if the value is NoData", func(t *testing.T) {
+		cmd := unmarshal(t)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{reference}},
+			"B": mathexp.Results{Values: mathexp.Values{mathexp.NewNoData()}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, mathexp.NewNoData().Type(), res.Values[0].Type())
+	})
+
+	t.Run("should fail if the value is a series", func(t *testing.T) {
+		cmd := unmarshal(t)
+		_, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{reference}},
+			"B": mathexp.Results{Values: mathexp.Values{reference}},
+		})
+		require.Error(t, err)
+		var mismatch ErrInputTypeMismatch
+		require.ErrorAs(t, err, &mismatch)
+		require.Equal(t, "B", mismatch.Input)
+	})
+
+	t.Run("should fail if shapeExpression is missing", func(t *testing.T) {
+		_, err := UnmarshalBroadcastCommand(&rawNode{
+			RefID: "C",
+			Query: map[string]interface{}{"valueExpression": "B"},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "shapeExpression")
+	})
+}
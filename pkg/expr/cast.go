@@ -0,0 +1,194 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+const (
+	// CastToNumber converts series to numbers by reducing them.
+	CastToNumber = "number"
+	// CastToSeries converts numbers to series by repeating them across the time range.
+	CastToSeries = "series"
+
+	// castDefaultReducer is the reducer used to cast series to numbers when none is given.
+	castDefaultReducer = "last"
+	// castDefaultMaxDataPoints is the number of points the window of a cast to series
+	// is derived from when neither a window nor maxDataPoints is given.
+	castDefaultMaxDataPoints = 100
+)
+
+// CastCommand is an expression command that converts its input to numbers or to series,
+// so it can be used by commands that only accept one of these types. Values that already
+// have the target type are returned as they are.
+type CastCommand struct {
+	VarToCast string
+	To        string
+	// Reducer reduces series to numbers when casting to numbers.
+	Reducer string
+	// Window is the interval between the points of the series when casting to series.
+	Window    time.Duration
+	TimeRange TimeRange
+	refID     string
+}
+
+// NewCastCommand creates a new CastCommand.
+func NewCastCommand(refID, varToCast, to, reducer string, window time.Duration, tr TimeRange) (*CastCommand, error) {
+	switch to {
+	case CastToNumber:
+		if _, err := mathexp.GetReduceFunc(reducer); err != nil {
+			return nil, err
+		}
+	case CastToSeries:
+		if tr == nil {
+			return nil, fmt.Errorf("time range must be specified for refID %s", refID)
+		}
+		if window <= 0 {
+			return nil, fmt.Errorf("cast window must be greater than zero, got %v", window)
+		}
+	default:
+		return nil, fmt.Errorf("cast to '%s' is not supported. Supported: [%s,%s]", to, CastToNumber, CastToSeries)
+	}
+	return &CastCommand{
+		VarToCast: varToCast,
+		To:        to,
+		Reducer:   reducer,
+		Window:    window,
+		TimeRange: tr,
+		refID:     refID,
+	}, nil
+}
+
+// UnmarshalCastCommand creates a CastCommand from Grafana's frontend query.
+func UnmarshalCastCommand(rn *rawNode) (*CastCommand, error) {
+	refID, err := rn.outputRefID(TypeCast)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToCast, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToCast = strings.TrimPrefix(varToCast, "$")
+
+	rawTo, ok := rn.Query["to"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "to"}
+	}
+	to, ok := rawTo.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "to", "a string", rawTo)
+	}
+
+	reducer := castDefaultReducer
+	if rawReducer, ok := rn.Query["reducer"]; ok {
+		reducer, ok = rawReducer.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "reducer", "a string", rawReducer)
+		}
+	}
+
+	var window time.Duration
+	if to == CastToSeries && rn.TimeRange != nil {
+		maxDataPoints := int64(castDefaultMaxDataPoints)
+		if rawMaxDP, ok := rn.Query["maxDataPoints"]; ok {
+			floatMaxDP, ok := rawMaxDP.(float64)
+			if !ok {
+				return nil, newErrInvalidInputType(rn.RefID, "maxDataPoints", "a number", rawMaxDP)
+			}
+			maxDataPoints = int64(floatMaxDP)
+		}
+		if rawWindow, ok := rn.Query["window"]; ok {
+			s, ok := rawWindow.(string)
+			if !ok {
+				return nil, newErrInvalidInputType(rn.RefID, "window", "a string", rawWindow)
+			}
+			var err error
+			window, err = gtime.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf(`failed to parse cast "window" duration field %q: %w`, s, err)
+			}
+		} else if maxDataPoints > 0 {
+			window = resampleWindowFromMaxDataPoints(rn.TimeRange, maxDataPoints)
+		}
+	}
+
+	return NewCastCommand(refID, varToCast, to, reducer, window, rn.TimeRange)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (cc *CastCommand) NeedsVars() []string {
+	return []string{cc.VarToCast}
+}
+
+// RefID returns the refID that names the results of the command.
+func (cc *CastCommand) RefID() string {
+	return cc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (cc *CastCommand) Execute(_ context.Context, now time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[cc.VarToCast].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			if cc.To == CastToSeries {
+				newRes.Values = append(newRes.Values, renameSeries(v, cc.refID))
+				continue
+			}
+			num, err := v.Reduce(cc.refID, cc.Reducer, nil)
+			if err != nil {
+				return newRes, err
+			}
+			newRes.Values = append(newRes.Values, num)
+		case mathexp.Number:
+			if cc.To == CastToNumber {
+				newRes.Values = append(newRes.Values, renameNumber(v, cc.refID))
+				continue
+			}
+			newRes.Values = append(newRes.Values, cc.numberToSeries(v, now))
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: cc.refID, Input: cc.VarToCast, Command: TypeCast, Expected: parse.TypeVariantSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// numberToSeries returns a series with the value of n every Window over the time range.
+func (cc *CastCommand) numberToSeries(n mathexp.Number, now time.Time) mathexp.Series {
+	tr := cc.TimeRange.AbsoluteTime(now)
+	var times []time.Time
+	for t := tr.From; !t.After(tr.To); t = t.Add(cc.Window) {
+		times = append(times, t)
+	}
+
+	f := n.GetFloat64Value()
+	s := mathexp.NewSeries(cc.refID, n.GetLabels().Copy(), len(times))
+	for i, t := range times {
+		var p *float64
+		if f != nil {
+			v := *f
+			p = &v
+		}
+		s.SetPoint(i, t, p)
+	}
+	return s
+}
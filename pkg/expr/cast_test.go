@@ -0,0 +1,116 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestCastCommand(t *testing.T) {
+	now := time.Unix(3600, 0)
+
+	t.Run("series to number reduces with the implied reducer", func(t *testing.T) {
+		cmd, err := UnmarshalCastCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "to": "number"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, cmd.NeedsVars())
+		require.Equal(t, castDefaultReducer, cmd.Reducer)
+
+		s := mathexp.NewSeries("A", data.Labels{"host": "a"}, 3)
+		s.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+		s.SetPoint(1, time.Unix(10, 0), ptr.Float64(2))
+		s.SetPoint(2, time.Unix(20, 0), ptr.Float64(6))
+
+		res, err := cmd.Execute(context.Background(), now, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{s}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		n, ok := res.Values[0].(mathexp.Number)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"host": "a"}, n.GetLabels())
+		require.Equal(t, ptr.Float64(6), n.GetFloat64Value())
+	})
+
+	t.Run("series to number with an explicit reducer", func(t *testing.T) {
+		cmd, err := UnmarshalCastCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "A", "to": "number", "reducer": "sum"},
+		})
+		require.NoError(t, err)
+
+		s := mathexp.NewSeries("A", nil, 2)
+		s.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+		s.SetPoint(1, time.Unix(10, 0), ptr.Float64(2))
+
+		res, err := cmd.Execute(context.Background(), now, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{s}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, ptr.Float64(3), res.Values[0].(mathexp.Number).GetFloat64Value())
+	})
+
+	t.Run("number to series broadcasts across the time range", func(t *testing.T) {
+		cmd, err := UnmarshalCastCommand(&rawNode{
+			RefID:     "B",
+			Query:     map[string]interface{}{"expression": "A", "to": "series", "window": "15m"},
+			TimeRange: RelativeTimeRange{From: -time.Hour},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 15*time.Minute, cmd.Window)
+
+		n := mathexp.NewNumber("A", data.Labels{"host": "a"})
+		n.SetValue(ptr.Float64(4))
+
+		res, err := cmd.Execute(context.Background(), now, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{n}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		s, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+		require.Equal(t, 5, s.Len())
+		for i := 0; i < s.Len(); i++ {
+			tm, f := s.GetPoint(i)
+			require.True(t, now.Add(-time.Hour).Add(time.Duration(i)*15*time.Minute).Equal(tm))
+			require.Equal(t, ptr.Float64(4), f)
+		}
+	})
+
+	t.Run("number to series derives the window from the time range", func(t *testing.T) {
+		cmd, err := UnmarshalCastCommand(&rawNode{
+			RefID:     "B",
+			Query:     map[string]interface{}{"expression": "A", "to": "series"},
+			TimeRange: RelativeTimeRange{From: -time.Hour},
+		})
+		require.NoError(t, err)
+		require.Greater(t, cmd.Window, time.Duration(0))
+	})
+
+	t.Run("number to series requires a time range", func(t *testing.T) {
+		_, err := UnmarshalCastCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "A", "to": "series"},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("unsupported target type fails", func(t *testing.T) {
+		_, err := UnmarshalCastCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "A", "to": "string"},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "cast to 'string' is not supported")
+	})
+}
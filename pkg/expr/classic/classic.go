@@ -3,6 +3,7 @@ package classic
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -34,7 +35,7 @@ import (
 // then the outcome of ConditionsCmd is true.
 type ConditionsCmd struct {
 	Conditions []condition
-	RefID      string
+	refID      string
 }
 
 // condition is a single condition in ConditionsCmd.
@@ -66,6 +67,11 @@ func (cmd *ConditionsCmd) NeedsVars() []string {
 	return vars
 }
 
+// RefID returns the refID that names the results of the command.
+func (cmd *ConditionsCmd) RefID() string {
+	return cmd.refID
+}
+
 // Execute runs the command and returns the results or an error if the command
 // failed to execute.
 func (cmd *ConditionsCmd) Execute(ctx context.Context, t time.Time, vars mathexp.Vars) (mathexp.Results, error) {
@@ -274,6 +280,9 @@ type ConditionReducerJSON struct {
 
 // UnmarshalConditionsCmd creates a new ConditionsCmd.
 func UnmarshalConditionsCmd(rawQuery map[string]interface{}, refID string) (*ConditionsCmd, error) {
+	if refID == "" {
+		return nil, errors.New("classic_conditions expression is missing a refId")
+	}
 	jsonFromM, err := json.Marshal(rawQuery["conditions"])
 	if err != nil {
 		return nil, fmt.Errorf("failed to remarshal classic condition body: %w", err)
@@ -284,7 +293,7 @@ func UnmarshalConditionsCmd(rawQuery map[string]interface{}, refID string) (*Con
 	}
 
 	c := &ConditionsCmd{
-		RefID: refID,
+		refID: refID,
 	}
 
 	for i, cj := range ccj {
@@ -648,6 +648,7 @@ func TestUnmarshalConditionsCmd(t *testing.T) {
 						Evaluator:  &thresholdEvaluator{Type: "gt", Threshold: 2},
 					},
 				},
+				refID: "B",
 			},
 			needsVars: []string{"A"},
 		},
@@ -688,6 +689,7 @@ func TestUnmarshalConditionsCmd(t *testing.T) {
 						Evaluator:  &rangedEvaluator{Type: "within_range", Lower: 2, Upper: 3},
 					},
 				},
+				refID: "B",
 			},
 			needsVars: []string{"A"},
 		},
@@ -699,11 +701,16 @@ func TestUnmarshalConditionsCmd(t *testing.T) {
 			err := json.Unmarshal([]byte(tt.rawJSON), &rq)
 			require.NoError(t, err)
 
-			cmd, err := UnmarshalConditionsCmd(rq, "")
+			cmd, err := UnmarshalConditionsCmd(rq, "B")
 			require.NoError(t, err)
 			require.Equal(t, tt.expectedCommand, cmd)
 
 			require.Equal(t, tt.needsVars, cmd.NeedsVars())
 		})
 	}
+	t.Run("should fail without a refID", func(t *testing.T) {
+		_, err := UnmarshalConditionsCmd(map[string]interface{}{"conditions": []interface{}{}}, "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "missing a refId")
+	})
 }
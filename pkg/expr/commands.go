@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -11,10 +12,16 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 
 	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+	"github.com/grafana/grafana/pkg/tsdb/intervalv2"
 )
 
 // Command is an interface for all expression commands.
 type Command interface {
+	// RefID returns the refID that names the results of the command. It is the refID of
+	// its expression, unless the query overrides it with "outputRefId". Join is the only
+	// command whose results keep the names of its inputs instead.
+	RefID() string
 	NeedsVars() []string
 	Execute(ctx context.Context, now time.Time, vars mathexp.Vars) (mathexp.Results, error)
 }
@@ -27,12 +34,14 @@ type MathCommand struct {
 }
 
 // NewMathCommand creates a new MathCommand. It will return an error
-// if there is an error parsing expr.
-func NewMathCommand(refID, expr string) (*MathCommand, error) {
+// if there is an error parsing expr. divByZero controls the result of
+// dividing by zero, see mathexp.DivByZeroPolicy.
+func NewMathCommand(refID, expr string, divByZero mathexp.DivByZeroPolicy) (*MathCommand, error) {
 	parsedExpr, err := mathexp.New(expr)
 	if err != nil {
 		return nil, err
 	}
+	parsedExpr.DivByZero = divByZero
 	return &MathCommand{
 		RawExpression: expr,
 		Expression:    parsedExpr,
@@ -42,16 +51,33 @@ func NewMathCommand(refID, expr string) (*MathCommand, error) {
 
 // UnmarshalMathCommand creates a MathCommand from Grafana's frontend query.
 func UnmarshalMathCommand(rn *rawNode) (*MathCommand, error) {
+	refID, err := rn.outputRefID(TypeMath)
+	if err != nil {
+		return nil, err
+	}
 	rawExpr, ok := rn.Query["expression"]
 	if !ok {
-		return nil, errors.New("command is missing an expression")
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "expression"}
 	}
 	exprString, ok := rawExpr.(string)
 	if !ok {
-		return nil, fmt.Errorf("math expression is expected to be a string, got %T", rawExpr)
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawExpr)
+	}
+
+	var divByZero mathexp.DivByZeroPolicy
+	if rawDivByZero, ok := rn.Query["divideByZero"]; ok {
+		s, ok := rawDivByZero.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "divideByZero", "a string", rawDivByZero)
+		}
+		var err error
+		divByZero, err = mathexp.ParseDivByZeroPolicy(s)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	gm, err := NewMathCommand(rn.RefID, exprString)
+	gm, err := NewMathCommand(refID, exprString, divByZero)
 	if err != nil {
 		return nil, fmt.Errorf("invalid math command type: %w", err)
 	}
@@ -64,6 +90,11 @@ func (gm *MathCommand) NeedsVars() []string {
 	return gm.Expression.VarNames
 }
 
+// RefID returns the refID that names the results of the command.
+func (gm *MathCommand) RefID() string {
+	return gm.refID
+}
+
 // Execute runs the command and returns the results or an error if the command
 // failed to execute.
 func (gm *MathCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
@@ -72,12 +103,51 @@ func (gm *MathCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars
 
 // ReduceCommand is an expression command for reduction of a timeseries such as a min, mean, or max.
 type ReduceCommand struct {
-	Reducer      string
-	VarToReduce  string
+	Reducer     string
+	Reducers    []string // when set, each series is reduced by each of them instead of Reducer
+	VarToReduce string
+	EmptyInput  string // what to return when the input has no values or no data, see the ReduceEmpty constants
+	// WithTimestamp adds the ReduceTimestampLabel label to each Number with the time of the
+	// point picked by the reducer. Only the "min" and "max" reducers support it.
+	WithTimestamp bool
+	// PartialResults makes the command stop when its context is done, and return the
+	// Numbers reduced so far along with a PartialResultsError. Otherwise, the whole
+	// input is always reduced.
+	PartialResults bool
+	// AddReducerLabel adds the ReducerNameLabel label to each Number reduced from a series,
+	// so that the reducer of a value can be told apart from the others downstream.
+	AddReducerLabel bool
+	// IncludeInput adds a copy of each input series, labeled with ReduceInputLabel, after the
+	// Numbers reduced from it, e.g. to have the series in the notifications of an alert.
+	IncludeInput bool
 	refID        string
 	seriesMapper mathexp.ReduceMapper
 }
 
+const (
+	// ReduceEmptyToNull returns a single NaN Number when the input of a reduce command has no values,
+	// or only NoData.
+	ReduceEmptyToNull = "mapEmptyToNull"
+	// ReduceEmptyToZero returns a single 0 Number when the input of a reduce command has no values,
+	// or only NoData.
+	ReduceEmptyToZero = "mapEmptyToZero"
+	// ReduceEmptyStrict fails the reduce command when its input has no values, or only NoData.
+	ReduceEmptyStrict = "strict"
+
+	// ReducerLabel is the label with the reducer of each Number when a reduce command has several reducers.
+	ReducerLabel = "__reducer__"
+	// ReducerNameLabel is the label with the reducer of each Number when a reduce command
+	// has AddReducerLabel set.
+	ReducerNameLabel = "reducer"
+	// ReduceTimestampLabel is the label with the time, formatted as RFC3339, of the point picked
+	// by the reducer of each Number when a reduce command has WithTimestamp set. The time of the
+	// first point is used when several points have the reduced value.
+	ReduceTimestampLabel = "__timestamp__"
+	// ReduceInputLabel is the label with the refID of the input of a reduce command that has
+	// IncludeInput set, added to the copies of the input series to tell them from the Numbers.
+	ReduceInputLabel = "__input__"
+)
+
 // NewReduceCommand creates a new ReduceCMD.
 func NewReduceCommand(refID, reducer, varToReduce string, mapper mathexp.ReduceMapper) (*ReduceCommand, error) {
 	_, err := mathexp.GetReduceFunc(reducer)
@@ -95,23 +165,50 @@ func NewReduceCommand(refID, reducer, varToReduce string, mapper mathexp.ReduceM
 
 // UnmarshalReduceCommand creates a MathCMD from Grafana's frontend query.
 func UnmarshalReduceCommand(rn *rawNode) (*ReduceCommand, error) {
+	refID, err := rn.outputRefID(TypeReduce)
+	if err != nil {
+		return nil, err
+	}
 	rawVar, ok := rn.Query["expression"]
 	if !ok {
-		return nil, errors.New("no expression ID is specified to reduce. Must be a reference to an existing query or expression")
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
 	}
 	varToReduce, ok := rawVar.(string)
 	if !ok {
-		return nil, fmt.Errorf("expression ID is expected to be a string, got %T", rawVar)
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
 	}
 	varToReduce = strings.TrimPrefix(varToReduce, "$")
 
-	rawReducer, ok := rn.Query["reducer"]
-	if !ok {
-		return nil, errors.New("no reducer specified")
+	var reducers []string
+	if rawReducers, ok := rn.Query["reducers"]; ok {
+		list, ok := rawReducers.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, newErrInvalidInputType(rn.RefID, "reducers", "a non empty array of strings", rawReducers)
+		}
+		for _, r := range list {
+			reducer, ok := r.(string)
+			if !ok {
+				return nil, newErrInvalidInputType(rn.RefID, "reducers", "an array of strings", r)
+			}
+			if _, err := mathexp.GetReduceFunc(reducer); err != nil {
+				return nil, err
+			}
+			reducers = append(reducers, reducer)
+		}
 	}
-	redFunc, ok := rawReducer.(string)
-	if !ok {
-		return nil, fmt.Errorf("expected reducer to be a string, got %T", rawReducer)
+
+	var redFunc string
+	if rawReducer, ok := rn.Query["reducer"]; ok {
+		redFunc, ok = rawReducer.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "reducer", "a string", rawReducer)
+		}
+	}
+	if redFunc == "" {
+		if len(reducers) == 0 {
+			return nil, ErrMissingField{RefID: rn.RefID, Field: "reducer"}
+		}
+		redFunc = reducers[0]
 	}
 
 	var mapper mathexp.ReduceMapper = nil
@@ -127,23 +224,88 @@ func UnmarshalReduceCommand(rn *rawNode) (*ReduceCommand, error) {
 				case "replaceNN":
 					valueStr, ok := s["replaceWithValue"]
 					if !ok {
-						return nil, errors.New("setting replaceWithValue must be specified when mode is 'replaceNN'")
+						return nil, fmt.Errorf("%w: it must be specified when mode is 'replaceNN'", ErrMissingField{RefID: rn.RefID, Field: "settings.replaceWithValue"})
 					}
 					switch value := valueStr.(type) {
 					case float64:
 						mapper = mathexp.ReplaceNonNumberWithValue{Value: value}
 					default:
-						return nil, fmt.Errorf("setting replaceWithValue must be a number, got %T", value)
+						return nil, newErrInvalidInputType(rn.RefID, "settings.replaceWithValue", "a number", value)
 					}
 				default:
 					return nil, fmt.Errorf("reducer mode '%s' is not supported. Supported only: [dropNN,replaceNN]", mode)
 				}
 			}
 		default:
-			return nil, fmt.Errorf("field settings must be an object, got %T for refId %v", s, rn.RefID)
+			return nil, newErrInvalidInputType(rn.RefID, "settings", "an object", s)
+		}
+	}
+
+	var emptyInput string
+	if rawEmptyInput, ok := rn.Query["emptyInput"]; ok {
+		emptyInput, ok = rawEmptyInput.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "emptyInput", "a string", rawEmptyInput)
+		}
+		switch emptyInput {
+		case "", ReduceEmptyToNull, ReduceEmptyToZero, ReduceEmptyStrict:
+		default:
+			return nil, fmt.Errorf("reducer emptyInput '%s' is not supported. Supported only: [%s,%s,%s]", emptyInput, ReduceEmptyToNull, ReduceEmptyToZero, ReduceEmptyStrict)
 		}
 	}
-	return NewReduceCommand(rn.RefID, redFunc, varToReduce, mapper)
+
+	var withTimestamp bool
+	if rawWithTimestamp, ok := rn.Query["withTimestamp"]; ok {
+		withTimestamp, ok = rawWithTimestamp.(bool)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "withTimestamp", "a boolean", rawWithTimestamp)
+		}
+		if withTimestamp {
+			for _, reducer := range append([]string{redFunc}, reducers...) {
+				switch strings.ToLower(reducer) {
+				case "min", "max":
+				default:
+					return nil, fmt.Errorf("reducer '%s' does not support withTimestamp. Supported only: [min,max]", reducer)
+				}
+			}
+		}
+	}
+
+	var partialResults bool
+	if rawPartialResults, ok := rn.Query["partialResults"]; ok {
+		partialResults, ok = rawPartialResults.(bool)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "partialResults", "a boolean", rawPartialResults)
+		}
+	}
+
+	var addReducerLabel bool
+	if rawAddReducerLabel, ok := rn.Query["addReducerLabel"]; ok {
+		addReducerLabel, ok = rawAddReducerLabel.(bool)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "addReducerLabel", "a boolean", rawAddReducerLabel)
+		}
+	}
+
+	var includeInput bool
+	if rawIncludeInput, ok := rn.Query["includeInput"]; ok {
+		includeInput, ok = rawIncludeInput.(bool)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "includeInput", "a boolean", rawIncludeInput)
+		}
+	}
+
+	rc, err := NewReduceCommand(refID, redFunc, varToReduce, mapper)
+	if err != nil {
+		return nil, err
+	}
+	rc.EmptyInput = emptyInput
+	rc.Reducers = reducers
+	rc.WithTimestamp = withTimestamp
+	rc.PartialResults = partialResults
+	rc.AddReducerLabel = addReducerLabel
+	rc.IncludeInput = includeInput
+	return rc, nil
 }
 
 // NeedsVars returns the variable names (refIds) that are dependencies
@@ -152,18 +314,46 @@ func (gr *ReduceCommand) NeedsVars() []string {
 	return []string{gr.VarToReduce}
 }
 
+// RefID returns the refID that names the results of the command.
+func (gr *ReduceCommand) RefID() string {
+	return gr.refID
+}
+
 // Execute runs the command and returns the results or an error if the command
-// failed to execute.
-func (gr *ReduceCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+// failed to execute. If PartialResults is set and ctx is done before the whole input
+// is reduced, the results reduced so far are returned with a PartialResultsError.
+func (gr *ReduceCommand) Execute(ctx context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
 	newRes := mathexp.Results{}
+	if values := vars[gr.VarToReduce].Values; len(values) == 0 || (gr.EmptyInput != "" && isNoData(values)) {
+		return gr.emptyResult()
+	}
 	for _, val := range vars[gr.VarToReduce].Values {
+		if gr.PartialResults && ctx.Err() != nil {
+			return newRes, PartialResultsError{RefID: gr.refID, Err: ctx.Err()}
+		}
 		switch v := val.(type) {
 		case mathexp.Series:
-			num, err := v.Reduce(gr.refID, gr.Reducer, gr.seriesMapper)
-			if err != nil {
-				return newRes, err
+			if len(gr.Reducers) > 0 {
+				for _, reducer := range gr.Reducers {
+					num, err := gr.reduce(v, reducer)
+					if err != nil {
+						return newRes, err
+					}
+					labels := num.GetLabels().Copy()
+					labels[ReducerLabel] = reducer
+					num.SetLabels(labels)
+					newRes.Values = append(newRes.Values, num)
+				}
+			} else {
+				num, err := gr.reduce(v, gr.Reducer)
+				if err != nil {
+					return newRes, err
+				}
+				newRes.Values = append(newRes.Values, num)
+			}
+			if gr.IncludeInput {
+				newRes.Values = append(newRes.Values, gr.input(v))
 			}
-			newRes.Values = append(newRes.Values, num)
 		case mathexp.Number: // if incoming vars is just a number, any reduce op is just a noop, add it as it is
 			copyV := mathexp.NewNumber(gr.refID, v.GetLabels())
 			copyV.SetValue(v.GetFloat64Value())
@@ -175,28 +365,118 @@ func (gr *ReduceCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Va
 		case mathexp.NoData:
 			newRes.Values = append(newRes.Values, v.New())
 		default:
-			return newRes, fmt.Errorf("can only reduce type series, got type %v", val.Type())
+			return newRes, ErrInputTypeMismatch{RefID: gr.refID, Input: gr.VarToReduce, Command: TypeReduce, Expected: parse.TypeSeriesSet, Actual: val.Type()}
 		}
 	}
 	return newRes, nil
 }
 
+// reduce reduces s with reducer and, if WithTimestamp is set, labels the result with
+// the time of the point picked by the reducer. If AddReducerLabel is set, it also labels
+// the result with reducer.
+func (gr *ReduceCommand) reduce(s mathexp.Series, reducer string) (mathexp.Number, error) {
+	num, err := s.Reduce(gr.refID, reducer, gr.seriesMapper)
+	if err != nil {
+		return num, err
+	}
+	if gr.AddReducerLabel {
+		labels := num.GetLabels().Copy()
+		labels[ReducerNameLabel] = reducer
+		num.SetLabels(labels)
+	}
+	if !gr.WithTimestamp {
+		return num, nil
+	}
+	if t, ok := s.ReduceTime(reducer, gr.seriesMapper); ok {
+		labels := num.GetLabels().Copy()
+		labels[ReduceTimestampLabel] = t.UTC().Format(time.RFC3339Nano)
+		num.SetLabels(labels)
+	}
+	return num, nil
+}
+
+// input returns a copy of the input series s, named after the command and labeled with
+// ReduceInputLabel.
+func (gr *ReduceCommand) input(s mathexp.Series) mathexp.Series {
+	labels := s.GetLabels().Copy()
+	labels[ReduceInputLabel] = gr.VarToReduce
+	input := mathexp.NewSeries(gr.refID, labels, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		input.SetPoint(i, t, f)
+	}
+	return input
+}
+
+// isNoData returns true if values are only NoData, like the input of a query that
+// returned nothing.
+func isNoData(values mathexp.Values) bool {
+	for _, v := range values {
+		if _, ok := v.(mathexp.NoData); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// emptyResult returns the result of the command for an input without values, or with
+// only NoData when EmptyInput is set.
+func (gr *ReduceCommand) emptyResult() (mathexp.Results, error) {
+	var f float64
+	switch gr.EmptyInput {
+	case ReduceEmptyToNull:
+		f = math.NaN()
+	case ReduceEmptyToZero:
+		f = 0
+	case ReduceEmptyStrict:
+		return mathexp.Results{}, fmt.Errorf("no values to reduce in input '%v'", gr.VarToReduce)
+	default:
+		return mathexp.Results{}, nil
+	}
+	n := mathexp.NewNumber(gr.refID, nil)
+	n.SetValue(&f)
+	return mathexp.Results{Values: mathexp.Values{n}}, nil
+}
+
 // ResampleCommand is an expression command for resampling of a timeseries.
 type ResampleCommand struct {
 	Window        time.Duration
+	TimeShift     time.Duration // offset applied to the time of each point before resampling
 	VarToResample string
 	Downsampler   string
 	Upsampler     string
 	TimeRange     TimeRange
-	refID         string
+	// AlignTo is the calendar unit (minute, hour, day or week) the windows are aligned to
+	// in Location, if any. Window is then a whole number of these units.
+	AlignTo  string
+	Location *time.Location
+	refID    string
 }
 
-// NewResampleCommand creates a new ResampleCMD.
-func NewResampleCommand(refID, rawWindow, varToResample string, downsampler string, upsampler string, tr TimeRange) (*ResampleCommand, error) {
-	// TODO: validate reducer here, before execution
-	window, err := gtime.ParseDuration(rawWindow)
-	if err != nil {
-		return nil, fmt.Errorf(`failed to parse resample "window" duration field %q: %w`, window, err)
+// NewResampleCommand creates a new ResampleCMD. The window is either given by rawWindow, or
+// derived from the time range and maxDataPoints when rawWindow is empty. Only one of the
+// two may be set.
+func NewResampleCommand(refID, rawWindow string, maxDataPoints int64, varToResample string, downsampler string, upsampler string, tr TimeRange) (*ResampleCommand, error) {
+	if !isSupported(downsampler, mathexp.GetSupportedDownsamplers()) {
+		return nil, fmt.Errorf("downsampler %q is not supported. Supported: %v", downsampler, mathexp.GetSupportedDownsamplers())
+	}
+	if !isSupported(upsampler, mathexp.GetSupportedUpsamplers()) {
+		return nil, fmt.Errorf("upsampler %q is not supported. Supported: %v", upsampler, mathexp.GetSupportedUpsamplers())
+	}
+	var window time.Duration
+	switch {
+	case rawWindow != "" && maxDataPoints > 0:
+		return nil, errors.New(`resample "window" and "maxDataPoints" cannot be specified together`)
+	case rawWindow != "":
+		var err error
+		window, err = gtime.ParseDuration(rawWindow)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse resample "window" duration field %q: %w`, rawWindow, err)
+		}
+	case maxDataPoints > 0:
+		window = resampleWindowFromMaxDataPoints(tr, maxDataPoints)
+	default:
+		return nil, errors.New(`either resample "window" or "maxDataPoints" must be specified`)
 	}
 	return &ResampleCommand{
 		Window:        window,
@@ -208,50 +488,174 @@ func NewResampleCommand(refID, rawWindow, varToResample string, downsampler stri
 	}, nil
 }
 
+// renameSeries returns a copy of s named refID, for commands that return series of their
+// input unchanged, so that their results are named like the ones they create.
+func renameSeries(s mathexp.Series, refID string) mathexp.Series {
+	res := mathexp.NewSeries(refID, s.GetLabels(), s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		res.SetPoint(i, t, f)
+	}
+	return res
+}
+
+// renameNumber returns a copy of n named refID, like renameSeries.
+func renameNumber(n mathexp.Number, refID string) mathexp.Number {
+	res := mathexp.NewNumber(refID, n.GetLabels())
+	res.SetValue(n.GetFloat64Value())
+	return res
+}
+
+func isSupported(name string, supported []string) bool {
+	for _, s := range supported {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resampleWindowFromMaxDataPoints returns the duration of the time range divided by maxDataPoints,
+// rounded to a human friendly interval.
+func resampleWindowFromMaxDataPoints(tr TimeRange, maxDataPoints int64) time.Duration {
+	return intervalv2.NewCalculator().Calculate(tr.AbsoluteTime(time.Now()), time.Millisecond, maxDataPoints).Value
+}
+
 // UnmarshalResampleCommand creates a ResampleCMD from Grafana's frontend query.
 func UnmarshalResampleCommand(rn *rawNode) (*ResampleCommand, error) {
+	refID, err := rn.outputRefID(TypeResample)
+	if err != nil {
+		return nil, err
+	}
 	if rn.TimeRange == nil {
 		return nil, fmt.Errorf("time range must be specified for refID %s", rn.RefID)
 	}
 	rawVar, ok := rn.Query["expression"]
 	if !ok {
-		return nil, errors.New("no expression ID to resample. must be a reference to an existing query or expression")
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
 	}
 	varToReduce, ok := rawVar.(string)
 	if !ok {
-		return nil, fmt.Errorf("expected resample input variable to be type string, but got type %T", rawVar)
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
 	}
 	varToReduce = strings.TrimPrefix(varToReduce, "$")
 	varToResample := varToReduce
 
-	rawWindow, ok := rn.Query["window"]
-	if !ok {
-		return nil, errors.New("no time duration specified for the window in resample command")
+	var window string
+	var maxDataPoints int64
+	if rawWindow, ok := rn.Query["window"]; ok {
+		window, ok = rawWindow.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "window", "a string", rawWindow)
+		}
 	}
-	window, ok := rawWindow.(string)
-	if !ok {
-		return nil, fmt.Errorf("resample window is expected to be a string, got %T", rawWindow)
+	// maxDataPoints is also set on every query of an alert rule, so it is only used
+	// to derive the window when no window is given.
+	if rawMaxDP, ok := rn.Query["maxDataPoints"]; ok && window == "" {
+		floatMaxDP, ok := rawMaxDP.(float64)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "maxDataPoints", "a number", rawMaxDP)
+		}
+		maxDataPoints = int64(floatMaxDP)
+	}
+	if window == "" && maxDataPoints <= 0 {
+		return nil, fmt.Errorf("%w: no time duration specified for the window in resample command", ErrMissingField{RefID: rn.RefID, Field: "window"})
 	}
 
 	rawDownsampler, ok := rn.Query["downsampler"]
 	if !ok {
-		return nil, errors.New("no downsampler function specified in resample command")
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "downsampler"}
 	}
 	downsampler, ok := rawDownsampler.(string)
 	if !ok {
-		return nil, fmt.Errorf("expected resample downsampler to be a string, got type %T", downsampler)
+		return nil, newErrInvalidInputType(rn.RefID, "downsampler", "a string", rawDownsampler)
 	}
 
 	rawUpsampler, ok := rn.Query["upsampler"]
 	if !ok {
-		return nil, errors.New("no upsampler specified in resample command")
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "upsampler"}
 	}
 	upsampler, ok := rawUpsampler.(string)
 	if !ok {
-		return nil, fmt.Errorf("expected resample downsampler to be a string, got type %T", upsampler)
+		return nil, newErrInvalidInputType(rn.RefID, "upsampler", "a string", rawUpsampler)
+	}
+
+	var timeShift time.Duration
+	if rawTimeShift, ok := rn.Query["timeShift"]; ok {
+		shift, ok := rawTimeShift.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "timeShift", "a string", rawTimeShift)
+		}
+		var err error
+		timeShift, err = parseTimeShift(shift)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse resample "timeShift" duration field %q: %w`, shift, err)
+		}
 	}
 
-	return NewResampleCommand(rn.RefID, window, varToResample, downsampler, upsampler, rn.TimeRange)
+	rc, err := NewResampleCommand(refID, window, maxDataPoints, varToResample, downsampler, upsampler, rn.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+	rc.TimeShift = timeShift
+
+	if rawAlignTo, ok := rn.Query["alignTo"]; ok {
+		alignTo, ok := rawAlignTo.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "alignTo", "a string", rawAlignTo)
+		}
+		unit := resampleAlignUnit(alignTo)
+		if unit == 0 {
+			return nil, fmt.Errorf("resample alignTo %q is not supported. Supported: %v", alignTo, supportedResampleAlignments)
+		}
+		if rc.Window <= 0 || rc.Window%unit != 0 {
+			return nil, fmt.Errorf("resample window %v must be a whole number of %ss to be aligned to them", rc.Window, alignTo)
+		}
+		location := time.UTC
+		if rawTimezone, ok := rn.Query["timezone"]; ok {
+			timezone, ok := rawTimezone.(string)
+			if !ok {
+				return nil, newErrInvalidInputType(rn.RefID, "timezone", "a string", rawTimezone)
+			}
+			location, err = time.LoadLocation(timezone)
+			if err != nil {
+				return nil, fmt.Errorf(`failed to load resample "timezone" %q: %w`, timezone, err)
+			}
+		}
+		rc.AlignTo = alignTo
+		rc.Location = location
+	}
+	return rc, nil
+}
+
+var supportedResampleAlignments = []string{"minute", "hour", "day", "week"}
+
+// resampleAlignUnit returns the nominal duration of the calendar unit, or 0 if it is
+// not supported.
+func resampleAlignUnit(unit string) time.Duration {
+	switch unit {
+	case "minute":
+		return time.Minute
+	case "hour":
+		return time.Hour
+	case "day":
+		return 24 * time.Hour
+	case "week":
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// parseTimeShift parses a duration such as "1h" or "7d" that may be negative.
+func parseTimeShift(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "-") {
+		d, err := gtime.ParseDuration(strings.TrimPrefix(s, "-"))
+		return -d, err
+	}
+	return gtime.ParseDuration(strings.TrimPrefix(s, "+"))
 }
 
 // NeedsVars returns the variable names (refIds) that are dependencies
@@ -260,6 +664,11 @@ func (gr *ResampleCommand) NeedsVars() []string {
 	return []string{gr.VarToResample}
 }
 
+// RefID returns the refID that names the results of the command.
+func (gr *ResampleCommand) RefID() string {
+	return gr.refID
+}
+
 // Execute runs the command and returns the results or an error if the command
 // failed to execute.
 func (gr *ResampleCommand) Execute(_ context.Context, now time.Time, vars mathexp.Vars) (mathexp.Results, error) {
@@ -271,7 +680,16 @@ func (gr *ResampleCommand) Execute(_ context.Context, now time.Time, vars mathex
 		}
 		switch v := val.(type) {
 		case mathexp.Series:
-			num, err := v.Resample(gr.refID, gr.Window, gr.Downsampler, gr.Upsampler, timeRange.From, timeRange.To)
+			if gr.TimeShift != 0 {
+				v = v.Shift(gr.TimeShift)
+			}
+			var num mathexp.Series
+			var err error
+			if gr.AlignTo != "" {
+				num, err = v.ResampleAt(gr.refID, gr.alignedTimes(timeRange.From, timeRange.To), gr.Downsampler, gr.Upsampler)
+			} else {
+				num, err = v.Resample(gr.refID, gr.Window, gr.Downsampler, gr.Upsampler, timeRange.From, timeRange.To)
+			}
 			if err != nil {
 				return newRes, err
 			}
@@ -280,12 +698,60 @@ func (gr *ResampleCommand) Execute(_ context.Context, now time.Time, vars mathex
 			newRes.Values = append(newRes.Values, v.New())
 			return newRes, nil
 		default:
-			return newRes, fmt.Errorf("can only resample type series, got type %v", val.Type())
+			return newRes, ErrInputTypeMismatch{RefID: gr.refID, Input: gr.VarToResample, Command: TypeResample, Expected: parse.TypeSeriesSet, Actual: val.Type()}
 		}
 	}
 	return newRes, nil
 }
 
+// alignedTimes returns the times of the points of the resampled series when the windows
+// are aligned to AlignTo: the start of the unit that contains from in Location, and every
+// Window after it up to to. Days and weeks (starting on Monday) follow the calendar, so
+// they last 23 or 25 hours across DST transitions.
+func (gr *ResampleCommand) alignedTimes(from, to time.Time) []time.Time {
+	location := gr.Location
+	if location == nil {
+		location = time.UTC
+	}
+	unit := resampleAlignUnit(gr.AlignTo)
+	unitsPerWindow := int(gr.Window / unit)
+
+	from = from.In(location)
+	var start time.Time
+	switch gr.AlignTo {
+	case "day", "week":
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, location)
+		if gr.AlignTo == "week" {
+			start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		}
+	default:
+		// Truncate works on absolute time, so the offset of the timezone is added for
+		// units to start on the hour or minute of the local time.
+		_, offset := from.Zone()
+		shift := time.Duration(offset) * time.Second
+		start = from.Add(shift).Truncate(unit).Add(-shift)
+	}
+
+	var times []time.Time
+	for i := 0; ; i++ {
+		// Each time is computed from start so that the days of DST transitions don't
+		// shift the following ones.
+		var t time.Time
+		switch gr.AlignTo {
+		case "day":
+			t = start.AddDate(0, 0, i*unitsPerWindow)
+		case "week":
+			t = start.AddDate(0, 0, 7*i*unitsPerWindow)
+		default:
+			t = start.Add(time.Duration(i) * gr.Window)
+		}
+		if t.After(to) {
+			return times
+		}
+		times = append(times, t.UTC())
+	}
+}
+
 // CommandType is the type of the expression command.
 type CommandType int
 
@@ -302,6 +768,32 @@ const (
 	TypeClassicConditions
 	// TypeThreshold is the CMDType for checking if a threshold has been crossed
 	TypeThreshold
+	// TypeJoin is the CMDType for combining the results of several expressions.
+	TypeJoin
+	// TypeBroadcast is the CMDType for turning a number into a series shaped like another series.
+	TypeBroadcast
+	// TypeNumberToSeries is the CMDType for turning numbers into single point series.
+	TypeNumberToSeries
+	// TypeCast is the CMDType for converting series to numbers and numbers to series.
+	TypeCast
+	// TypeRolling is the CMDType for aggregating each point of a series with the points before it within a window.
+	TypeRolling
+	// TypeValueFilter is the CMDType for keeping the numbers or series whose value matches a condition.
+	TypeValueFilter
+	// TypeRelabel is the CMDType for renaming and prefixing the labels of numbers and series.
+	TypeRelabel
+	// TypeRate is the CMDType for computing the per-second rate of counter series.
+	TypeRate
+	// TypeIncrease is the CMDType for computing the total increase of counter series.
+	TypeIncrease
+	// TypeFill is the CMDType for filling the gaps of series to make them regularly spaced.
+	TypeFill
+	// TypeAggregate is the CMDType for aggregating series or numbers together.
+	TypeAggregate
+	// TypeCumulative is the CMDType for the running total of series.
+	TypeCumulative
+	// TypePromQLJoin is the CMDType for combining two inputs with PromQL's vector matching.
+	TypePromQLJoin
 )
 
 func (gt CommandType) String() string {
@@ -314,6 +806,34 @@ func (gt CommandType) String() string {
 		return "resample"
 	case TypeClassicConditions:
 		return "classic_conditions"
+	case TypeThreshold:
+		return "threshold"
+	case TypeJoin:
+		return "join"
+	case TypeBroadcast:
+		return "broadcast"
+	case TypeNumberToSeries:
+		return "number_to_series"
+	case TypeCast:
+		return "cast"
+	case TypeRolling:
+		return "rolling"
+	case TypeValueFilter:
+		return "value_filter"
+	case TypeRelabel:
+		return "relabel"
+	case TypeRate:
+		return "rate"
+	case TypeIncrease:
+		return "increase"
+	case TypeFill:
+		return "fill"
+	case TypeAggregate:
+		return "aggregate"
+	case TypeCumulative:
+		return "cumulative"
+	case TypePromQLJoin:
+		return "promql_join"
 	default:
 		return "unknown"
 	}
@@ -332,6 +852,32 @@ func ParseCommandType(s string) (CommandType, error) {
 		return TypeClassicConditions, nil
 	case "threshold":
 		return TypeThreshold, nil
+	case "join":
+		return TypeJoin, nil
+	case "broadcast":
+		return TypeBroadcast, nil
+	case "number_to_series":
+		return TypeNumberToSeries, nil
+	case "cast":
+		return TypeCast, nil
+	case "rolling":
+		return TypeRolling, nil
+	case "value_filter":
+		return TypeValueFilter, nil
+	case "relabel":
+		return TypeRelabel, nil
+	case "rate":
+		return TypeRate, nil
+	case "increase":
+		return TypeIncrease, nil
+	case "fill":
+		return TypeFill, nil
+	case "aggregate":
+		return TypeAggregate, nil
+	case "cumulative":
+		return TypeCumulative, nil
+	case "promql_join":
+		return TypePromQLJoin, nil
 	default:
 		return TypeUnknown, fmt.Errorf("'%v' is not a recognized expression type", s)
 	}
@@ -3,7 +3,9 @@ package expr
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"testing"
 	"time"
@@ -167,6 +169,465 @@ func TestReduceExecute(t *testing.T) {
 	})
 }
 
+func TestReduceExecute_EmptyInput(t *testing.T) {
+	var tests = []struct {
+		emptyInput string
+		isError    bool
+		expected   []float64
+	}{
+		{emptyInput: ReduceEmptyToNull, expected: []float64{math.NaN()}},
+		{emptyInput: ReduceEmptyToZero, expected: []float64{0}},
+		{emptyInput: ReduceEmptyStrict, isError: true},
+	}
+	inputs := map[string]mathexp.Values{
+		"no values": {},
+		// A query that returns nothing is passed to the command as NoData.
+		"no data": {mathexp.NoData{}.New()},
+	}
+	for _, test := range tests {
+		for name, input := range inputs {
+			t.Run(fmt.Sprintf("emptyInput %q with %s", test.emptyInput, name), func(t *testing.T) {
+				cmd, err := UnmarshalReduceCommand(&rawNode{
+					RefID: "B",
+					Query: map[string]interface{}{
+						"expression": "$A",
+						"reducer":    "mean",
+						"emptyInput": test.emptyInput,
+					},
+				})
+				require.NoError(t, err)
+
+				res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+					"A": mathexp.Results{Values: input},
+				})
+				if test.isError {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				require.Len(t, res.Values, len(test.expected))
+				for i, expected := range test.expected {
+					n, ok := res.Values[i].(mathexp.Number)
+					require.True(t, ok)
+					require.Empty(t, n.GetLabels())
+					f := n.GetFloat64Value()
+					require.NotNil(t, f)
+					if math.IsNaN(expected) {
+						require.True(t, math.IsNaN(*f))
+					} else {
+						require.Equal(t, expected, *f)
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("without emptyInput", func(t *testing.T) {
+		cmd, err := NewReduceCommand("B", "mean", "A", nil)
+		require.NoError(t, err)
+
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{}},
+		})
+		require.NoError(t, err)
+		require.Empty(t, res.Values)
+
+		res, err = cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{mathexp.NoData{}.New()}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.IsType(t, mathexp.NoData{}, res.Values[0])
+	})
+
+	t.Run("should not apply when input has values", func(t *testing.T) {
+		cmd, err := NewReduceCommand("B", "mean", "A", nil)
+		require.NoError(t, err)
+		cmd.EmptyInput = ReduceEmptyStrict
+
+		series := mathexp.NewSeries("A", nil, 1)
+		series.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{series}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+	})
+
+	t.Run("should fail on unknown emptyInput", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "$A",
+				"reducer":    "mean",
+				"emptyInput": "mapEmptyToOne",
+			},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestReduceCommand_Errors(t *testing.T) {
+	t.Run("should return ErrInputTypeMismatch when input is a scalar", func(t *testing.T) {
+		cmd, err := NewReduceCommand("B", "mean", "A", nil)
+		require.NoError(t, err)
+
+		_, err = cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.NewScalarResults("A", ptr.Float64(1)),
+		})
+		require.Error(t, err)
+
+		var mismatch ErrInputTypeMismatch
+		require.True(t, errors.As(err, &mismatch))
+		require.Equal(t, ErrInputTypeMismatch{
+			RefID:    "B",
+			Input:    "A",
+			Command:  TypeReduce,
+			Expected: parse.TypeSeriesSet,
+			Actual:   parse.TypeScalar,
+		}, mismatch)
+	})
+
+	t.Run("should return ErrMissingField when expression is missing", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"reducer": "mean"},
+		})
+		require.Error(t, err)
+
+		var missing ErrMissingField
+		require.True(t, errors.As(err, &missing))
+		require.Equal(t, "expression", missing.Field)
+		require.Equal(t, "B", missing.RefID)
+	})
+
+	t.Run("should return ErrInvalidInputType when reducer is not a string", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "reducer": 1.0},
+		})
+		require.Error(t, err)
+
+		var invalid ErrInvalidInputType
+		require.True(t, errors.As(err, &invalid))
+		require.Equal(t, "reducer", invalid.Field)
+		require.Equal(t, "float64", invalid.Actual)
+	})
+}
+
+func TestReduceExecute_MultipleReducers(t *testing.T) {
+	cmd, err := UnmarshalReduceCommand(&rawNode{
+		RefID: "B",
+		Query: map[string]interface{}{
+			"expression": "$A",
+			"reducers":   []interface{}{"min", "mean", "max"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"min", "mean", "max"}, cmd.Reducers)
+
+	series := func(labels data.Labels, values ...float64) mathexp.Series {
+		s := mathexp.NewSeries("A", labels, len(values))
+		for i, v := range values {
+			s.SetPoint(i, time.Unix(int64(i), 0), ptr.Float64(v))
+		}
+		return s
+	}
+	res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{
+			series(data.Labels{"host": "a"}, 1, 2, 6),
+			series(nil, 4, 8),
+		}},
+	})
+	require.NoError(t, err)
+
+	expected := []struct {
+		labels data.Labels
+		value  float64
+	}{
+		{data.Labels{"host": "a", ReducerLabel: "min"}, 1},
+		{data.Labels{"host": "a", ReducerLabel: "mean"}, 3},
+		{data.Labels{"host": "a", ReducerLabel: "max"}, 6},
+		{data.Labels{ReducerLabel: "min"}, 4},
+		{data.Labels{ReducerLabel: "mean"}, 6},
+		{data.Labels{ReducerLabel: "max"}, 8},
+	}
+	require.Len(t, res.Values, len(expected))
+	for i, e := range expected {
+		n, ok := res.Values[i].(mathexp.Number)
+		require.True(t, ok)
+		require.Equal(t, e.labels, n.GetLabels())
+		require.Equal(t, ptr.Float64(e.value), n.GetFloat64Value())
+	}
+
+	t.Run("should fail on unknown reducer", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "$A",
+				"reducers":   []interface{}{"min", "median"},
+			},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("should fail on empty reducers", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "$A",
+				"reducers":   []interface{}{},
+			},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestReduceExecute_WithTimestamp(t *testing.T) {
+	series := mathexp.NewSeries("A", data.Labels{"host": "a"}, 0)
+	for i, v := range []float64{3, 9, 1, 9, 4} {
+		series.AppendPoint(time.Unix(int64(i*60), 0), ptr.Float64(v))
+	}
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{series}}}
+
+	tests := []struct {
+		reducer  string
+		expected float64
+		time     time.Time
+	}{
+		{reducer: "min", expected: 1, time: time.Unix(120, 0)},
+		// the peak is reached twice, the first occurrence is used
+		{reducer: "max", expected: 9, time: time.Unix(60, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reducer, func(t *testing.T) {
+			cmd, err := UnmarshalReduceCommand(&rawNode{
+				RefID: "B",
+				Query: map[string]interface{}{
+					"expression":    "$A",
+					"reducer":       tt.reducer,
+					"withTimestamp": true,
+				},
+			})
+			require.NoError(t, err)
+			require.True(t, cmd.WithTimestamp)
+
+			res, err := cmd.Execute(context.Background(), time.Now(), vars)
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+			n, ok := res.Values[0].(mathexp.Number)
+			require.True(t, ok)
+			require.Equal(t, ptr.Float64(tt.expected), n.GetFloat64Value())
+			require.Equal(t, data.Labels{
+				"host":               "a",
+				ReduceTimestampLabel: tt.time.UTC().Format(time.RFC3339Nano),
+			}, n.GetLabels())
+		})
+	}
+
+	t.Run("should not add the label when the series has no values", func(t *testing.T) {
+		cmd, err := NewReduceCommand("B", "max", "A", nil)
+		require.NoError(t, err)
+		cmd.WithTimestamp = true
+
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{mathexp.NewSeries("A", nil, 0)}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Empty(t, res.Values[0].GetLabels())
+	})
+
+	t.Run("should fail with other reducers", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression":    "$A",
+				"reducers":      []interface{}{"max", "mean"},
+				"withTimestamp": true,
+			},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "reducer 'mean' does not support withTimestamp")
+	})
+}
+
+// cancelingMapper is a ReduceMapper that cancels a context once it has mapped the result of n reductions.
+type cancelingMapper struct {
+	n      *int
+	cancel context.CancelFunc
+}
+
+func (m cancelingMapper) MapInput(f *float64) *float64 {
+	return f
+}
+
+func (m cancelingMapper) MapOutput(f *float64) *float64 {
+	*m.n--
+	if *m.n == 0 {
+		m.cancel()
+	}
+	return f
+}
+
+func TestReduceExecute_AddReducerLabel(t *testing.T) {
+	inputLabels := data.Labels{"host": "a"}
+	input := mathexp.NewSeries("A", inputLabels, 2)
+	input.SetPoint(0, time.Unix(0, 0), ptr.Float64(2))
+	input.SetPoint(1, time.Unix(1, 0), ptr.Float64(4))
+
+	tests := []struct {
+		name     string
+		query    map[string]interface{}
+		expected data.Labels
+	}{
+		{
+			name:     "disabled by default",
+			query:    map[string]interface{}{"expression": "$A", "reducer": "mean"},
+			expected: data.Labels{"host": "a"},
+		},
+		{
+			name:     "disabled",
+			query:    map[string]interface{}{"expression": "$A", "reducer": "mean", "addReducerLabel": false},
+			expected: data.Labels{"host": "a"},
+		},
+		{
+			name:     "enabled",
+			query:    map[string]interface{}{"expression": "$A", "reducer": "mean", "addReducerLabel": true},
+			expected: data.Labels{"host": "a", ReducerNameLabel: "mean"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := UnmarshalReduceCommand(&rawNode{RefID: "B", Query: tt.query})
+			require.NoError(t, err)
+
+			res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{input}},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+			n, ok := res.Values[0].(mathexp.Number)
+			require.True(t, ok)
+			require.Equal(t, tt.expected, n.GetLabels())
+			require.Equal(t, ptr.Float64(3), n.GetFloat64Value())
+		})
+	}
+
+	// the labels of the input are not modified
+	require.Equal(t, data.Labels{"host": "a"}, inputLabels)
+	require.Equal(t, data.Labels{"host": "a"}, input.GetLabels())
+
+	t.Run("should fail on a non boolean addReducerLabel", func(t *testing.T) {
+		_, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "reducer": "mean", "addReducerLabel": "yes"},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestReduceExecute_IncludeInput(t *testing.T) {
+	cmd, err := UnmarshalReduceCommand(&rawNode{
+		RefID: "B",
+		Query: map[string]interface{}{"expression": "$A", "reducer": "max", "includeInput": true},
+	})
+	require.NoError(t, err)
+	require.True(t, cmd.IncludeInput)
+
+	input := mathexp.NewSeries("A", data.Labels{"host": "a"}, 2)
+	input.SetPoint(0, time.Unix(0, 0), ptr.Float64(2))
+	input.SetPoint(1, time.Unix(60, 0), ptr.Float64(4))
+
+	res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{input}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Values, 2)
+
+	n, ok := res.Values[0].(mathexp.Number)
+	require.True(t, ok)
+	require.Equal(t, data.Labels{"host": "a"}, n.GetLabels())
+	require.Equal(t, ptr.Float64(4), n.GetFloat64Value())
+
+	s, ok := res.Values[1].(mathexp.Series)
+	require.True(t, ok)
+	require.Equal(t, data.Labels{"host": "a", ReduceInputLabel: "A"}, s.GetLabels())
+	require.Equal(t, input.Len(), s.Len())
+	for i := 0; i < input.Len(); i++ {
+		expectedTime, expectedValue := input.GetPoint(i)
+		actualTime, actualValue := s.GetPoint(i)
+		require.Equal(t, expectedTime, actualTime)
+		require.Equal(t, expectedValue, actualValue)
+	}
+
+	// the input series is not modified
+	require.Equal(t, data.Labels{"host": "a"}, input.GetLabels())
+
+	t.Run("not included by default", func(t *testing.T) {
+		cmd, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "reducer": "max"},
+		})
+		require.NoError(t, err)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{input}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.IsType(t, mathexp.Number{}, res.Values[0])
+	})
+}
+
+func TestReduceExecute_PartialResults(t *testing.T) {
+	values := mathexp.Values{}
+	for i := 0; i < 5; i++ {
+		s := mathexp.NewSeries("A", data.Labels{"host": fmt.Sprint(i)}, 1)
+		s.SetPoint(0, time.Unix(0, 0), ptr.Float64(float64(i)))
+		values = append(values, s)
+	}
+	vars := mathexp.Vars{"A": mathexp.Results{Values: values}}
+
+	t.Run("should return the numbers reduced before the cancellation", func(t *testing.T) {
+		cmd, err := UnmarshalReduceCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "reducer": "max", "partialResults": true},
+		})
+		require.NoError(t, err)
+		require.True(t, cmd.PartialResults)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		n := 2
+		cmd.seriesMapper = cancelingMapper{n: &n, cancel: cancel}
+
+		res, err := cmd.Execute(ctx, time.Now(), vars)
+		var partial PartialResultsError
+		require.True(t, errors.As(err, &partial))
+		require.Equal(t, "B", partial.RefID)
+		require.ErrorIs(t, err, context.Canceled)
+
+		require.Len(t, res.Values, 2)
+		for i, v := range res.Values {
+			require.Equal(t, ptr.Float64(float64(i)), v.(mathexp.Number).GetFloat64Value())
+		}
+	})
+
+	t.Run("should reduce the whole input when not enabled", func(t *testing.T) {
+		cmd, err := NewReduceCommand("B", "max", "A", nil)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		n := 2
+		cmd.seriesMapper = cancelingMapper{n: &n, cancel: cancel}
+
+		res, err := cmd.Execute(ctx, time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 5)
+	})
+}
+
 func randomReduceFunc() string {
 	res := mathexp.GetSupportedReduceFuncs()
 	return res[rand.Intn(len(res))]
@@ -178,7 +639,7 @@ func TestResampleCommand_Execute(t *testing.T) {
 		From: -10 * time.Second,
 		To:   0,
 	}
-	cmd, err := NewResampleCommand(util.GenerateShortUID(), "1s", varToReduce, "sum", "pad", tr)
+	cmd, err := NewResampleCommand(util.GenerateShortUID(), "1s", 0, varToReduce, "sum", "pad", tr)
 	require.NoError(t, err)
 
 	var tests = []struct {
@@ -230,3 +691,486 @@ func TestResampleCommand_Execute(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+func TestCommandType_String(t *testing.T) {
+	for _, s := range []string{"math", "reduce", "resample", "classic_conditions", "threshold", "join", "broadcast", "number_to_series", "cast", "rolling", "value_filter", "relabel", "rate", "increase", "fill", "aggregate", "cumulative", "promql_join"} {
+		t.Run(s, func(t *testing.T) {
+			cmdType, err := ParseCommandType(s)
+			require.NoError(t, err)
+			require.Equal(t, s, cmdType.String())
+		})
+	}
+}
+
+func TestNewResampleCommand_Window(t *testing.T) {
+	tr := RelativeTimeRange{
+		From: -time.Hour,
+		To:   0,
+	}
+
+	t.Run("should use the window when specified", func(t *testing.T) {
+		cmd, err := NewResampleCommand("B", "10s", 0, "A", "mean", "pad", tr)
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Second, cmd.Window)
+	})
+
+	t.Run("should derive the window from maxDataPoints", func(t *testing.T) {
+		cmd, err := NewResampleCommand("B", "", 100, "A", "mean", "pad", tr)
+		require.NoError(t, err)
+		// 1h / 100 = 36s, rounded to 30s
+		require.Equal(t, 30*time.Second, cmd.Window)
+	})
+
+	t.Run("should fail when both window and maxDataPoints are specified", func(t *testing.T) {
+		_, err := NewResampleCommand("B", "10s", 100, "A", "mean", "pad", tr)
+		require.Error(t, err)
+	})
+
+	t.Run("should fail when neither window nor maxDataPoints are specified", func(t *testing.T) {
+		_, err := NewResampleCommand("B", "", 0, "A", "mean", "pad", tr)
+		require.Error(t, err)
+	})
+
+	t.Run("should ignore maxDataPoints in the query when the window is specified", func(t *testing.T) {
+		cmd, err := UnmarshalResampleCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression":    "$A",
+				"window":        "10s",
+				"maxDataPoints": float64(43200),
+				"downsampler":   "mean",
+				"upsampler":     "pad",
+			},
+			TimeRange: tr,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Second, cmd.Window)
+	})
+}
+
+func TestMathCommand_DivByZero(t *testing.T) {
+	series := func(values ...float64) mathexp.Series {
+		s := mathexp.NewSeries("", nil, len(values))
+		for i, v := range values {
+			v := v
+			s.SetPoint(i, time.Unix(int64(i), 0), &v)
+		}
+		return s
+	}
+	vars := mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{series(10, 4, 0)}},
+		"B": mathexp.Results{Values: mathexp.Values{series(0, 2, 0)}},
+	}
+
+	tests := []struct {
+		policy   mathexp.DivByZeroPolicy
+		expected []float64
+	}{
+		{policy: mathexp.DivByZeroDefault, expected: []float64{math.Inf(1), 2, math.NaN()}},
+		{policy: mathexp.DivByZeroNaN, expected: []float64{math.NaN(), 2, math.NaN()}},
+		{policy: mathexp.DivByZeroZero, expected: []float64{0, 2, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("policy %q", tt.policy), func(t *testing.T) {
+			cmd, err := NewMathCommand("C", "$A / $B", tt.policy)
+			require.NoError(t, err)
+
+			res, err := cmd.Execute(context.Background(), time.Now(), vars)
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+
+			s := res.Values[0].(mathexp.Series)
+			require.Equal(t, len(tt.expected), s.Len())
+			for i, expected := range tt.expected {
+				_, f := s.GetPoint(i)
+				require.NotNil(t, f)
+				if math.IsNaN(expected) {
+					require.True(t, math.IsNaN(*f), "expected NaN at point %d, got %v", i, *f)
+				} else {
+					require.Equal(t, expected, *f)
+				}
+			}
+		})
+	}
+
+	t.Run(`policy "error"`, func(t *testing.T) {
+		cmd, err := NewMathCommand("C", "$A / $B", mathexp.DivByZeroError)
+		require.NoError(t, err)
+
+		_, err = cmd.Execute(context.Background(), time.Now(), vars)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "division by zero in expression 'C'")
+	})
+
+	t.Run("should read policy from the query", func(t *testing.T) {
+		cmd, err := UnmarshalMathCommand(&rawNode{
+			RefID: "C",
+			Query: map[string]interface{}{
+				"expression":   "$A / $B",
+				"divideByZero": "zero",
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, mathexp.DivByZeroZero, cmd.Expression.DivByZero)
+	})
+
+	t.Run("should fail on unknown policy in the query", func(t *testing.T) {
+		_, err := UnmarshalMathCommand(&rawNode{
+			RefID: "C",
+			Query: map[string]interface{}{
+				"expression":   "$A / $B",
+				"divideByZero": "ignore",
+			},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestMathCommand_Ternary(t *testing.T) {
+	series := func(labels data.Labels, values ...float64) mathexp.Series {
+		s := mathexp.NewSeries("", labels, len(values))
+		for i, v := range values {
+			v := v
+			s.SetPoint(i, time.Unix(int64(i), 0), &v)
+		}
+		return s
+	}
+	number := func(labels data.Labels, v float64) mathexp.Number {
+		n := mathexp.NewNumber("", labels)
+		n.SetValue(&v)
+		return n
+	}
+	values := func(v mathexp.Value) []*float64 {
+		switch v := v.(type) {
+		case mathexp.Series:
+			res := make([]*float64, 0, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				_, f := v.GetPoint(i)
+				res = append(res, f)
+			}
+			return res
+		case mathexp.Number:
+			return []*float64{v.GetFloat64Value()}
+		case mathexp.Scalar:
+			return []*float64{v.GetFloat64Value()}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		vars     mathexp.Vars
+		expected [][]float64 // values of each result
+	}{
+		{
+			name:     "scalar",
+			expr:     "2 > 1 ? 10 : 20",
+			expected: [][]float64{{10}},
+		},
+		{
+			name: "numbers",
+			expr: "$A > 10 ? 1 : 0",
+			vars: mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{
+					number(data.Labels{"host": "a"}, 5),
+					number(data.Labels{"host": "b"}, 15),
+				}},
+			},
+			expected: [][]float64{{0}, {1}},
+		},
+		{
+			name: "series",
+			expr: "$A > 10 ? $A : $B",
+			vars: mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{series(nil, 5, 15, 25)}},
+				"B": mathexp.Results{Values: mathexp.Values{series(nil, -1, -2, -3)}},
+			},
+			expected: [][]float64{{-1, 15, 25}},
+		},
+		{
+			name: "series and numbers are matched by labels",
+			expr: "$A > $B ? 1 : $B",
+			vars: mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{
+					series(data.Labels{"host": "a"}, 5, 15),
+					series(data.Labels{"host": "b"}, 5, 15),
+				}},
+				"B": mathexp.Results{Values: mathexp.Values{
+					number(data.Labels{"host": "a"}, 10),
+					number(data.Labels{"host": "b"}, 20),
+				}},
+			},
+			expected: [][]float64{{10, 1}, {20, 20}},
+		},
+		{
+			name: "precedence is lower than comparison and arithmetic",
+			expr: "$A + 1 > 10 ? $A * 2 : 0 - 1",
+			vars: mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{series(nil, 9, 10)}},
+			},
+			expected: [][]float64{{-1, 20}},
+		},
+		{
+			name: "nested conditionals",
+			expr: "$A > 10 ? 2 : $A > 5 ? 1 : 0",
+			vars: mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{series(nil, 1, 6, 11)}},
+			},
+			expected: [][]float64{{0, 1, 2}},
+		},
+		{
+			name: "NaN condition is NaN",
+			expr: "$A ? 1 : 0",
+			vars: mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{series(nil, math.NaN(), 0, 3)}},
+			},
+			expected: [][]float64{{math.NaN(), 0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := NewMathCommand("C", tt.expr, mathexp.DivByZeroDefault)
+			require.NoError(t, err)
+
+			res, err := cmd.Execute(context.Background(), time.Now(), tt.vars)
+			require.NoError(t, err)
+			require.Len(t, res.Values, len(tt.expected))
+			for i, expected := range tt.expected {
+				actual := values(res.Values[i])
+				require.Len(t, actual, len(expected))
+				for j, f := range expected {
+					require.NotNil(t, actual[j])
+					if math.IsNaN(f) {
+						require.True(t, math.IsNaN(*actual[j]), "expected NaN at %d, got %v", j, *actual[j])
+						continue
+					}
+					require.Equal(t, f, *actual[j])
+				}
+			}
+		})
+	}
+
+	t.Run("should fail on incomplete conditional", func(t *testing.T) {
+		_, err := NewMathCommand("C", "$A > 10 ? 1", mathexp.DivByZeroDefault)
+		require.Error(t, err)
+	})
+}
+
+func TestMathCommand_Clamp(t *testing.T) {
+	// The values are below 0, within [0, 100], above 100, and NaN.
+	input := []float64{-5, 42, 150, math.NaN()}
+	series := mathexp.NewSeries("A", data.Labels{"host": "a"}, len(input))
+	for i, v := range input {
+		v := v
+		series.SetPoint(i, time.Unix(int64(i), 0), &v)
+	}
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{series}}}
+
+	tests := []struct {
+		expr     string
+		expected []float64
+	}{
+		{expr: "clamp($A, 0, 100)", expected: []float64{0, 42, 100, math.NaN()}},
+		{expr: "clamp_min($A, 0)", expected: []float64{0, 42, 150, math.NaN()}},
+		{expr: "clamp_max($A, 100)", expected: []float64{-5, 42, 100, math.NaN()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cmd, err := NewMathCommand("B", tt.expr, mathexp.DivByZeroDefault)
+			require.NoError(t, err)
+			res, err := cmd.Execute(context.Background(), time.Now(), vars)
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+
+			s, ok := res.Values[0].(mathexp.Series)
+			require.True(t, ok)
+			require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+			require.Equal(t, len(tt.expected), s.Len())
+			for i, e := range tt.expected {
+				_, f := s.GetPoint(i)
+				require.NotNil(t, f)
+				if math.IsNaN(e) {
+					require.True(t, math.IsNaN(*f), "point %d", i)
+					continue
+				}
+				require.Equal(t, e, *f, "point %d", i)
+			}
+		})
+	}
+
+	t.Run("should clamp numbers", func(t *testing.T) {
+		cmd, err := NewMathCommand("B", "clamp($A, 0, 100)", mathexp.DivByZeroDefault)
+		require.NoError(t, err)
+		n := mathexp.NewNumber("A", nil)
+		n.SetValue(ptr.Float64(-1))
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{n}}})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, ptr.Float64(0), res.Values[0].(mathexp.Number).GetFloat64Value())
+	})
+
+	t.Run("should fail when min is greater than max", func(t *testing.T) {
+		cmd, err := NewMathCommand("B", "clamp($A, 100, 0)", mathexp.DivByZeroDefault)
+		require.NoError(t, err)
+		_, err = cmd.Execute(context.Background(), time.Now(), vars)
+		require.Error(t, err)
+	})
+}
+
+func TestResampleCommand_TimeShift(t *testing.T) {
+	from := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	tr := AbsoluteTimeRange{From: from, To: from.Add(3 * time.Minute)}
+	week := 7 * 24 * time.Hour
+
+	cmd, err := UnmarshalResampleCommand(&rawNode{
+		RefID: "B",
+		Query: map[string]interface{}{
+			"expression":  "A",
+			"window":      "1m",
+			"timeShift":   "-7d",
+			"downsampler": "sum",
+			"upsampler":   "fillna",
+		},
+		TimeRange: tr,
+	})
+	require.NoError(t, err)
+	require.Equal(t, -week, cmd.TimeShift)
+	require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+	// the points are a week ahead of the time range until they are shifted
+	series := mathexp.NewSeries("A", data.Labels{"host": "a"}, 3)
+	series.SetPoint(0, from.Add(week+30*time.Second), ptr.Float64(1))
+	series.SetPoint(1, from.Add(week+90*time.Second), ptr.Float64(2))
+	series.SetPoint(2, from.Add(week+105*time.Second), ptr.Float64(4))
+
+	res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{series}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Values, 1)
+
+	resampled := res.Values[0].(mathexp.Series)
+	require.Equal(t, data.Labels{"host": "a"}, resampled.GetLabels())
+	expected := []*float64{nil, ptr.Float64(1), ptr.Float64(6), nil}
+	require.Equal(t, len(expected), resampled.Len())
+	for i, f := range expected {
+		ts, v := resampled.GetPoint(i)
+		require.Equal(t, from.Add(time.Duration(i)*time.Minute), ts)
+		require.Equal(t, f, v, "point %d", i)
+	}
+
+	// the input series is not modified
+	ts, _ := series.GetPoint(0)
+	require.Equal(t, from.Add(week+30*time.Second), ts)
+
+	t.Run("should fail on invalid timeShift", func(t *testing.T) {
+		_, err := UnmarshalResampleCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression":  "A",
+				"window":      "1m",
+				"timeShift":   "last week",
+				"downsampler": "sum",
+				"upsampler":   "fillna",
+			},
+			TimeRange: tr,
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestResampleCommand_AlignTo(t *testing.T) {
+	type point struct {
+		time  time.Time
+		value *float64
+	}
+	resample := func(t *testing.T, query map[string]interface{}, tr TimeRange, points ...point) []point {
+		t.Helper()
+		query["expression"] = "A"
+		query["downsampler"] = "sum"
+		query["upsampler"] = "fillna"
+		cmd, err := UnmarshalResampleCommand(&rawNode{RefID: "B", Query: query, TimeRange: tr})
+		require.NoError(t, err)
+
+		series := mathexp.NewSeries("A", nil, len(points))
+		for i, p := range points {
+			series.SetPoint(i, p.time, p.value)
+		}
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{series}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		resampled := res.Values[0].(mathexp.Series)
+		actual := make([]point, 0, resampled.Len())
+		for i := 0; i < resampled.Len(); i++ {
+			ts, v := resampled.GetPoint(i)
+			actual = append(actual, point{ts, v})
+		}
+		return actual
+	}
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	t.Run("hours in a timezone with a half-hour offset", func(t *testing.T) {
+		// Asia/Kolkata is UTC+5:30, so its hours start on the half hour in UTC.
+		actual := resample(t,
+			map[string]interface{}{"window": "1h", "alignTo": "hour", "timezone": "Asia/Kolkata"},
+			AbsoluteTimeRange{From: at(2023, 1, 2, 10, 17), To: at(2023, 1, 2, 13, 0)},
+			point{at(2023, 1, 2, 10, 20), ptr.Float64(1)},
+			point{at(2023, 1, 2, 10, 40), ptr.Float64(2)},
+			point{at(2023, 1, 2, 11, 0), ptr.Float64(4)},
+			point{at(2023, 1, 2, 12, 10), ptr.Float64(8)},
+		)
+		require.Equal(t, []point{
+			{at(2023, 1, 2, 9, 30), nil},
+			{at(2023, 1, 2, 10, 30), ptr.Float64(1)},
+			{at(2023, 1, 2, 11, 30), ptr.Float64(6)},
+			{at(2023, 1, 2, 12, 30), ptr.Float64(8)},
+		}, actual)
+	})
+
+	t.Run("days across a DST transition", func(t *testing.T) {
+		// Europe/Berlin moves from UTC+1 to UTC+2 on 2023-03-26, so that day lasts 23 hours.
+		actual := resample(t,
+			map[string]interface{}{"window": "1d", "alignTo": "day", "timezone": "Europe/Berlin"},
+			AbsoluteTimeRange{From: at(2023, 3, 24, 12, 0), To: at(2023, 3, 28, 0, 0)},
+			point{at(2023, 3, 24, 12, 0), ptr.Float64(1)},
+			point{at(2023, 3, 25, 23, 30), ptr.Float64(2)},
+			point{at(2023, 3, 26, 22, 0), ptr.Float64(4)},
+			point{at(2023, 3, 26, 22, 30), ptr.Float64(8)},
+		)
+		require.Equal(t, []point{
+			{at(2023, 3, 23, 23, 0), nil},
+			{at(2023, 3, 24, 23, 0), ptr.Float64(1)},
+			{at(2023, 3, 25, 23, 0), nil},
+			{at(2023, 3, 26, 22, 0), ptr.Float64(6)},
+			{at(2023, 3, 27, 22, 0), ptr.Float64(8)},
+		}, actual)
+	})
+
+	t.Run("should fail on a window that is not a whole number of units", func(t *testing.T) {
+		_, err := UnmarshalResampleCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "A", "window": "90m", "alignTo": "hour", "downsampler": "sum", "upsampler": "fillna",
+			},
+			TimeRange: AbsoluteTimeRange{From: at(2023, 1, 2, 0, 0), To: at(2023, 1, 3, 0, 0)},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("should fail on an unknown timezone", func(t *testing.T) {
+		_, err := UnmarshalResampleCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "A", "window": "1d", "alignTo": "day", "timezone": "Mars/Olympus_Mons", "downsampler": "sum", "upsampler": "fillna",
+			},
+			TimeRange: AbsoluteTimeRange{From: at(2023, 1, 2, 0, 0), To: at(2023, 1, 3, 0, 0)},
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,92 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// CumulativeCommand is an expression command that turns each series into its running total:
+// the value of each point is the sum of the values of the series up to and including it.
+type CumulativeCommand struct {
+	VarToSum string
+	refID    string
+}
+
+// NewCumulativeCommand creates a new CumulativeCommand.
+func NewCumulativeCommand(refID, varToSum string) *CumulativeCommand {
+	return &CumulativeCommand{
+		VarToSum: varToSum,
+		refID:    refID,
+	}
+}
+
+// UnmarshalCumulativeCommand creates a CumulativeCommand from Grafana's frontend query.
+func UnmarshalCumulativeCommand(rn *rawNode) (*CumulativeCommand, error) {
+	refID, err := rn.outputRefID(TypeCumulative)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToSum, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	return NewCumulativeCommand(refID, strings.TrimPrefix(varToSum, "$")), nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (cc *CumulativeCommand) NeedsVars() []string {
+	return []string{cc.VarToSum}
+}
+
+// RefID returns the refID that names the results of the command.
+func (cc *CumulativeCommand) RefID() string {
+	return cc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (cc *CumulativeCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[cc.VarToSum].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			newRes.Values = append(newRes.Values, cc.cumulate(v))
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: cc.refID, Input: cc.VarToSum, Command: TypeCumulative, Expected: parse.TypeSeriesSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// cumulate returns the running total of s, whose points must be sorted by time. Null and
+// NaN values are skipped: their points keep their time and carry the total forward, which
+// is 0 before the first value.
+func (cc *CumulativeCommand) cumulate(s mathexp.Series) mathexp.Series {
+	res := mathexp.NewSeries(cc.refID, s.GetLabels().Copy(), s.Len())
+	var total float64
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if f != nil && !math.IsNaN(*f) {
+			total += *f
+		}
+		sum := total
+		res.SetPoint(i, t, &sum)
+	}
+	return res
+}
@@ -0,0 +1,51 @@
+package expr
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestCumulativeCommand(t *testing.T) {
+	input := mathexp.NewSeries("A", data.Labels{"team": "a"}, 0)
+	for i, v := range []*float64{nil, ptr.Float64(3), ptr.Float64(1), ptr.Float64(math.NaN()), ptr.Float64(-2), nil, ptr.Float64(5)} {
+		input.AppendPoint(time.Unix(int64(i*60), 0), v)
+	}
+
+	cmd, err := UnmarshalCumulativeCommand(&rawNode{RefID: "B", Query: map[string]interface{}{"expression": "$A"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+	res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{input}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Values, 1)
+	s, ok := res.Values[0].(mathexp.Series)
+	require.True(t, ok)
+	require.Equal(t, "B", s.GetName())
+	require.Equal(t, data.Labels{"team": "a"}, s.GetLabels())
+
+	// The NaN and null points carry the running total forward.
+	expected := []float64{0, 3, 4, 4, 2, 2, 7}
+	require.Equal(t, len(expected), s.Len())
+	for i, f := range expected {
+		pt, v := s.GetPoint(i)
+		require.Equal(t, time.Unix(int64(i*60), 0).UTC(), pt.UTC())
+		require.Equal(t, ptr.Float64(f), v)
+	}
+
+	t.Run("should fail on numbers", func(t *testing.T) {
+		_, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{mathexp.NewNumber("A", nil)}},
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,78 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// ErrMissingRefID is returned when a command is created from a node that has no refID.
+type ErrMissingRefID struct {
+	Command CommandType
+}
+
+func (e ErrMissingRefID) Error() string {
+	return fmt.Sprintf("%s expression is missing a refId", e.Command)
+}
+
+// ErrMissingField is returned when a field required by a command is missing from its query.
+type ErrMissingField struct {
+	RefID string
+	Field string
+}
+
+func (e ErrMissingField) Error() string {
+	return fmt.Sprintf("field %q is missing in expression '%s'", e.Field, e.RefID)
+}
+
+// ErrInvalidInputType is returned when a field of a command's query has an unexpected type.
+type ErrInvalidInputType struct {
+	RefID    string
+	Field    string
+	Expected string
+	// Actual is the Go type of the field's value.
+	Actual string
+}
+
+func newErrInvalidInputType(refID, field, expected string, actual interface{}) ErrInvalidInputType {
+	return ErrInvalidInputType{
+		RefID:    refID,
+		Field:    field,
+		Expected: expected,
+		Actual:   fmt.Sprintf("%T", actual),
+	}
+}
+
+func (e ErrInvalidInputType) Error() string {
+	return fmt.Sprintf("field %q in expression '%s' is expected to be %s, got %s", e.Field, e.RefID, e.Expected, e.Actual)
+}
+
+// ErrInputTypeMismatch is returned when a command is executed on an input value of a type it doesn't support.
+type ErrInputTypeMismatch struct {
+	RefID string
+	// Input is the refID of the query or expression the value comes from.
+	Input    string
+	Command  CommandType
+	Expected parse.ReturnType
+	Actual   parse.ReturnType
+}
+
+func (e ErrInputTypeMismatch) Error() string {
+	return fmt.Sprintf("%s expression '%s' can only take input of type %v, got type %v from '%s'", e.Command, e.RefID, e.Expected, e.Actual, e.Input)
+}
+
+// PartialResultsError is returned, along with the results computed so far, by a command that
+// was canceled before it was done, see ReduceCommand.PartialResults.
+type PartialResultsError struct {
+	RefID string
+	// Err is the error of the context of the command.
+	Err error
+}
+
+func (e PartialResultsError) Error() string {
+	return fmt.Sprintf("expression '%s' returned partial results: %s", e.RefID, e.Err)
+}
+
+func (e PartialResultsError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,206 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+const (
+	// FillZero fills gaps with 0.
+	FillZero = "zero"
+	// FillNull fills gaps with null values.
+	FillNull = "null"
+	// FillPrevious fills gaps with the value of the previous point.
+	FillPrevious = "previous"
+	// FillLinear fills gaps by linear interpolation between the points around them.
+	FillLinear = "linear"
+)
+
+var supportedFillModes = []string{FillZero, FillNull, FillPrevious, FillLinear}
+
+// FillCommand is an expression command that makes series regularly spaced by adding a
+// point every Step over the time range where there is none, with a value set by Mode.
+// Unlike resample, it never aggregates points.
+type FillCommand struct {
+	VarToFill string
+	Mode      string
+	// Step is the interval between the points of the result. When zero, it is the
+	// smallest interval between two points of each series.
+	Step      time.Duration
+	TimeRange TimeRange
+	refID     string
+}
+
+// NewFillCommand creates a new FillCommand.
+func NewFillCommand(refID, varToFill, mode string, step time.Duration, tr TimeRange) (*FillCommand, error) {
+	if !isSupported(mode, supportedFillModes) {
+		return nil, fmt.Errorf("fill mode %q is not supported. Supported: %v", mode, supportedFillModes)
+	}
+	if step < 0 {
+		return nil, fmt.Errorf("fill step must not be negative, got %v", step)
+	}
+	return &FillCommand{
+		VarToFill: varToFill,
+		Mode:      mode,
+		Step:      step,
+		TimeRange: tr,
+		refID:     refID,
+	}, nil
+}
+
+// UnmarshalFillCommand creates a FillCommand from Grafana's frontend query.
+func UnmarshalFillCommand(rn *rawNode) (*FillCommand, error) {
+	refID, err := rn.outputRefID(TypeFill)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToFill, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToFill = strings.TrimPrefix(varToFill, "$")
+
+	rawMode, ok := rn.Query["mode"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "mode"}
+	}
+	mode, ok := rawMode.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "mode", "a string", rawMode)
+	}
+
+	var step time.Duration
+	if rawStep, ok := rn.Query["step"]; ok {
+		s, ok := rawStep.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "step", "a string", rawStep)
+		}
+		var err error
+		step, err = gtime.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse fill "step" duration field %q: %w`, s, err)
+		}
+	}
+
+	return NewFillCommand(refID, varToFill, mode, step, rn.TimeRange)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (fc *FillCommand) NeedsVars() []string {
+	return []string{fc.VarToFill}
+}
+
+// RefID returns the refID that names the results of the command.
+func (fc *FillCommand) RefID() string {
+	return fc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (fc *FillCommand) Execute(_ context.Context, now time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	var from, to time.Time
+	if fc.TimeRange != nil {
+		tr := fc.TimeRange.AbsoluteTime(now)
+		from, to = tr.From, tr.To
+	}
+	for _, val := range vars[fc.VarToFill].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			newRes.Values = append(newRes.Values, fc.fill(v, from, to))
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: fc.refID, Input: fc.VarToFill, Command: TypeFill, Expected: parse.TypeSeriesSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// fill returns s with a point every step, whose points must be sorted by time. The points
+// are aligned on the first point of s and cover [from, to], or only the time between the
+// first and last points of s if from and to are zero. Points of s that are not aligned
+// are only used to fill the gaps around them. If s has fewer than two points and Step is
+// zero, a copy of s is returned since its step can't be inferred.
+func (fc *FillCommand) fill(s mathexp.Series, from, to time.Time) mathexp.Series {
+	if s.Len() == 0 {
+		return renameSeries(s, fc.refID)
+	}
+	step := fc.Step
+	if step == 0 {
+		for i := 1; i < s.Len(); i++ {
+			if d := s.GetTime(i).Sub(s.GetTime(i - 1)); d > 0 && (step == 0 || d < step) {
+				step = d
+			}
+		}
+		if step == 0 {
+			return renameSeries(s, fc.refID)
+		}
+	}
+
+	first, last := s.GetTime(0), s.GetTime(s.Len()-1)
+	start, end := first, last
+	if !from.IsZero() && from.Before(first) {
+		start = first.Add(-first.Sub(from) / step * step)
+	}
+	if !to.IsZero() && to.After(last) {
+		end = to
+	}
+
+	res := mathexp.NewSeries(fc.refID, s.GetLabels().Copy(), 0)
+	// next is the index of the first point of s at or after t.
+	next := 0
+	for t := start; !t.After(end); t = t.Add(step) {
+		for next < s.Len() && s.GetTime(next).Before(t) {
+			next++
+		}
+		if next < s.Len() && s.GetTime(next).Equal(t) {
+			res.AppendPoint(t, s.GetValue(next))
+			continue
+		}
+		res.AppendPoint(t, fc.gapValue(s, next, t))
+	}
+	return res
+}
+
+// gapValue returns the value of a point at t, where s has no point. next is the index
+// of the first point of s after t.
+func (fc *FillCommand) gapValue(s mathexp.Series, next int, t time.Time) *float64 {
+	switch fc.Mode {
+	case FillZero:
+		var f float64
+		return &f
+	case FillPrevious:
+		if next == 0 {
+			return nil
+		}
+		return s.GetValue(next - 1)
+	case FillLinear:
+		if next == 0 || next == s.Len() {
+			return nil
+		}
+		t0, f0 := s.GetPoint(next - 1)
+		t1, f1 := s.GetPoint(next)
+		if f0 == nil || f1 == nil {
+			return nil
+		}
+		f := *f0 + (*f1-*f0)*float64(t.Sub(t0))/float64(t1.Sub(t0))
+		return &f
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestFillCommand(t *testing.T) {
+	// The input has a point every minute, except at 120s.
+	input := mathexp.NewSeries("A", data.Labels{"host": "a"}, 0)
+	input.AppendPoint(time.Unix(0, 0), ptr.Float64(1))
+	input.AppendPoint(time.Unix(60, 0), ptr.Float64(2))
+	input.AppendPoint(time.Unix(180, 0), ptr.Float64(4))
+	input.AppendPoint(time.Unix(240, 0), ptr.Float64(5))
+
+	type point struct {
+		sec   int64
+		value *float64
+	}
+	tests := []struct {
+		name      string
+		query     map[string]interface{}
+		timeRange TimeRange
+		expected  []point
+	}{
+		{
+			name:     "zero",
+			query:    map[string]interface{}{"mode": "zero"},
+			expected: []point{{0, ptr.Float64(1)}, {60, ptr.Float64(2)}, {120, ptr.Float64(0)}, {180, ptr.Float64(4)}, {240, ptr.Float64(5)}},
+		},
+		{
+			name:     "null",
+			query:    map[string]interface{}{"mode": "null"},
+			expected: []point{{0, ptr.Float64(1)}, {60, ptr.Float64(2)}, {120, nil}, {180, ptr.Float64(4)}, {240, ptr.Float64(5)}},
+		},
+		{
+			name:     "previous",
+			query:    map[string]interface{}{"mode": "previous"},
+			expected: []point{{0, ptr.Float64(1)}, {60, ptr.Float64(2)}, {120, ptr.Float64(2)}, {180, ptr.Float64(4)}, {240, ptr.Float64(5)}},
+		},
+		{
+			name:     "linear",
+			query:    map[string]interface{}{"mode": "linear"},
+			expected: []point{{0, ptr.Float64(1)}, {60, ptr.Float64(2)}, {120, ptr.Float64(3)}, {180, ptr.Float64(4)}, {240, ptr.Float64(5)}},
+		},
+		{
+			name:  "linear with a smaller step",
+			query: map[string]interface{}{"mode": "linear", "step": "30s"},
+			expected: []point{
+				{0, ptr.Float64(1)}, {30, ptr.Float64(1.5)}, {60, ptr.Float64(2)}, {90, ptr.Float64(2.5)}, {120, ptr.Float64(3)},
+				{150, ptr.Float64(3.5)}, {180, ptr.Float64(4)}, {210, ptr.Float64(4.5)}, {240, ptr.Float64(5)},
+			},
+		},
+		{
+			name:      "previous over the time range",
+			query:     map[string]interface{}{"mode": "previous"},
+			timeRange: AbsoluteTimeRange{From: time.Unix(-150, 0), To: time.Unix(300, 0)},
+			expected: []point{
+				{-120, nil}, {-60, nil}, {0, ptr.Float64(1)}, {60, ptr.Float64(2)}, {120, ptr.Float64(2)},
+				{180, ptr.Float64(4)}, {240, ptr.Float64(5)}, {300, ptr.Float64(5)},
+			},
+		},
+		{
+			name:      "zero over the time range",
+			query:     map[string]interface{}{"mode": "zero"},
+			timeRange: AbsoluteTimeRange{From: time.Unix(-60, 0), To: time.Unix(270, 0)},
+			expected: []point{
+				{-60, ptr.Float64(0)}, {0, ptr.Float64(1)}, {60, ptr.Float64(2)}, {120, ptr.Float64(0)},
+				{180, ptr.Float64(4)}, {240, ptr.Float64(5)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query["expression"] = "$A"
+			cmd, err := UnmarshalFillCommand(&rawNode{RefID: "B", Query: tt.query, TimeRange: tt.timeRange})
+			require.NoError(t, err)
+			require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+			res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{input}},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+			s, ok := res.Values[0].(mathexp.Series)
+			require.True(t, ok)
+			require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+
+			actual := make([]point, 0, s.Len())
+			for i := 0; i < s.Len(); i++ {
+				pt, f := s.GetPoint(i)
+				actual = append(actual, point{pt.Unix(), f})
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("should fail on an unknown mode", func(t *testing.T) {
+		_, err := UnmarshalFillCommand(&rawNode{RefID: "B", Query: map[string]interface{}{"expression": "$A", "mode": "spline"}})
+		require.Error(t, err)
+	})
+}
@@ -3,7 +3,9 @@ package expr
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"gonum.org/v1/gonum/graph/simple"
@@ -80,6 +82,15 @@ func (s *Service) buildPipeline(req *Request) (DataPipeline, error) {
 	return nodes, nil
 }
 
+// ValidatePipeline runs the static checks of building a pipeline from a request without
+// executing it: every command is parsed, every variable a command needs must be the refId of
+// another query or expression in the request, and the dependencies must not form a cycle.
+// The first problem found is returned and names the refId it was found in.
+func (s *Service) ValidatePipeline(req *Request) error {
+	_, err := s.buildPipeline(req)
+	return err
+}
+
 // buildDependencyGraph returns a dependency graph for a set of queries.
 func (s *Service) buildDependencyGraph(req *Request) (*simple.DirectedGraph, error) {
 	graph, err := s.buildGraph(req)
@@ -100,6 +111,15 @@ func (s *Service) buildDependencyGraph(req *Request) (*simple.DirectedGraph, err
 func buildExecutionOrder(graph *simple.DirectedGraph) ([]Node, error) {
 	sortedNodes, err := topo.Sort(graph)
 	if err != nil {
+		var cycles topo.Unorderable
+		if errors.As(err, &cycles) && len(cycles) > 0 {
+			refIDs := make([]string, 0, len(cycles[0]))
+			for _, n := range cycles[0] {
+				refIDs = append(refIDs, n.(Node).RefID())
+			}
+			sort.Strings(refIDs)
+			return nil, fmt.Errorf("expressions %v depend on each other: %w", refIDs, err)
+		}
 		return nil, err
 	}
 
@@ -172,6 +192,18 @@ func (s *Service) buildGraph(req *Request) (*simple.DirectedGraph, error) {
 	return dp, nil
 }
 
+// otherRefIDs returns the sorted refIds in the registry except refID.
+func otherRefIDs(registry map[string]Node, refID string) []string {
+	refIDs := make([]string, 0, len(registry))
+	for id := range registry {
+		if id != refID {
+			refIDs = append(refIDs, id)
+		}
+	}
+	sort.Strings(refIDs)
+	return refIDs
+}
+
 // buildGraphEdges generates graph edges based on each node's dependencies.
 func buildGraphEdges(dp *simple.DirectedGraph, registry map[string]Node) error {
 	nodeIt := dp.Nodes()
@@ -190,7 +222,7 @@ func buildGraphEdges(dp *simple.DirectedGraph, registry map[string]Node) error {
 		for _, neededVar := range cmdNode.Command.NeedsVars() {
 			neededNode, ok := registry[neededVar]
 			if !ok {
-				return fmt.Errorf("unable to find dependent node '%v'", neededVar)
+				return fmt.Errorf("unable to find dependent node '%v' of expression '%v': must be one of the refIds %v", neededVar, cmdNode.RefID(), otherRefIDs(registry, cmdNode.RefID()))
 			}
 
 			if neededNode.ID() == cmdNode.ID() {
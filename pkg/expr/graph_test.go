@@ -246,6 +246,110 @@ func TestServicebuildPipeLine(t *testing.T) {
 	}
 }
 
+func TestServiceValidatePipeline(t *testing.T) {
+	dsQuery := Query{
+		RefID: "A",
+		DataSource: &datasources.DataSource{
+			UID: "Fake",
+		},
+		TimeRange: AbsoluteTimeRange{},
+	}
+	expression := func(refID, model string) Query {
+		return Query{
+			RefID:      refID,
+			DataSource: DataSourceModel(),
+			TimeRange:  AbsoluteTimeRange{},
+			JSON:       json.RawMessage(model),
+		}
+	}
+
+	var tests = []struct {
+		name              string
+		queries           []Query
+		expectErrContains string
+	}{
+		{
+			name: "valid graph",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "resample", "expression": "A", "window": "1m", "downsampler": "mean", "upsampler": "pad"}`),
+				expression("C", `{"type": "reduce", "expression": "B", "reducer": "last"}`),
+				expression("D", `{"type": "math", "expression": "$C > 5"}`),
+			},
+		},
+		{
+			name: "missing var",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "math", "expression": "$A + $X"}`),
+			},
+			expectErrContains: "unable to find dependent node 'X' of expression 'B'",
+		},
+		{
+			name: "math variables resolve to refIds",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "reduce", "expression": "A", "reducer": "last"}`),
+				expression("C", `{"type": "math", "expression": "$A + ${B} * 2"}`),
+			},
+		},
+		{
+			name: "math variable typo names the bad variable and the refIds",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "reduce", "expression": "A", "reducer": "last"}`),
+				expression("C", `{"type": "math", "expression": "$A + $AA"}`),
+			},
+			expectErrContains: "unable to find dependent node 'AA' of expression 'C': must be one of the refIds [A B]",
+		},
+		{
+			name: "cycle",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "math", "expression": "$A + $C"}`),
+				expression("C", `{"type": "math", "expression": "$B * 2"}`),
+			},
+			expectErrContains: "expressions [B C] depend on each other",
+		},
+		{
+			name: "unknown reducer",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "reduce", "expression": "A", "reducer": "median"}`),
+			},
+			expectErrContains: "failed to parse expression 'B': reduction median not implemented",
+		},
+		{
+			name: "unknown downsampler",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "resample", "expression": "A", "window": "1m", "downsampler": "median", "upsampler": "pad"}`),
+			},
+			expectErrContains: "failed to parse expression 'B': downsampler \"median\" is not supported",
+		},
+		{
+			name: "unknown upsampler",
+			queries: []Query{
+				dsQuery,
+				expression("B", `{"type": "resample", "expression": "A", "window": "1m", "downsampler": "mean", "upsampler": "linear"}`),
+			},
+			expectErrContains: "failed to parse expression 'B': upsampler \"linear\" is not supported",
+		},
+	}
+	s := Service{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidatePipeline(&Request{Queries: tt.queries})
+			if tt.expectErrContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.expectErrContains)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
 func getRefIDOrder(nodes []Node) []string {
 	ids := make([]string, 0, len(nodes))
 	for _, n := range nodes {
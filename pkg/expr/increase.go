@@ -0,0 +1,99 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// IncreaseCommand is an expression command that reduces each counter series to its total
+// increase. Like in Prometheus, a decrease between two points is a counter reset and the
+// value after the reset is added to the increase.
+type IncreaseCommand struct {
+	VarToIncrease string
+	refID         string
+}
+
+// NewIncreaseCommand creates a new IncreaseCommand.
+func NewIncreaseCommand(refID, varToIncrease string) *IncreaseCommand {
+	return &IncreaseCommand{
+		VarToIncrease: varToIncrease,
+		refID:         refID,
+	}
+}
+
+// UnmarshalIncreaseCommand creates an IncreaseCommand from Grafana's frontend query.
+func UnmarshalIncreaseCommand(rn *rawNode) (*IncreaseCommand, error) {
+	refID, err := rn.outputRefID(TypeIncrease)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToIncrease, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	return NewIncreaseCommand(refID, strings.TrimPrefix(varToIncrease, "$")), nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (ic *IncreaseCommand) NeedsVars() []string {
+	return []string{ic.VarToIncrease}
+}
+
+// RefID returns the refID that names the results of the command.
+func (ic *IncreaseCommand) RefID() string {
+	return ic.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (ic *IncreaseCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[ic.VarToIncrease].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			n := mathexp.NewNumber(ic.refID, v.GetLabels().Copy())
+			n.SetValue(increase(v))
+			newRes.Values = append(newRes.Values, n)
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: ic.refID, Input: ic.VarToIncrease, Command: TypeIncrease, Expected: parse.TypeSeriesSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// increase returns the total increase of the counter s, whose points must be sorted by time.
+// Null and NaN values are skipped. It is NaN when s has no values, since there is nothing to
+// compute an increase from, and 0 when it has a single value.
+func increase(s mathexp.Series) *float64 {
+	total := math.NaN()
+	var prev float64
+	for i := 0; i < s.Len(); i++ {
+		f := s.GetValue(i)
+		if f == nil || math.IsNaN(*f) {
+			continue
+		}
+		if math.IsNaN(total) {
+			total = 0
+		} else {
+			total += counterIncrease(prev, *f)
+		}
+		prev = *f
+	}
+	return &total
+}
@@ -0,0 +1,80 @@
+package expr
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestIncreaseCommand(t *testing.T) {
+	counter := func(values ...*float64) mathexp.Series {
+		s := mathexp.NewSeries("A", data.Labels{"job": "api"}, len(values))
+		for i, v := range values {
+			s.SetPoint(i, time.Unix(int64(i*10), 0), v)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		input    mathexp.Series
+		expected float64
+	}{
+		{
+			name:     "clean increase",
+			input:    counter(ptr.Float64(3), ptr.Float64(10), ptr.Float64(30)),
+			expected: 27,
+		},
+		{
+			name:     "increase crossing a reset",
+			input:    counter(ptr.Float64(10), ptr.Float64(20), ptr.Float64(5), ptr.Float64(15)),
+			expected: 25,
+		},
+		{
+			name:     "null values are skipped",
+			input:    counter(ptr.Float64(10), nil, ptr.Float64(20)),
+			expected: 10,
+		},
+		{
+			name:     "single value",
+			input:    counter(ptr.Float64(10)),
+			expected: 0,
+		},
+		{
+			name:     "no values",
+			input:    counter(nil),
+			expected: math.NaN(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := UnmarshalIncreaseCommand(&rawNode{RefID: "B", Query: map[string]interface{}{"expression": "$A"}})
+			require.NoError(t, err)
+			require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+			res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{tt.input}},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+			n, ok := res.Values[0].(mathexp.Number)
+			require.True(t, ok)
+			require.Equal(t, data.Labels{"job": "api"}, n.GetLabels())
+			f := n.GetFloat64Value()
+			require.NotNil(t, f)
+			if math.IsNaN(tt.expected) {
+				require.True(t, math.IsNaN(*f))
+				return
+			}
+			require.Equal(t, tt.expected, *f)
+		})
+	}
+}
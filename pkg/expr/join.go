@@ -0,0 +1,143 @@
+package expr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+const (
+	// JoinInner keeps only the values whose labels are present in every input.
+	JoinInner = "inner"
+	// JoinOuter keeps all the values of all inputs.
+	JoinOuter = "outer"
+)
+
+// JoinCommand is an expression command that combines the values of several inputs into one result.
+// Unlike the values of other commands, its values keep the names of their inputs, so that the
+// values of different inputs with the same labels can be told apart. Hence it doesn't support
+// "outputRefId".
+type JoinCommand struct {
+	VarsToJoin []string
+	JoinType   string
+	refID      string
+}
+
+// NewJoinCommand creates a new JoinCommand.
+func NewJoinCommand(refID string, varsToJoin []string, joinType string) (*JoinCommand, error) {
+	if len(varsToJoin) == 0 {
+		return nil, errors.New("no expressions to join")
+	}
+	if joinType != JoinInner && joinType != JoinOuter {
+		return nil, fmt.Errorf("join type '%v' is not supported. Supported: [%v,%v]", joinType, JoinInner, JoinOuter)
+	}
+	return &JoinCommand{
+		VarsToJoin: varsToJoin,
+		JoinType:   joinType,
+		refID:      refID,
+	}, nil
+}
+
+// UnmarshalJoinCommand creates a JoinCommand from Grafana's frontend query.
+func UnmarshalJoinCommand(rn *rawNode) (*JoinCommand, error) {
+	refID, err := rn.outputRefID(TypeJoin)
+	if err != nil {
+		return nil, err
+	}
+	rawExpressions, ok := rn.Query["expressions"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be references to existing queries or expressions", ErrMissingField{RefID: rn.RefID, Field: "expressions"})
+	}
+	jsonExpressions, err := json.Marshal(rawExpressions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remarshal join expressions: %w", err)
+	}
+	var expressions []string
+	if err := json.Unmarshal(jsonExpressions, &expressions); err != nil {
+		return nil, newErrInvalidInputType(rn.RefID, "expressions", "an array of strings", rawExpressions)
+	}
+	varsToJoin := make([]string, 0, len(expressions))
+	for _, expression := range expressions {
+		varsToJoin = append(varsToJoin, strings.TrimPrefix(expression, "$"))
+	}
+
+	joinType := JoinOuter
+	if rawJoinType, ok := rn.Query["joinType"]; ok {
+		joinType, ok = rawJoinType.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "joinType", "a string", rawJoinType)
+		}
+	}
+
+	return NewJoinCommand(refID, varsToJoin, joinType)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (jc *JoinCommand) NeedsVars() []string {
+	return jc.VarsToJoin
+}
+
+// RefID returns the refID that names the results of the command.
+func (jc *JoinCommand) RefID() string {
+	return jc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. The values of the inputs are returned in the order of the inputs.
+// NoData values are dropped, and NoData is returned if no other value is left.
+func (jc *JoinCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	inputs := make([]mathexp.Results, 0, len(jc.VarsToJoin))
+	noData := false
+	for _, name := range jc.VarsToJoin {
+		input := mathexp.Results{}
+		for _, val := range vars[name].Values {
+			switch val.(type) {
+			case nil:
+				continue
+			case mathexp.NoData:
+				noData = true
+				continue
+			}
+			input.Values = append(input.Values, val)
+		}
+		inputs = append(inputs, input)
+	}
+
+	joined := inputs
+	if jc.JoinType == JoinInner {
+		joined = make([]mathexp.Results, len(inputs))
+		for i, input := range inputs {
+			for _, val := range input.Values {
+				if inAllResults(val, inputs) {
+					joined[i].Values = append(joined[i].Values, val)
+				}
+			}
+		}
+	}
+
+	res := mathexp.Results{Values: mathexp.Values{}}.Merge(joined...)
+	if len(res.Values) == 0 && noData {
+		res.Values = append(res.Values, mathexp.NewNoData())
+	}
+	return res, nil
+}
+
+// inAllResults returns true if each of results has a value with the same labels as val.
+func inAllResults(val mathexp.Value, results []mathexp.Results) bool {
+RESULTS:
+	for _, res := range results {
+		for _, v := range res.Values {
+			if v.GetLabels().Equals(val.GetLabels()) {
+				continue RESULTS
+			}
+		}
+		return false
+	}
+	return true
+}
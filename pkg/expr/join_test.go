@@ -0,0 +1,93 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestJoinCommand(t *testing.T) {
+	series := func(refID string, labels data.Labels) mathexp.Series {
+		s := mathexp.NewSeries(refID, labels, 1)
+		s.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+		return s
+	}
+	aHostA := series("A", data.Labels{"host": "a"})
+	aHostB := series("A", data.Labels{"host": "b"})
+	bHostA := series("B", data.Labels{"host": "a"})
+	bHostC := series("B", data.Labels{"host": "c"})
+	vars := mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{aHostA, aHostB}},
+		"B": mathexp.Results{Values: mathexp.Values{bHostA, bHostC}},
+	}
+
+	unmarshal := func(t *testing.T, query map[string]interface{}) *JoinCommand {
+		t.Helper()
+		cmd, err := UnmarshalJoinCommand(&rawNode{RefID: "C", Query: query})
+		require.NoError(t, err)
+		return cmd
+	}
+
+	t.Run("inner join drops unmatched series", func(t *testing.T) {
+		cmd := unmarshal(t, map[string]interface{}{
+			"expressions": []interface{}{"$A", "B"},
+			"joinType":    "inner",
+		})
+		require.Equal(t, []string{"A", "B"}, cmd.NeedsVars())
+
+		res, err := cmd.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Equal(t, mathexp.Values{aHostA, bHostA}, res.Values)
+	})
+
+	t.Run("outer join keeps everything", func(t *testing.T) {
+		cmd := unmarshal(t, map[string]interface{}{
+			"expressions": []interface{}{"A", "B"},
+			"joinType":    "outer",
+		})
+
+		res, err := cmd.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Equal(t, mathexp.Values{aHostA, aHostB, bHostA, bHostC}, res.Values)
+	})
+
+	t.Run("join type defaults to outer", func(t *testing.T) {
+		cmd := unmarshal(t, map[string]interface{}{
+			"expressions": []interface{}{"A", "B"},
+		})
+		require.Equal(t, JoinOuter, cmd.JoinType)
+	})
+
+	t.Run("inner join of NoData returns NoData", func(t *testing.T) {
+		cmd := unmarshal(t, map[string]interface{}{
+			"expressions": []interface{}{"A", "D"},
+			"joinType":    "inner",
+		})
+
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": vars["A"],
+			"D": mathexp.Results{Values: mathexp.Values{mathexp.NewNoData()}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, mathexp.NewNoData().Type(), res.Values[0].Type())
+	})
+
+	t.Run("should fail on invalid query", func(t *testing.T) {
+		for name, query := range map[string]map[string]interface{}{
+			"missing expressions": {"joinType": "inner"},
+			"empty expressions":   {"expressions": []interface{}{}},
+			"non string":          {"expressions": []interface{}{1}},
+			"unknown join type":   {"expressions": []interface{}{"A"}, "joinType": "left"},
+		} {
+			_, err := UnmarshalJoinCommand(&rawNode{RefID: "C", Query: query})
+			require.Error(t, err, name)
+		}
+	})
+}
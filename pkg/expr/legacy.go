@@ -0,0 +1,94 @@
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+// DataResponseToVars converts a legacy data response, such as the one of the Graphite
+// data source, to the variables expression commands take as input, keyed by refID.
+//
+// Legacy series become Series whose labels are the series' tags, with the points'
+// timestamps read as epoch milliseconds. Data frames are converted like the frames
+// of a data source query. A result without any value is NoData.
+func DataResponseToVars(resp legacydata.DataResponse) (mathexp.Vars, error) {
+	vars := make(mathexp.Vars, len(resp.Results))
+	for refID, result := range resp.Results {
+		if result.Error != nil {
+			return nil, QueryError{RefID: refID, Err: result.Error}
+		}
+
+		vals := make([]mathexp.Value, 0, len(result.Series))
+		for _, ts := range result.Series {
+			vals = append(vals, legacySeriesToSeries(refID, ts))
+		}
+
+		if result.Dataframes != nil {
+			frames, err := result.Dataframes.Decoded()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode data frames of query %s: %w", refID, err)
+			}
+			for _, frame := range frames {
+				if len(frame.Fields) == 0 {
+					continue
+				}
+				series, err := WideToMany(frame)
+				if err != nil {
+					return nil, err
+				}
+				for _, s := range series {
+					vals = append(vals, s)
+				}
+			}
+		}
+
+		if len(vals) == 0 {
+			vals = append(vals, mathexp.NoData{}.New())
+		}
+		vars[refID] = mathexp.Results{Values: vals}
+	}
+	return vars, nil
+}
+
+// legacySeriesToSeries converts ts to a Series named name, sorted by time. The name of ts
+// is kept as the display name of the Series.
+func legacySeriesToSeries(name string, ts legacydata.DataTimeSeries) mathexp.Series {
+	var labels data.Labels
+	if len(ts.Tags) > 0 {
+		labels = make(data.Labels, len(ts.Tags))
+		for k, v := range ts.Tags {
+			labels[k] = v
+		}
+	}
+
+	points := make(legacydata.DataTimeSeriesPoints, 0, len(ts.Points))
+	for _, p := range ts.Points {
+		// Points without a timestamp can't be placed in the series.
+		if p[1].Valid {
+			points = append(points, p)
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i][1].Float64 < points[j][1].Float64
+	})
+
+	s := mathexp.NewSeries(name, labels, len(points))
+	if ts.Name != "" {
+		s.Frame.Fields[1].Config = &data.FieldConfig{DisplayNameFromDS: ts.Name}
+	}
+	for i, p := range points {
+		var f *float64
+		if p[0].Valid {
+			v := p[0].Float64
+			f = &v
+		}
+		s.SetPoint(i, time.UnixMilli(int64(p[1].Float64)), f)
+	}
+	return s
+}
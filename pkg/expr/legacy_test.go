@@ -0,0 +1,123 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+func TestDataResponseToVars(t *testing.T) {
+	point := func(v *float64, ms int64) legacydata.DataTimePoint {
+		return legacydata.DataTimePoint{null.FloatFromPtr(v), null.FloatFrom(float64(ms))}
+	}
+
+	t.Run("should convert Graphite series to Series with tags as labels", func(t *testing.T) {
+		resp := legacydata.DataResponse{
+			Results: map[string]legacydata.DataQueryResult{
+				"A": {
+					RefID: "A",
+					Series: legacydata.DataTimeSeriesSlice{
+						{
+							Name: "servers.web01.cpu",
+							Tags: map[string]string{"name": "servers.web01.cpu", "host": "web01"},
+							Points: legacydata.DataTimeSeriesPoints{
+								point(ptr.Float64(2), 2000),
+								point(ptr.Float64(1), 1000),
+								point(nil, 3000),
+							},
+						},
+						{
+							Name: "servers.web02.cpu",
+							Tags: map[string]string{"name": "servers.web02.cpu", "host": "web02"},
+							Points: legacydata.DataTimeSeriesPoints{
+								point(ptr.Float64(5), 1000),
+								point(ptr.Float64(6), 2000),
+							},
+						},
+					},
+				},
+				"B": {RefID: "B"},
+			},
+		}
+
+		vars, err := DataResponseToVars(resp)
+		require.NoError(t, err)
+		require.Len(t, vars, 2)
+
+		type tp struct {
+			t time.Time
+			f *float64
+		}
+		series := func(labels data.Labels, points ...tp) mathexp.Series {
+			s := mathexp.NewSeries("A", labels, len(points))
+			for i, p := range points {
+				s.SetPoint(i, p.t, p.f)
+			}
+			return s
+		}
+		expected := []mathexp.Series{
+			series(data.Labels{"name": "servers.web01.cpu", "host": "web01"},
+				tp{time.UnixMilli(1000), ptr.Float64(1)},
+				tp{time.UnixMilli(2000), ptr.Float64(2)},
+				tp{time.UnixMilli(3000), nil},
+			),
+			series(data.Labels{"name": "servers.web02.cpu", "host": "web02"},
+				tp{time.UnixMilli(1000), ptr.Float64(5)},
+				tp{time.UnixMilli(2000), ptr.Float64(6)},
+			),
+		}
+
+		require.Len(t, vars["A"].Values, len(expected))
+		for i, e := range expected {
+			s, ok := vars["A"].Values[i].(mathexp.Series)
+			require.True(t, ok)
+			require.Equal(t, e.GetName(), s.GetName())
+			require.Equal(t, e.GetLabels(), s.GetLabels())
+			require.Equal(t, e.Len(), s.Len())
+			for p := 0; p < e.Len(); p++ {
+				et, ef := e.GetPoint(p)
+				st, sf := s.GetPoint(p)
+				require.True(t, et.Equal(st))
+				require.Equal(t, ef, sf)
+			}
+		}
+
+		require.Len(t, vars["B"].Values, 1)
+		require.Equal(t, mathexp.NoData{}.New().Type(), vars["B"].Values[0].Type())
+	})
+
+	t.Run("should convert data frames", func(t *testing.T) {
+		frame := data.NewFrame("A",
+			data.NewField("time", nil, []time.Time{time.UnixMilli(1000), time.UnixMilli(2000)}),
+			data.NewField("value", data.Labels{"host": "web01"}, []*float64{ptr.Float64(1), ptr.Float64(2)}),
+		)
+		resp := legacydata.DataResponse{
+			Results: map[string]legacydata.DataQueryResult{
+				"A": {RefID: "A", Dataframes: legacydata.NewDecodedDataFrames(data.Frames{frame})},
+			},
+		}
+
+		vars, err := DataResponseToVars(resp)
+		require.NoError(t, err)
+		require.Len(t, vars["A"].Values, 1)
+		require.Equal(t, data.Labels{"host": "web01"}, vars["A"].Values[0].GetLabels())
+	})
+
+	t.Run("should return the error of a query", func(t *testing.T) {
+		queryErr := errors.New("graphite is down")
+		_, err := DataResponseToVars(legacydata.DataResponse{
+			Results: map[string]legacydata.DataQueryResult{
+				"A": {RefID: "A", Error: queryErr},
+			},
+		})
+		require.ErrorIs(t, err, queryErr)
+	})
+}
@@ -0,0 +1,133 @@
+package mathexp
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ToCSV writes the Results to w as CSV.
+//
+// Series are written first as a table with a "time" column followed by one column
+// per series. Rows are the union of all timestamps of all series sorted from oldest
+// to newest, and a series with no point at a timestamp has an empty cell.
+//
+// Numbers and Scalars are written after the series as a "key","value" section.
+// If both sections are present they are separated by an empty line.
+//
+// Series and Numbers are identified by their name followed by their labels,
+// e.g. A{host=a, job=api}. NoData values are skipped.
+func (r Results) ToCSV(w io.Writer) error {
+	var series []Series
+	var numbers []Value
+	for _, val := range r.Values {
+		switch v := val.(type) {
+		case Series:
+			series = append(series, v)
+		case Number, Scalar:
+			numbers = append(numbers, v)
+		}
+	}
+
+	cw := csv.NewWriter(w)
+
+	if len(series) > 0 {
+		if err := writeSeriesCSV(cw, series); err != nil {
+			return err
+		}
+	}
+
+	if len(numbers) > 0 {
+		if len(series) > 0 {
+			cw.Flush()
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := writeNumbersCSV(cw, numbers); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeSeriesCSV(cw *csv.Writer, series []Series) error {
+	header := make([]string, 0, len(series)+1)
+	header = append(header, "time")
+
+	// points holds the value of each series per timestamp.
+	points := make(map[int64][]*float64)
+	var times []time.Time
+	for i, s := range series {
+		header = append(header, csvKey(s.GetName(), s))
+		for p := 0; p < s.Len(); p++ {
+			t, f := s.GetPoint(p)
+			row, ok := points[t.UnixNano()]
+			if !ok {
+				row = make([]*float64, len(series))
+				points[t.UnixNano()] = row
+				times = append(times, t)
+			}
+			row[i] = f
+		}
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, t := range times {
+		record := make([]string, 0, len(series)+1)
+		record = append(record, t.UTC().Format(time.RFC3339Nano))
+		for _, f := range points[t.UnixNano()] {
+			record = append(record, csvFloat(f))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeNumbersCSV(cw *csv.Writer, numbers []Value) error {
+	if err := cw.Write([]string{"key", "value"}); err != nil {
+		return err
+	}
+	for _, val := range numbers {
+		var name string
+		var f *float64
+		switch v := val.(type) {
+		case Number:
+			name = v.Frame.Fields[0].Name
+			f = v.GetFloat64Value()
+		case Scalar:
+			name = v.Frame.Fields[0].Name
+			f = v.GetFloat64Value()
+		}
+		if err := cw.Write([]string{csvKey(name, val), csvFloat(f)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func csvKey(name string, v Value) string {
+	if len(v.GetLabels()) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s{%s}", name, v.GetLabels())
+}
+
+func csvFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
@@ -0,0 +1,80 @@
+package mathexp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultsToCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  Results
+		expected string
+	}{
+		{
+			name: "series of differing lengths are aligned on the union of timestamps",
+			results: Results{
+				Values: Values{
+					makeSeries("A", data.Labels{"host": "a", "dc": "eu"},
+						tp{time.Unix(5, 0), float64Pointer(1)},
+						tp{time.Unix(10, 0), float64Pointer(2.5)},
+					),
+					makeSeries("A", data.Labels{"host": "b"},
+						tp{time.Unix(10, 0), nil},
+						tp{time.Unix(15, 0), float64Pointer(-3)},
+					),
+				},
+			},
+			expected: "time,\"A{dc=eu, host=a}\",A{host=b}\n" +
+				"1970-01-01T00:00:05Z,1,\n" +
+				"1970-01-01T00:00:10Z,2.5,\n" +
+				"1970-01-01T00:00:15Z,,-3\n",
+		},
+		{
+			name: "numbers and scalars are written as key value pairs",
+			results: Results{
+				Values: Values{
+					makeNumber("B", data.Labels{"host": "a"}, float64Pointer(4)),
+					makeNumber("B", nil, NaN),
+					NewScalar("C", nil),
+				},
+			},
+			expected: "key,value\n" +
+				"B{host=a},4\n" +
+				"B,NaN\n" +
+				"C,\n",
+		},
+		{
+			name: "series and numbers are written in separate sections",
+			results: Results{
+				Values: Values{
+					makeNumber("B", nil, float64Pointer(7)),
+					makeSeries("A", nil, tp{time.Unix(5, 0), float64Pointer(1)}),
+					NewNoData(),
+				},
+			},
+			expected: "time,A\n" +
+				"1970-01-01T00:00:05Z,1\n" +
+				"\n" +
+				"key,value\n" +
+				"B,7\n",
+		},
+		{
+			name:     "empty results write nothing",
+			results:  Results{},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tt.results.ToCSV(&buf))
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"math"
 	"reflect"
 	"runtime"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 
@@ -14,6 +15,33 @@ import (
 // Expr holds a parsed math command expression.
 type Expr struct {
 	*parse.Tree
+	// DivByZero is the policy applied when a value is divided by zero.
+	DivByZero DivByZeroPolicy
+}
+
+// DivByZeroPolicy controls the result of a division by zero in an expression.
+type DivByZeroPolicy string
+
+const (
+	// DivByZeroDefault keeps the floating point result of the division: +Inf, -Inf, or NaN for 0/0.
+	DivByZeroDefault DivByZeroPolicy = ""
+	// DivByZeroError fails the execution of the expression.
+	DivByZeroError DivByZeroPolicy = "error"
+	// DivByZeroNaN sets the result of the division to NaN.
+	DivByZeroNaN DivByZeroPolicy = "nan"
+	// DivByZeroZero sets the result of the division to 0.
+	DivByZeroZero DivByZeroPolicy = "zero"
+)
+
+// ParseDivByZeroPolicy returns the DivByZeroPolicy for s, which must be
+// empty, "error", "nan", or "zero".
+func ParseDivByZeroPolicy(s string) (DivByZeroPolicy, error) {
+	switch p := DivByZeroPolicy(s); p {
+	case DivByZeroDefault, DivByZeroError, DivByZeroNaN, DivByZeroZero:
+		return p, nil
+	default:
+		return DivByZeroDefault, fmt.Errorf("division by zero policy '%v' is not supported. Supported: [error,nan,zero]", s)
+	}
 }
 
 // State embeds a parsed Expr with variables and their results
@@ -25,6 +53,8 @@ type State struct {
 	//  - Unions (How many result A and many Result B in case A + B are joined)
 	//  - NaN/Null behavior
 	RefID string
+	// DivByZero is the policy applied when a value is divided by zero.
+	DivByZero DivByZeroPolicy
 }
 
 // Vars holds the results of datasource queries or other expression commands.
@@ -43,12 +73,23 @@ func New(expr string, funcs ...map[string]parse.Func) (*Expr, error) {
 	return e, nil
 }
 
+// NewBinary creates an expression applying the binary operator op to the values of
+// the variables a and b, matched as described by m, see parse.NewBinary.
+func NewBinary(a, op, b string, m *parse.VectorMatching) (*Expr, error) {
+	t, err := parse.NewBinary(a, op, b, m)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{Tree: t}, nil
+}
+
 // Execute applies a parse expression to the context and executes it
 func (e *Expr) Execute(refID string, vars Vars) (r Results, err error) {
 	s := &State{
-		Expr:  e,
-		Vars:  vars,
-		RefID: refID,
+		Expr:      e,
+		Vars:      vars,
+		RefID:     refID,
+		DivByZero: e.DivByZero,
 	}
 	return e.executeState(s)
 }
@@ -82,11 +123,13 @@ func (e *State) walk(node parse.Node) (res Results, err error) {
 	case *parse.ScalarNode:
 		res = NewScalarResults(e.RefID, &node.Float64)
 	case *parse.VarNode:
-		res = e.Vars[node.Name]
+		res = e.walkVar(node)
 	case *parse.BinaryNode:
 		res, err = e.walkBinary(node)
 	case *parse.UnaryNode:
 		res, err = e.walkUnary(node)
+	case *parse.TernaryNode:
+		res, err = e.walkTernary(node)
 	case *parse.FuncNode:
 		res, err = e.walkFunc(node)
 	default:
@@ -95,6 +138,23 @@ func (e *State) walk(node parse.Node) (res Results, err error) {
 	return
 }
 
+// walkVar returns the values of the variable that match its label selector. If none
+// match, the variable has no values, like a query that returns no data; if several
+// match, they are all used.
+func (e *State) walkVar(node *parse.VarNode) Results {
+	res := e.Vars[node.Name]
+	if len(node.Selector) == 0 {
+		return res
+	}
+	selected := Results{}
+	for _, v := range res.Values {
+		if _, ok := v.(NoData); ok || node.Matches(v.GetLabels()) {
+			selected.Values = append(selected.Values, v)
+		}
+	}
+	return selected
+}
+
 func (e *State) walkUnary(node *parse.UnaryNode) (Results, error) {
 	a, err := e.walk(node.Arg)
 	if err != nil {
@@ -212,23 +272,8 @@ func union(aResults, bResults Results) []*Union {
 	}
 	for _, a := range aResults.Values {
 		for _, b := range bResults.Values {
-			var labels data.Labels
-			aLabels := a.GetLabels()
-			bLabels := b.GetLabels()
-			switch {
-			case aLabels.Equals(bLabels) || len(aLabels) == 0 || len(bLabels) == 0:
-				l := aLabels
-				if len(aLabels) == 0 {
-					l = bLabels
-				}
-				labels = l
-			case len(aLabels) == len(bLabels):
-				continue // invalid union, drop for now
-			case aLabels.Contains(bLabels):
-				labels = aLabels
-			case bLabels.Contains(aLabels):
-				labels = bLabels
-			default:
+			labels, ok := unionLabels(a.GetLabels(), b.GetLabels())
+			if !ok {
 				continue
 			}
 			u := &Union{
@@ -253,6 +298,26 @@ func union(aResults, bResults Results) []*Union {
 	return unions
 }
 
+// unionLabels returns the labels of the union of two values with aLabels and bLabels, and
+// false if the labels are not compatible.
+func unionLabels(aLabels, bLabels data.Labels) (data.Labels, bool) {
+	switch {
+	case aLabels.Equals(bLabels) || len(aLabels) == 0 || len(bLabels) == 0:
+		if len(aLabels) == 0 {
+			return bLabels, true
+		}
+		return aLabels, true
+	case len(aLabels) == len(bLabels):
+		return nil, false // invalid union, drop for now
+	case aLabels.Contains(bLabels):
+		return aLabels, true
+	case bLabels.Contains(aLabels):
+		return bLabels, true
+	default:
+		return nil, false
+	}
+}
+
 func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 	res := Results{Values{}}
 	ar, err := e.walk(node.Args[0])
@@ -264,6 +329,28 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 		return res, err
 	}
 	unions := union(ar, br)
+	if node.Matching != nil {
+		unions, err = matchingUnions(ar, br, node.Matching)
+		if err != nil {
+			return res, err
+		}
+	}
+	aDefault, err := e.defaultValue(node.Args[0])
+	if err != nil {
+		return res, err
+	}
+	bDefault, err := e.defaultValue(node.Args[1])
+	if err != nil {
+		return res, err
+	}
+	unions = append(unions, e.defaultUnions(ar, br, unions, aDefault, bDefault)...)
+	return e.biUnions(node.OpStr, unions)
+}
+
+// biUnions applies the binary operator op to the values of each union.
+func (e *State) biUnions(op string, unions []*Union) (Results, error) {
+	res := Results{Values{}}
+	var err error
 	for _, uni := range unions {
 		var value Value
 		switch at := uni.A.(type) {
@@ -279,7 +366,7 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 				}
 				f := math.NaN()
 				if aFloat != nil && bFloat != nil {
-					f, err = binaryOp(node.OpStr, *aFloat, *bFloat)
+					f, err = e.binaryOp(op, *aFloat, *bFloat)
 					if err != nil {
 						return res, err
 					}
@@ -287,53 +374,53 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 				value = NewScalar(e.RefID, &f)
 			// Scalar op Scalar
 			case Number:
-				value, err = e.biScalarNumber(uni.Labels, node.OpStr, bt, aFloat, false)
+				value, err = e.biScalarNumber(uni.Labels, op, bt, aFloat, false)
 			// Scalar op Series
 			case Series:
-				value, err = e.biSeriesNumber(uni.Labels, node.OpStr, bt, aFloat, false)
+				value, err = e.biSeriesNumber(uni.Labels, op, bt, aFloat, false)
 			case NoData:
 				value = uni.B
 			default:
-				return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
+				return res, fmt.Errorf("not implemented: binary %v on %T and %T", op, uni.A, uni.B)
 			}
 		case Series:
 			switch bt := uni.B.(type) {
 			// Series Op Scalar
 			case Scalar:
 				bFloat := bt.GetFloat64Value()
-				value, err = e.biSeriesNumber(uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = e.biSeriesNumber(uni.Labels, op, at, bFloat, true)
 			// case Series Op Number
 			case Number:
 				bFloat := bt.GetFloat64Value()
-				value, err = e.biSeriesNumber(uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = e.biSeriesNumber(uni.Labels, op, at, bFloat, true)
 			// case Series op Series
 			case Series:
-				value, err = e.biSeriesSeries(uni.Labels, node.OpStr, at, bt)
+				value, err = e.biSeriesSeries(uni.Labels, op, at, bt)
 			case NoData:
 				value = uni.B
 			default:
-				return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
+				return res, fmt.Errorf("not implemented: binary %v on %T and %T", op, uni.A, uni.B)
 			}
 		case Number:
 			aFloat := at.GetFloat64Value()
 			switch bt := uni.B.(type) {
 			case Scalar:
 				bFloat := bt.GetFloat64Value()
-				value, err = e.biScalarNumber(uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = e.biScalarNumber(uni.Labels, op, at, bFloat, true)
 			case Number:
 				bFloat := bt.GetFloat64Value()
-				value, err = e.biScalarNumber(uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = e.biScalarNumber(uni.Labels, op, at, bFloat, true)
 			case Series:
-				value, err = e.biSeriesNumber(uni.Labels, node.OpStr, bt, aFloat, false)
+				value, err = e.biSeriesNumber(uni.Labels, op, bt, aFloat, false)
 			case NoData:
 				value = uni.B
 			default:
-				return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
+				return res, fmt.Errorf("not implemented: binary %v on %T and %T", op, uni.A, uni.B)
 			}
 		case NoData:
 			value = uni.A
 		default:
-			return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
+			return res, fmt.Errorf("not implemented: binary %v on %T and %T", op, uni.A, uni.B)
 		}
 		if err != nil {
 			return res, err
@@ -343,12 +430,196 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 	return res, nil
 }
 
+// matchingUnions creates Unions like union, but matches the values on the labels
+// selected by m, like PromQL binary operators with vector matching. Values without
+// a match are dropped.
+//
+// With a one-to-one matching the labels of a Union are the matched labels. With a
+// many-to-one or one-to-many matching they are the labels of the value of the "many"
+// side, plus the labels of m.Include taken from the value of the "one" side.
+// If either side is not a set of series or numbers, values are matched like union does.
+func matchingUnions(aResults, bResults Results, m *parse.VectorMatching) ([]*Union, error) {
+	if !isVectorSet(aResults) || !isVectorSet(bResults) {
+		return union(aResults, bResults), nil
+	}
+
+	many, one := aResults, bResults
+	manySide, oneSide := "left", "right"
+	if m.Card == parse.CardOneToMany {
+		many, one = bResults, aResults
+		manySide, oneSide = "right", "left"
+	}
+
+	ones := make(map[string]Value, len(one.Values))
+	for _, v := range one.Values {
+		sig := matchingLabels(v.GetLabels(), m).String()
+		if _, ok := ones[sig]; ok {
+			return nil, fmt.Errorf("found duplicate series for the match group {%s} on the %s side of the operation: many-to-many matching not allowed", sig, oneSide)
+		}
+		ones[sig] = v
+	}
+
+	unions := []*Union{}
+	matched := make(map[string]bool, len(many.Values))
+	for _, v := range many.Values {
+		sig := matchingLabels(v.GetLabels(), m).String()
+		o, ok := ones[sig]
+		if !ok {
+			continue
+		}
+
+		var labels data.Labels
+		if m.Card == parse.CardOneToOne {
+			if matched[sig] {
+				return nil, fmt.Errorf("found duplicate series for the match group {%s} on the %s side of the operation: many-to-many matching not allowed, use group_left or group_right", sig, manySide)
+			}
+			labels = matchingLabels(v.GetLabels(), m)
+		} else {
+			labels = v.GetLabels().Copy()
+			if labels == nil {
+				labels = data.Labels{}
+			}
+			for _, name := range m.Include {
+				if value := o.GetLabels()[name]; value != "" {
+					labels[name] = value
+				} else {
+					delete(labels, name)
+				}
+			}
+		}
+		matched[sig] = true
+
+		u := &Union{Labels: labels, A: v, B: o}
+		if m.Card == parse.CardOneToMany {
+			u.A, u.B = o, v
+		}
+		unions = append(unions, u)
+	}
+	return unions, nil
+}
+
+// isVectorSet returns true if all the values of results are series or numbers.
+func isVectorSet(results Results) bool {
+	for _, v := range results.Values {
+		switch v.(type) {
+		case Series, Number:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// matchingLabels returns the labels values are matched on: the labels of m.Labels
+// with on, or all the labels but the ones of m.Labels with ignoring.
+func matchingLabels(labels data.Labels, m *parse.VectorMatching) data.Labels {
+	res := data.Labels{}
+	if m.On {
+		for _, name := range m.Labels {
+			if value, ok := labels[name]; ok {
+				res[name] = value
+			}
+		}
+		return res
+	}
+LABELS:
+	for name, value := range labels {
+		for _, ignored := range m.Labels {
+			if name == ignored {
+				continue LABELS
+			}
+		}
+		res[name] = value
+	}
+	return res
+}
+
+// defaultValue returns the default value of node if it is a with_default function call.
+func (e *State) defaultValue(node parse.Node) (*Scalar, error) {
+	f, ok := node.(*parse.FuncNode)
+	if !ok || f.Name != "with_default" {
+		return nil, nil
+	}
+	res, err := e.walk(f.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Values) != 1 {
+		return nil, fmt.Errorf("expected a single default value in %s", f)
+	}
+	s, ok := res.Values[0].(Scalar)
+	if !ok {
+		return nil, fmt.Errorf("expected the default value in %s to be a scalar, got %v", f, res.Values[0].Type())
+	}
+	return &s, nil
+}
+
+// defaultUnions creates Unions for the values of one side of a binary operation that are not
+// part of any union, when the other side is wrapped by with_default. Such a value is combined with
+// the default of the other side and keeps its own labels. If both sides have a default, both apply.
+func (e *State) defaultUnions(aResults, bResults Results, unions []*Union, aDefault, bDefault *Scalar) []*Union {
+	var defaults []*Union
+	if bDefault != nil {
+		for _, a := range unmatchedValues(aResults, unions, func(u *Union) Value { return u.A }) {
+			defaults = append(defaults, &Union{Labels: a.GetLabels(), A: a, B: *bDefault})
+		}
+	}
+	if aDefault != nil {
+		for _, b := range unmatchedValues(bResults, unions, func(u *Union) Value { return u.B }) {
+			defaults = append(defaults, &Union{Labels: b.GetLabels(), A: *aDefault, B: b})
+		}
+	}
+	return defaults
+}
+
+// unmatchedValues returns the values of results that are not on the side of any union returned by side.
+func unmatchedValues(results Results, unions []*Union, side func(u *Union) Value) []Value {
+	var unmatched []Value
+VALUES:
+	for _, v := range results.Values {
+		if v == nil || v.Type() == parse.TypeNoData {
+			continue
+		}
+		for _, u := range unions {
+			if side(u).AsDataFrame() == v.AsDataFrame() {
+				continue VALUES
+			}
+		}
+		unmatched = append(unmatched, v)
+	}
+	return unmatched
+}
+
+// binaryOp performs the binary operation like the binaryOp function, but applies the division
+// by zero policy of the State when b is zero.
+func (e *State) binaryOp(op string, a, b float64) (float64, error) {
+	if op == "/" && b == 0 && !math.IsNaN(a) {
+		switch e.DivByZero {
+		case DivByZeroError:
+			return 0, fmt.Errorf("division by zero in expression '%v'", e.RefID)
+		case DivByZeroNaN:
+			return math.NaN(), nil
+		case DivByZeroZero:
+			return 0, nil
+		}
+	}
+	return binaryOp(op, a, b)
+}
+
 // binaryOp performs a binary operations (e.g. A+B or A>B) on two
 // float values
 // nolint:gocyclo
 func binaryOp(op string, a, b float64) (r float64, err error) {
 	// Test short circuit before NaN.
 	switch op {
+	case "min", "max":
+		// NaN operands are skipped unless both are NaN.
+		if math.IsNaN(a) {
+			return b, nil
+		}
+		if math.IsNaN(b) {
+			return a, nil
+		}
 	case "||":
 		if a != 0 {
 			return 1, nil
@@ -372,6 +643,10 @@ func binaryOp(op string, a, b float64) (r float64, err error) {
 		r = a / b
 	case "**":
 		r = math.Pow(a, b)
+	case "min":
+		r = math.Min(a, b)
+	case "max":
+		r = math.Max(a, b)
 	case "%":
 		r = math.Mod(a, b)
 	case "==":
@@ -438,9 +713,9 @@ func (e *State) biScalarNumber(labels data.Labels, op string, number Number, sca
 	nF := math.NaN()
 	var err error
 	if numberFirst {
-		nF, err = binaryOp(op, *f, *scalarVal)
+		nF, err = e.binaryOp(op, *f, *scalarVal)
 	} else {
-		nF, err = binaryOp(op, *scalarVal, *f)
+		nF, err = e.binaryOp(op, *scalarVal, *f)
 	}
 	if err != nil {
 		return newNumber, err
@@ -460,9 +735,9 @@ func (e *State) biSeriesNumber(labels data.Labels, op string, s Series, scalarVa
 			continue
 		}
 		if seriesFirst {
-			nF, err = binaryOp(op, *f, *scalarVal)
+			nF, err = e.binaryOp(op, *f, *scalarVal)
 		} else {
-			nF, err = binaryOp(op, *scalarVal, *f)
+			nF, err = e.binaryOp(op, *scalarVal, *f)
 		}
 		if err != nil {
 			return newSeries, err
@@ -493,7 +768,7 @@ func (e *State) biSeriesSeries(labels data.Labels, op string, aSeries, bSeries S
 			newSeries.AppendPoint(aTime, nil)
 			continue
 		}
-		nF, err := binaryOp(op, *aF, *bF)
+		nF, err := e.binaryOp(op, *aF, *bF)
 		if err != nil {
 			return newSeries, err
 		}
@@ -502,6 +777,164 @@ func (e *State) biSeriesSeries(labels data.Labels, op string, aSeries, bSeries S
 	return newSeries, nil
 }
 
+// ternaryUnion holds the condition and the two values to choose from of a ternary
+// operation where the labels of all three are compatible.
+type ternaryUnion struct {
+	Labels     data.Labels
+	Cond, A, B Value
+}
+
+// ternaryUnions creates ternaryUnions like union does for binary operations.
+func ternaryUnions(condResults, aResults, bResults Results) []*ternaryUnion {
+	unions := []*ternaryUnion{}
+	all := []Results{condResults, aResults, bResults}
+	for _, r := range all {
+		if len(r.Values) == 0 {
+			return unions
+		}
+	}
+	for _, r := range all {
+		if len(r.Values) == 1 && r.Values[0].Type() == parse.TypeNoData {
+			return append(unions, &ternaryUnion{Cond: condResults.Values[0], A: aResults.Values[0], B: bResults.Values[0]})
+		}
+	}
+	for _, c := range condResults.Values {
+		for _, a := range aResults.Values {
+			caLabels, ok := unionLabels(c.GetLabels(), a.GetLabels())
+			if !ok {
+				continue
+			}
+			for _, b := range bResults.Values {
+				labels, ok := unionLabels(caLabels, b.GetLabels())
+				if !ok {
+					continue
+				}
+				unions = append(unions, &ternaryUnion{Labels: labels, Cond: c, A: a, B: b})
+			}
+		}
+	}
+	if len(unions) == 0 && len(condResults.Values) == 1 && len(aResults.Values) == 1 && len(bResults.Values) == 1 {
+		// Like union, combine single values and strip the labels.
+		unions = append(unions, &ternaryUnion{Cond: condResults.Values[0], A: aResults.Values[0], B: bResults.Values[0]})
+	}
+	return unions
+}
+
+// walkTernary evaluates cond ? a : b for each point of a Series, or each value of a Number or
+// Scalar. The result is a if the condition is not 0, b if it is 0, NaN if it is NaN and null
+// if it is null. Points of a Series are dropped if another Series in the operation has no point
+// at the same time.
+func (e *State) walkTernary(node *parse.TernaryNode) (Results, error) {
+	res := Results{Values{}}
+	cr, err := e.walk(node.Cond)
+	if err != nil {
+		return res, err
+	}
+	ar, err := e.walk(node.Args[0])
+	if err != nil {
+		return res, err
+	}
+	br, err := e.walk(node.Args[1])
+	if err != nil {
+		return res, err
+	}
+	for _, uni := range ternaryUnions(cr, ar, br) {
+		value, err := e.ternaryValue(uni)
+		if err != nil {
+			return res, err
+		}
+		res.Values = append(res.Values, value)
+	}
+	return res, nil
+}
+
+func (e *State) ternaryValue(uni *ternaryUnion) (Value, error) {
+	// valueAt returns the value of an operand at a time, and false if it is a Series without
+	// a point at that time.
+	var valueAt [3]func(t time.Time) (*float64, bool)
+	var series *Series
+	isNumber := false
+	for i, v := range []Value{uni.Cond, uni.A, uni.B} {
+		switch v := v.(type) {
+		case Scalar:
+			f := v.GetFloat64Value()
+			valueAt[i] = func(time.Time) (*float64, bool) { return f, true }
+		case Number:
+			isNumber = true
+			f := v.GetFloat64Value()
+			valueAt[i] = func(time.Time) (*float64, bool) { return f, true }
+		case Series:
+			if series == nil {
+				series = &v
+			}
+			points := make(map[string]*float64, v.Len())
+			for j := 0; j < v.Len(); j++ {
+				t, f := v.GetPoint(j)
+				points[t.UTC().String()] = f
+			}
+			valueAt[i] = func(t time.Time) (*float64, bool) {
+				f, ok := points[t.UTC().String()]
+				return f, ok
+			}
+		case NoData:
+			return v.New(), nil
+		default:
+			return nil, fmt.Errorf("not implemented: ternary on %T, %T and %T", uni.Cond, uni.A, uni.B)
+		}
+	}
+
+	eval := func(t time.Time) (*float64, bool) {
+		c, okC := valueAt[0](t)
+		a, okA := valueAt[1](t)
+		b, okB := valueAt[2](t)
+		if !okC || !okA || !okB {
+			return nil, false
+		}
+		return ternaryOp(c, a, b), true
+	}
+
+	if series == nil {
+		f, _ := eval(time.Time{})
+		if isNumber {
+			n := NewNumber(e.RefID, uni.Labels)
+			n.SetValue(f)
+			return n, nil
+		}
+		return NewScalar(e.RefID, f), nil
+	}
+
+	newSeries := NewSeries(e.RefID, uni.Labels, 0)
+	for i := 0; i < series.Len(); i++ {
+		t, _ := series.GetPoint(i)
+		f, ok := eval(t)
+		if !ok {
+			continue
+		}
+		newSeries.AppendPoint(t, f)
+	}
+	return newSeries, nil
+}
+
+// ternaryOp returns a copy of a if cond is not 0, else a copy of b.
+func ternaryOp(cond, a, b *float64) *float64 {
+	if cond == nil {
+		return nil
+	}
+	r := b
+	switch {
+	case math.IsNaN(*cond):
+		nan := math.NaN()
+		return &nan
+	case *cond != 0:
+		r = a
+	}
+	if r == nil {
+		return nil
+	}
+	f := *r
+	return &f
+}
+
 func (e *State) walkFunc(node *parse.FuncNode) (Results, error) {
 	var res Results
 	var err error
@@ -512,13 +945,15 @@ func (e *State) walkFunc(node *parse.FuncNode) (Results, error) {
 		case *parse.StringNode:
 			v = t.Text
 		case *parse.VarNode:
-			v = e.Vars[t.Name]
+			v = e.walkVar(t)
 		case *parse.ScalarNode:
 			v = NewScalarResults(e.RefID, &t.Float64)
 		case *parse.FuncNode:
 			v, err = e.walkFunc(t)
 		case *parse.UnaryNode:
 			v, err = e.walkUnary(t)
+		case *parse.TernaryNode:
+			v, err = e.walkTernary(t)
 		case *parse.BinaryNode:
 			v, err = e.walkBinary(t)
 		default:
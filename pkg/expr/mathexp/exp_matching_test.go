@@ -0,0 +1,162 @@
+package mathexp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+func TestVectorMatchingExpr(t *testing.T) {
+	oneToOne := Vars{
+		"A": Results{Values: Values{
+			makeNumber("A", data.Labels{"instance": "a", "job": "x"}, float64Pointer(1)),
+			makeNumber("A", data.Labels{"instance": "b", "job": "x"}, float64Pointer(2)),
+		}},
+		"B": Results{Values: Values{
+			makeNumber("B", data.Labels{"instance": "a", "job": "y"}, float64Pointer(10)),
+			makeNumber("B", data.Labels{"instance": "c", "job": "y"}, float64Pointer(30)),
+		}},
+	}
+	manyToOne := Vars{
+		"A": Results{Values: Values{
+			makeNumber("A", data.Labels{"instance": "a", "cpu": "0"}, float64Pointer(1)),
+			makeNumber("A", data.Labels{"instance": "a", "cpu": "1"}, float64Pointer(2)),
+			makeNumber("A", data.Labels{"instance": "b", "cpu": "0"}, float64Pointer(3)),
+			makeNumber("A", data.Labels{"instance": "d", "cpu": "0"}, float64Pointer(4)),
+		}},
+		"B": Results{Values: Values{
+			makeNumber("B", data.Labels{"instance": "a", "owner": "ops"}, float64Pointer(10)),
+			makeNumber("B", data.Labels{"instance": "b", "owner": "dev"}, float64Pointer(20)),
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		expr          string
+		vars          Vars
+		expected      Results
+		expectedError string
+	}{
+		{
+			name: "one-to-one on drops unmatched values",
+			expr: "$A + on(instance) $B",
+			vars: oneToOne,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"instance": "a"}, float64Pointer(11)),
+			}},
+		},
+		{
+			name: "one-to-one ignoring drops unmatched values",
+			expr: "$A + ignoring(job) $B",
+			vars: oneToOne,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"instance": "a"}, float64Pointer(11)),
+			}},
+		},
+		{
+			name: "group_left matches many values of the left side and copies included labels",
+			expr: "$A * on(instance) group_left(owner) $B",
+			vars: manyToOne,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"instance": "a", "cpu": "0", "owner": "ops"}, float64Pointer(10)),
+				makeNumber("", data.Labels{"instance": "a", "cpu": "1", "owner": "ops"}, float64Pointer(20)),
+				makeNumber("", data.Labels{"instance": "b", "cpu": "0", "owner": "dev"}, float64Pointer(60)),
+			}},
+		},
+		{
+			name: "group_right matches many values of the right side",
+			expr: "$B * on(instance) group_right $A",
+			vars: manyToOne,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"instance": "a", "cpu": "0"}, float64Pointer(10)),
+				makeNumber("", data.Labels{"instance": "a", "cpu": "1"}, float64Pointer(20)),
+				makeNumber("", data.Labels{"instance": "b", "cpu": "0"}, float64Pointer(60)),
+			}},
+		},
+		{
+			name:          "one-to-one fails on duplicate matches",
+			expr:          "$A * on(instance) $B",
+			vars:          manyToOne,
+			expectedError: "many-to-many matching not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			require.NoError(t, err)
+			res, err := e.Execute("", tt.vars)
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if diff := cmp.Diff(tt.expected, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVectorMatchingParse(t *testing.T) {
+	t.Run("should keep the vector matching in the string of the expression", func(t *testing.T) {
+		e, err := New("$A * on(instance, job) group_left(owner) $B")
+		require.NoError(t, err)
+		require.Equal(t, "$A * on(instance, job) group_left(owner) $B", e.Tree.Root.String())
+	})
+
+	t.Run("should fail when a label is both in on and group_left", func(t *testing.T) {
+		_, err := New("$A * on(instance) group_left(instance) $B")
+		require.Error(t, err)
+	})
+
+	t.Run("should fail on unterminated label list", func(t *testing.T) {
+		_, err := New("$A + on(instance $B")
+		require.Error(t, err)
+	})
+}
+
+func TestNewBinary(t *testing.T) {
+	vars := Vars{
+		"query A": Results{Values: Values{
+			makeNumber("query A", data.Labels{"k8s_pod": "a", "cpu": "0"}, float64Pointer(1)),
+			makeNumber("query A", data.Labels{"k8s_pod": "a", "cpu": "1"}, float64Pointer(2)),
+			makeNumber("query A", data.Labels{"k8s_pod": "b", "cpu": "0"}, float64Pointer(3)),
+		}},
+		"B": Results{Values: Values{
+			makeNumber("B", data.Labels{"k8s_pod": "a", "owner": "ops"}, float64Pointer(10)),
+		}},
+	}
+
+	t.Run("should match values like a parsed expression, whatever their names", func(t *testing.T) {
+		e, err := NewBinary("query A", "*", "B", &parse.VectorMatching{On: true, Labels: []string{"k8s_pod"}, Card: parse.CardManyToOne, Include: []string{"owner"}})
+		require.NoError(t, err)
+		require.Equal(t, []string{"query A", "B"}, e.VarNames)
+		require.Equal(t, "${query A} * on(k8s_pod) group_left(owner) ${B}", e.Tree.Root.String())
+
+		res, err := e.Execute("", vars)
+		require.NoError(t, err)
+		expected := Results{Values: Values{
+			makeNumber("", data.Labels{"k8s_pod": "a", "cpu": "0", "owner": "ops"}, float64Pointer(10)),
+			makeNumber("", data.Labels{"k8s_pod": "a", "cpu": "1", "owner": "ops"}, float64Pointer(20)),
+		}}
+		if diff := cmp.Diff(expected, res, data.FrameTestCompareOptions()...); diff != "" {
+			t.Errorf("Result mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("should fail on an unsupported operator", func(t *testing.T) {
+		_, err := NewBinary("A", "^", "B", nil)
+		require.Error(t, err)
+	})
+
+	t.Run("should fail when a label is both in on and group_left", func(t *testing.T) {
+		_, err := NewBinary("A", "*", "B", &parse.VectorMatching{On: true, Labels: []string{"k8s_pod"}, Card: parse.CardManyToOne, Include: []string{"k8s_pod"}})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,94 @@
+package mathexp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelSelectorExpr(t *testing.T) {
+	vars := Vars{
+		"A": Results{Values: Values{
+			makeNumber("A", data.Labels{"job": "api", "env": "prod"}, float64Pointer(1)),
+			makeNumber("A", data.Labels{"job": "db", "env": "prod"}, float64Pointer(2)),
+			makeNumber("A", data.Labels{"job": "api", "env": "dev"}, float64Pointer(3)),
+			makeNumber("A", data.Labels{"job": "web"}, float64Pointer(4)),
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected Results
+	}{
+		{
+			name: "selects one value out of several",
+			expr: `$A{job="api", env="prod"} * 10`,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"job": "api", "env": "prod"}, float64Pointer(10)),
+			}},
+		},
+		{
+			name: "selects every matching value",
+			expr: `$A{job="api"} * 10`,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"job": "api", "env": "prod"}, float64Pointer(10)),
+				makeNumber("", data.Labels{"job": "api", "env": "dev"}, float64Pointer(30)),
+			}},
+		},
+		{
+			name: "negated matcher matches missing labels",
+			expr: `${A}{env!="prod"} * 10`,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"job": "api", "env": "dev"}, float64Pointer(30)),
+				makeNumber("", data.Labels{"job": "web"}, float64Pointer(40)),
+			}},
+		},
+		{
+			name:     "no match gives no values",
+			expr:     `$A{job="cache"} * 10`,
+			expected: Results{},
+		},
+		{
+			name: "selects values of function arguments",
+			expr: `abs($A{job="db"})`,
+			expected: Results{Values: Values{
+				makeNumber("", data.Labels{"job": "db", "env": "prod"}, float64Pointer(2)),
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, []string{"A"}, e.VarNames)
+			res, err := e.Execute("", vars)
+			require.NoError(t, err)
+			if len(tt.expected.Values) == 0 {
+				require.Empty(t, res.Values)
+				return
+			}
+			if diff := cmp.Diff(tt.expected, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLabelSelectorParse(t *testing.T) {
+	for _, expr := range []string{
+		`$A{} + 1`,
+		`$A{job} + 1`,
+		`$A{job=api} + 1`,
+		`$A{job="api" env="dev"} + 1`,
+		`$A{job=~"api"} + 1`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := New(expr)
+			require.Error(t, err)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package mathexp
 
 import (
+	"fmt"
 	"math"
+	"regexp"
+	"time"
 
 	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
 )
@@ -54,7 +57,8 @@ var builtins = map[string]parse.Func{
 		F:             isNumber,
 	},
 	"round": {
-		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		OptionalArgs:  1,
 		VariantReturn: true,
 		F:             round,
 	},
@@ -68,6 +72,59 @@ var builtins = map[string]parse.Func{
 		VariantReturn: true,
 		F:             floor,
 	},
+	"clamp": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar, parse.TypeScalar},
+		VariantReturn: true,
+		F:             clamp,
+	},
+	"clamp_min": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             clampMin,
+	},
+	"clamp_max": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             clampMax,
+	},
+	"deriv": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             deriv,
+	},
+	"timestamp": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             timestamp,
+	},
+	"with_default": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             withDefault,
+	},
+	"label_replace": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString, parse.TypeString, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             labelReplace,
+		Check:         labelReplaceCheck,
+	},
+	"min": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeVariantSet},
+		Variadic:      true,
+		VariantReturn: true,
+		F:             minOf,
+	},
+	"max": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeVariantSet},
+		Variadic:      true,
+		VariantReturn: true,
+		F:             maxOf,
+	},
+	"histogram_quantile": {
+		Args:   []parse.ReturnType{parse.TypeScalar, parse.TypeVariantSet},
+		Return: parse.TypeNumberSet,
+		F:      histogramQuantile,
+	},
 }
 
 // abs returns the absolute value for each result in NumberSet, SeriesSet, or Scalar
@@ -133,6 +190,34 @@ func isInf(e *State, varSet Results) (Results, error) {
 	return newRes, nil
 }
 
+// minOf returns the minimum of its arguments, point by point for series. Arguments are
+// matched by labels like with binary operators. NaN values are skipped unless all values
+// of a point are NaN.
+func minOf(e *State, varSets ...Results) (Results, error) {
+	return e.fold("min", varSets)
+}
+
+// maxOf returns the maximum of its arguments, point by point for series. Arguments are
+// matched by labels like with binary operators. NaN values are skipped unless all values
+// of a point are NaN.
+func maxOf(e *State, varSets ...Results) (Results, error) {
+	return e.fold("max", varSets)
+}
+
+// fold applies the binary operator op to the first two of varSets, then to the result
+// and each of the following ones.
+func (e *State) fold(op string, varSets []Results) (Results, error) {
+	res := varSets[0]
+	for _, next := range varSets[1:] {
+		var err error
+		res, err = e.biUnions(op, union(res, next))
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
 // nan returns a scalar nan value
 func nan(e *State) Results {
 	aNaN := math.NaN()
@@ -269,11 +354,29 @@ func perNullableFloat(e *State, val Value, floatF func(x *float64) *float64) (Va
 	return newVal, nil
 }
 
-// round returns the rounded value for each result in NumberSet, SeriesSet, or Scalar
-func round(e *State, varSet Results) (Results, error) {
+// round returns the rounded value for each result in NumberSet, SeriesSet, or Scalar.
+// Halves are rounded away from zero. The optional scalar argument is the positive number
+// to round to the nearest multiple of, like PromQL's round(v, to_nearest), e.g. 0.01 or 10.
+// NaN and Inf values are returned as they are.
+func round(e *State, varSet Results, nearest ...Results) (Results, error) {
+	roundF := math.Round
+	if len(nearest) > 0 {
+		n, err := scalarArg(nearest[0])
+		if err != nil {
+			return Results{}, fmt.Errorf("round: %w", err)
+		}
+		if n <= 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			return Results{}, fmt.Errorf("round: the value to round to the nearest multiple of must be a positive number, got %v, e.g. 0.01 rounds to 2 decimal places", n)
+		}
+		// Like PromQL, multiply by the inverse so that e.g. round(x, 0.1) gives exact tenths.
+		inverse := 1 / n
+		roundF = func(f float64) float64 {
+			return math.Round(f*inverse) / inverse
+		}
+	}
 	newRes := Results{}
 	for _, res := range varSet.Values {
-		newVal, err := perFloat(e, res, math.Round)
+		newVal, err := perFloat(e, res, roundF)
 		if err != nil {
 			return newRes, err
 		}
@@ -307,3 +410,191 @@ func floor(e *State, varSet Results) (Results, error) {
 	}
 	return newRes, nil
 }
+
+// clamp bounds the value for each result in NumberSet, SeriesSet, or Scalar to [min, max].
+// NaN values stay NaN.
+func clamp(e *State, varSet Results, minArg, maxArg Results) (Results, error) {
+	lower, err := scalarArg(minArg)
+	if err != nil {
+		return Results{}, fmt.Errorf("clamp: %w", err)
+	}
+	upper, err := scalarArg(maxArg)
+	if err != nil {
+		return Results{}, fmt.Errorf("clamp: %w", err)
+	}
+	if lower > upper {
+		return Results{}, fmt.Errorf("clamp: min %v is greater than max %v", lower, upper)
+	}
+	return perFloatResults(e, varSet, func(f float64) float64 {
+		return math.Min(math.Max(f, lower), upper)
+	})
+}
+
+// clampMin bounds the value for each result in NumberSet, SeriesSet, or Scalar to be at
+// least min. NaN values stay NaN.
+func clampMin(e *State, varSet Results, minArg Results) (Results, error) {
+	lower, err := scalarArg(minArg)
+	if err != nil {
+		return Results{}, fmt.Errorf("clamp_min: %w", err)
+	}
+	return perFloatResults(e, varSet, func(f float64) float64 {
+		return math.Max(f, lower)
+	})
+}
+
+// clampMax bounds the value for each result in NumberSet, SeriesSet, or Scalar to be at
+// most max. NaN values stay NaN.
+func clampMax(e *State, varSet Results, maxArg Results) (Results, error) {
+	upper, err := scalarArg(maxArg)
+	if err != nil {
+		return Results{}, fmt.Errorf("clamp_max: %w", err)
+	}
+	return perFloatResults(e, varSet, func(f float64) float64 {
+		return math.Min(f, upper)
+	})
+}
+
+// perFloatResults applies floatF to each result of varSet, see perFloat.
+func perFloatResults(e *State, varSet Results, floatF func(x float64) float64) (Results, error) {
+	newRes := Results{}
+	for _, res := range varSet.Values {
+		newVal, err := perFloat(e, res, floatF)
+		if err != nil {
+			return newRes, err
+		}
+		newRes.Values = append(newRes.Values, newVal)
+	}
+	return newRes, nil
+}
+
+// timestamp returns for each result in SeriesSet a series whose values are the times of
+// its points, in seconds since the Unix epoch. Numbers and scalars have no time, so their
+// value is NaN.
+func timestamp(e *State, varSet Results) (Results, error) {
+	newRes := Results{}
+	for _, res := range varSet.Values {
+		s, ok := res.(Series)
+		if !ok {
+			newVal, err := perFloat(e, res, func(float64) float64 { return math.NaN() })
+			if err != nil {
+				return newRes, err
+			}
+			newRes.Values = append(newRes.Values, newVal)
+			continue
+		}
+		newSeries := NewSeries(e.RefID, s.GetLabels(), s.Len())
+		for i := 0; i < s.Len(); i++ {
+			t := s.GetTime(i)
+			f := float64(t.UnixNano()) / float64(time.Second)
+			newSeries.SetPoint(i, t, &f)
+		}
+		newRes.Values = append(newRes.Values, newSeries)
+	}
+	return newRes, nil
+}
+
+// deriv returns for each result in SeriesSet the per-second derivative of its values: the
+// value of each point is the difference between its value and the value of the previous
+// point, divided by the seconds between them. Unlike rate, the series is not assumed to be
+// a counter. Null and NaN points are skipped when looking for the previous point, and the
+// derivative of the first point, and of null and NaN points, is NaN. Numbers and scalars
+// have no time, so their value is NaN.
+func deriv(e *State, varSet Results) (Results, error) {
+	newRes := Results{}
+	for _, res := range varSet.Values {
+		s, ok := res.(Series)
+		if !ok {
+			newVal, err := perFloat(e, res, func(float64) float64 { return math.NaN() })
+			if err != nil {
+				return newRes, err
+			}
+			newRes.Values = append(newRes.Values, newVal)
+			continue
+		}
+		newSeries := NewSeries(e.RefID, s.GetLabels(), s.Len())
+		var prevTime time.Time
+		var prev *float64
+		for i := 0; i < s.Len(); i++ {
+			t, f := s.GetPoint(i)
+			d := math.NaN()
+			if f != nil && !math.IsNaN(*f) {
+				if prev != nil && t.After(prevTime) {
+					d = (*f - *prev) / t.Sub(prevTime).Seconds()
+				}
+				prevTime, prev = t, f
+			}
+			newSeries.SetPoint(i, t, &d)
+		}
+		newRes.Values = append(newRes.Values, newSeries)
+	}
+	return newRes, nil
+}
+
+// withDefault returns the NumberSet, SeriesSet, or Scalar unchanged. When it is the operand
+// of a binary operation, the values of the other operand that have no matching labels in it
+// are kept and combined with the default value instead of being dropped. See State.walkBinary.
+func withDefault(e *State, varSet Results, _ Results) (Results, error) {
+	return varSet, nil
+}
+
+// labelReplace sets the dst label of each result in NumberSet or SeriesSet to the replacement
+// expanded with the capture groups of regex matched against the value of the src label, like
+// PromQL's label_replace. The regex is anchored and a missing src label matches as an empty
+// value. If the expanded replacement is empty the dst label is removed. Results whose src label
+// does not match the regex are returned unchanged.
+func labelReplace(e *State, varSet Results, dst, replacement, src, regex string) (Results, error) {
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return Results{}, fmt.Errorf("label_replace: invalid regex %q: %w", regex, err)
+	}
+	newRes := Results{}
+	for _, res := range varSet.Values {
+		labels := res.GetLabels()
+		matches := re.FindStringSubmatchIndex(labels[src])
+		if matches == nil {
+			newRes.Values = append(newRes.Values, res)
+			continue
+		}
+		newVal, err := perNullableFloat(e, res, func(f *float64) *float64 { return f })
+		if err != nil {
+			return newRes, err
+		}
+		newLabels := labels.Copy()
+		value := re.ExpandString(nil, replacement, labels[src], matches)
+		if len(value) == 0 {
+			delete(newLabels, dst)
+		} else {
+			newLabels[dst] = string(value)
+		}
+		newVal.SetLabels(newLabels)
+		newRes.Values = append(newRes.Values, newVal)
+	}
+	return newRes, nil
+}
+
+func labelReplaceCheck(t *parse.Tree, f *parse.FuncNode) error {
+	if dst := f.Args[1].(*parse.StringNode).Text; dst == "" {
+		return fmt.Errorf("label_replace: destination label must not be empty")
+	}
+	regex := f.Args[4].(*parse.StringNode).Text
+	if _, err := regexp.Compile("^(?:" + regex + ")$"); err != nil {
+		return fmt.Errorf("label_replace: invalid regex %q: %w", regex, err)
+	}
+	return nil
+}
+
+// scalarArg returns the value of a scalar function argument.
+func scalarArg(res Results) (float64, error) {
+	if len(res.Values) != 1 {
+		return 0, fmt.Errorf("expected a single scalar argument, got %d values", len(res.Values))
+	}
+	s, ok := res.Values[0].(Scalar)
+	if !ok {
+		return 0, fmt.Errorf("expected a scalar argument, got %v", res.Values[0].Type())
+	}
+	f := s.GetFloat64Value()
+	if f == nil {
+		return 0, fmt.Errorf("expected a scalar argument, got null")
+	}
+	return *f, nil
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/require"
 )
 
@@ -159,3 +161,650 @@ func TestIsNumberFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestWithDefaultFunc(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(2)),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(10)),
+				makeNumber("", data.Labels{"host": "c"}, float64Pointer(20)),
+			},
+		},
+		"C": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(3)},
+					tp{time.Unix(10, 0), nil}),
+			},
+		},
+	}
+
+	var tests = []struct {
+		name    string
+		expr    string
+		results Results
+	}{
+		{
+			name: "without default unmatched values are dropped",
+			expr: "$A + $B",
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(12)),
+			}},
+		},
+		{
+			name: "default on the right keeps unmatched values of the left",
+			expr: "$A + with_default($B, 0)",
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(12)),
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+			}},
+		},
+		{
+			name: "default on the left keeps unmatched values of the right",
+			expr: "with_default($A, 100) - $B",
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(-8)),
+				makeNumber("", data.Labels{"host": "c"}, float64Pointer(80)),
+			}},
+		},
+		{
+			name: "defaults on both sides keep all values",
+			expr: "with_default($A, 0) + with_default($B, 0)",
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(12)),
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "c"}, float64Pointer(20)),
+			}},
+		},
+		{
+			name: "default is used when the other side has no values",
+			expr: "$C * with_default($D, 2)",
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(6)},
+					tp{time.Unix(10, 0), nil}),
+			}},
+		},
+		{
+			name: "with_default alone returns its input",
+			expr: "with_default($A, 0)",
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(2)),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			require.NoError(t, err)
+			res, err := e.Execute("", vars)
+			require.NoError(t, err)
+			require.Equal(t, tt.results, res)
+		})
+	}
+}
+
+func TestIsNaNIsInfFunc(t *testing.T) {
+	input := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(5)},
+					tp{time.Unix(10, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(15, 0), float64Pointer(math.Inf(1))},
+					tp{time.Unix(20, 0), float64Pointer(math.Inf(-1))},
+					tp{time.Unix(25, 0), float64Pointer(-0.5)}),
+			},
+		},
+	}
+	var tests = []struct {
+		name    string
+		expr    string
+		results Results
+	}{
+		{
+			name: "is_nan on series",
+			expr: "is_nan($A)",
+			results: Results{
+				[]Value{
+					makeSeries("", data.Labels{"host": "a"},
+						tp{time.Unix(5, 0), float64Pointer(0)},
+						tp{time.Unix(10, 0), float64Pointer(1)},
+						tp{time.Unix(15, 0), float64Pointer(0)},
+						tp{time.Unix(20, 0), float64Pointer(0)},
+						tp{time.Unix(25, 0), float64Pointer(0)}),
+				},
+			},
+		},
+		{
+			name: "is_inf on series",
+			expr: "is_inf($A)",
+			results: Results{
+				[]Value{
+					makeSeries("", data.Labels{"host": "a"},
+						tp{time.Unix(5, 0), float64Pointer(0)},
+						tp{time.Unix(10, 0), float64Pointer(0)},
+						tp{time.Unix(15, 0), float64Pointer(1)},
+						tp{time.Unix(20, 0), float64Pointer(1)},
+						tp{time.Unix(25, 0), float64Pointer(0)}),
+				},
+			},
+		},
+		{
+			name: "is_number on series",
+			expr: "is_number($A)",
+			results: Results{
+				[]Value{
+					makeSeries("", data.Labels{"host": "a"},
+						tp{time.Unix(5, 0), float64Pointer(1)},
+						tp{time.Unix(10, 0), float64Pointer(0)},
+						tp{time.Unix(15, 0), float64Pointer(0)},
+						tp{time.Unix(20, 0), float64Pointer(0)},
+						tp{time.Unix(25, 0), float64Pointer(1)}),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			require.NoError(t, err)
+			res, err := e.Execute("", input)
+			require.NoError(t, err)
+			require.Equal(t, tt.results, res)
+		})
+	}
+}
+
+func TestRoundFunc(t *testing.T) {
+	var tests = []struct {
+		name     string
+		expr     string
+		vars     Vars
+		newErrIs require.ErrorAssertionFunc
+		// execErrIs is the expected error of the execution, when it is not NoError.
+		execErrIs require.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:     "round half away from zero on scalar",
+			expr:     "round(2.5)",
+			newErrIs: require.NoError,
+			results:  Results{[]Value{NewScalar("", float64Pointer(3))}},
+		},
+		{
+			name:     "round negative half away from zero on scalar",
+			expr:     "round(-2.5)",
+			newErrIs: require.NoError,
+			results:  Results{[]Value{NewScalar("", float64Pointer(-3))}},
+		},
+		{
+			name:     "round scalar to the nearest hundredth",
+			expr:     "round(1.125, 0.01)",
+			newErrIs: require.NoError,
+			results:  Results{[]Value{NewScalar("", float64Pointer(1.13))}},
+		},
+		{
+			name:     "round scalar to the nearest hundred",
+			expr:     "round(1250, 100)",
+			newErrIs: require.NoError,
+			results:  Results{[]Value{NewScalar("", float64Pointer(1300))}},
+		},
+		{
+			name: "round number to the nearest tenth",
+			expr: "round($A, 0.1)",
+			vars: Vars{
+				"A": Results{[]Value{makeNumber("", nil, float64Pointer(-7.25))}},
+			},
+			newErrIs: require.NoError,
+			results:  Results{[]Value{makeNumber("", nil, float64Pointer(-7.3))}},
+		},
+		{
+			name: "round series to the nearest half",
+			expr: "round($A, 0.5)",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", data.Labels{"host": "a"},
+						tp{time.Unix(5, 0), float64Pointer(7.3)},
+						tp{time.Unix(10, 0), float64Pointer(-7.3)},
+						tp{time.Unix(15, 0), float64Pointer(-7.2)},
+						tp{time.Unix(20, 0), float64Pointer(-0.25)},
+						tp{time.Unix(25, 0), float64Pointer(math.Inf(-1))}),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(7.5)},
+					tp{time.Unix(10, 0), float64Pointer(-7.5)},
+					tp{time.Unix(15, 0), float64Pointer(-7)},
+					tp{time.Unix(20, 0), float64Pointer(-0.5)},
+					tp{time.Unix(25, 0), float64Pointer(math.Inf(-1))}),
+			}},
+		},
+		{
+			name: "round series keeps NaN",
+			expr: "round($A, 0.1)",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", nil,
+						tp{time.Unix(5, 0), float64Pointer(-1.25)},
+						tp{time.Unix(10, 0), float64Pointer(math.NaN())},
+						tp{time.Unix(15, 0), float64Pointer(3.04)}),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", nil,
+					tp{time.Unix(5, 0), float64Pointer(-1.3)},
+					tp{time.Unix(10, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(15, 0), float64Pointer(3)}),
+			}},
+		},
+		{
+			name: "round to the nearest multiple of 2",
+			expr: "round($A, 2)",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", nil,
+						tp{time.Unix(5, 0), float64Pointer(7.3)},
+						tp{time.Unix(10, 0), float64Pointer(-7.25)},
+						tp{time.Unix(15, 0), float64Pointer(1.125)}),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", nil,
+					tp{time.Unix(5, 0), float64Pointer(8)},
+					tp{time.Unix(10, 0), float64Pointer(-8)},
+					tp{time.Unix(15, 0), float64Pointer(2)}),
+			}},
+		},
+		{
+			name:     "round to the nearest multiple of a negative number should error",
+			expr:     "round(1250, -2)",
+			newErrIs: require.NoError,
+			execErrIs: func(t require.TestingT, err error, _ ...interface{}) {
+				require.ErrorContains(t, err, "e.g. 0.01 rounds to 2 decimal places")
+			},
+		},
+		{
+			name:      "round to the nearest multiple of 0 should error",
+			expr:      "round(1.5, 0)",
+			newErrIs:  require.NoError,
+			execErrIs: require.Error,
+		},
+		{
+			name:     "round with too many arguments should error",
+			expr:     "round(1, 2, 3)",
+			newErrIs: require.Error,
+		},
+		{
+			name:     "round to the nearest multiple of a series should error",
+			expr:     "round(1, $A)",
+			newErrIs: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			tt.newErrIs(t, err)
+			if e != nil {
+				res, err := e.Execute("", tt.vars)
+				if tt.execErrIs != nil {
+					tt.execErrIs(t, err)
+					return
+				}
+				require.NoError(t, err)
+				requireResultsEqual(t, tt.results, res)
+			}
+		})
+	}
+}
+
+// requireResultsEqual compares results treating NaN values as equal.
+func requireResultsEqual(t *testing.T, expected, actual Results) {
+	t.Helper()
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	})
+	options := append([]cmp.Option{opt}, data.FrameTestCompareOptions()...)
+	if diff := cmp.Diff(expected, actual, options...); diff != "" {
+		t.Errorf("Result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLabelReplaceFunc(t *testing.T) {
+	var tests = []struct {
+		name     string
+		expr     string
+		vars     Vars
+		newErrIs require.ErrorAssertionFunc
+		results  Results
+	}{
+		{
+			name: "capture groups are expanded into destination label",
+			expr: `label_replace($A, "service", "$1-$2", "instance", "(.*):(\\d+)")`,
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", data.Labels{"instance": "web:8080"}, tp{time.Unix(5, 0), float64Pointer(1)}),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"instance": "web:8080", "service": "web-8080"}, tp{time.Unix(5, 0), float64Pointer(1)}),
+			}},
+		},
+		{
+			name: "existing destination label is overwritten on number",
+			expr: `label_replace($A, "host", "${1}", "host", "([^.]+)\\..*")`,
+			vars: Vars{
+				"A": Results{[]Value{
+					makeNumber("", data.Labels{"host": "a.example.com"}, float64Pointer(2)),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(2)),
+			}},
+		},
+		{
+			name: "series without matching source label are passed through",
+			expr: `label_replace($A, "service", "$1", "instance", "(.*):8080")`,
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("A", data.Labels{"instance": "web:9090"}, tp{time.Unix(5, 0), float64Pointer(1)}),
+					makeSeries("A", data.Labels{"job": "api"}, tp{time.Unix(5, 0), float64Pointer(2)}),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("A", data.Labels{"instance": "web:9090"}, tp{time.Unix(5, 0), float64Pointer(1)}),
+				makeSeries("A", data.Labels{"job": "api"}, tp{time.Unix(5, 0), float64Pointer(2)}),
+			}},
+		},
+		{
+			name: "brand new label is created from constant replacement",
+			expr: `label_replace($A, "env", "prod", "", "")`,
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", nil, tp{time.Unix(5, 0), float64Pointer(1)}),
+				}},
+			},
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"env": "prod"}, tp{time.Unix(5, 0), float64Pointer(1)}),
+			}},
+		},
+		{
+			name:     "invalid regex should error",
+			expr:     `label_replace($A, "dst", "$1", "src", "(.*")`,
+			newErrIs: require.Error,
+		},
+		{
+			name:     "empty destination label should error",
+			expr:     `label_replace($A, "", "$1", "src", "(.*)")`,
+			newErrIs: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			tt.newErrIs(t, err)
+			if e != nil {
+				res, err := e.Execute("", tt.vars)
+				require.NoError(t, err)
+				requireResultsEqual(t, tt.results, res)
+			}
+		})
+	}
+}
+
+func TestMinMaxFunc(t *testing.T) {
+	nan := math.NaN()
+	vars := Vars{
+		"A": Results{[]Value{
+			makeSeries("A", data.Labels{"host": "a"},
+				tp{time.Unix(5, 0), float64Pointer(1)},
+				tp{time.Unix(10, 0), float64Pointer(nan)},
+				tp{time.Unix(15, 0), float64Pointer(nan)},
+			),
+		}},
+		"B": Results{[]Value{
+			makeSeries("B", data.Labels{"host": "a"},
+				tp{time.Unix(5, 0), float64Pointer(3)},
+				tp{time.Unix(10, 0), float64Pointer(2)},
+				tp{time.Unix(15, 0), float64Pointer(nan)},
+			),
+		}},
+		"C": Results{[]Value{
+			makeSeries("C", data.Labels{"host": "a"},
+				tp{time.Unix(5, 0), float64Pointer(0)},
+				tp{time.Unix(10, 0), float64Pointer(5)},
+				tp{time.Unix(15, 0), float64Pointer(4)},
+			),
+		}},
+		"N": Results{[]Value{
+			makeNumber("N", data.Labels{"host": "a"}, float64Pointer(2.5)),
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		newErrIs require.ErrorAssertionFunc
+		results  Results
+	}{
+		{
+			name:     "min of two series skips NaN unless all are NaN",
+			expr:     "min($A, $B)",
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(1)},
+					tp{time.Unix(10, 0), float64Pointer(2)},
+					tp{time.Unix(15, 0), float64Pointer(nan)},
+				),
+			}},
+		},
+		{
+			name:     "max of three series",
+			expr:     "max($A, $B, $C)",
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(3)},
+					tp{time.Unix(10, 0), float64Pointer(5)},
+					tp{time.Unix(15, 0), float64Pointer(4)},
+				),
+			}},
+		},
+		{
+			name:     "min of series, number and scalar",
+			expr:     "min($C, $N, 3)",
+			newErrIs: require.NoError,
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(0)},
+					tp{time.Unix(10, 0), float64Pointer(2.5)},
+					tp{time.Unix(15, 0), float64Pointer(2.5)},
+				),
+			}},
+		},
+		{
+			name:     "max of scalars",
+			expr:     "max(1, 4, 2)",
+			newErrIs: require.NoError,
+			results:  Results{[]Value{NewScalar("", float64Pointer(4))}},
+		},
+		{
+			name:     "a single argument should error",
+			expr:     "min($A)",
+			newErrIs: require.Error,
+		},
+		{
+			name:     "a string argument should error",
+			expr:     `max($A, "hi")`,
+			newErrIs: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			tt.newErrIs(t, err)
+			if e != nil {
+				res, err := e.Execute("", vars)
+				require.NoError(t, err)
+				requireResultsEqual(t, tt.results, res)
+			}
+		})
+	}
+}
+
+func TestTimestampFunc(t *testing.T) {
+	var tests = []struct {
+		name    string
+		expr    string
+		vars    Vars
+		results Results
+	}{
+		{
+			name: "series values are the times of its points",
+			expr: "timestamp($A)",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", data.Labels{"host": "a"},
+						tp{time.Unix(5, 0), float64Pointer(1)},
+						tp{time.Unix(10, 0), nil},
+						tp{time.Unix(15, 500000000), float64Pointer(math.NaN())}),
+				}},
+			},
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(5, 0), float64Pointer(5)},
+					tp{time.Unix(10, 0), float64Pointer(10)},
+					tp{time.Unix(15, 500000000), float64Pointer(15.5)}),
+			}},
+		},
+		{
+			name: "time since the last point",
+			expr: "1700000060 - timestamp($A)",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", nil, tp{time.Unix(1700000000, 0), float64Pointer(1)}),
+				}},
+			},
+			results: Results{[]Value{
+				makeSeries("", nil, tp{time.Unix(1700000000, 0), float64Pointer(60)}),
+			}},
+		},
+		{
+			name: "numbers have no time",
+			expr: "timestamp($A)",
+			vars: Vars{
+				"A": Results{[]Value{makeNumber("", data.Labels{"host": "a"}, float64Pointer(1))}},
+			},
+			results: Results{[]Value{makeNumber("", data.Labels{"host": "a"}, float64Pointer(math.NaN()))}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			require.NoError(t, err)
+			res, err := e.Execute("", tt.vars)
+			require.NoError(t, err)
+			requireResultsEqual(t, tt.results, res)
+		})
+	}
+}
+
+func TestDerivFunc(t *testing.T) {
+	var tests = []struct {
+		name    string
+		vars    Vars
+		results Results
+	}{
+		{
+			name: "linearly increasing series has a constant derivative",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", data.Labels{"host": "a"},
+						tp{time.Unix(0, 0), float64Pointer(10)},
+						tp{time.Unix(10, 0), float64Pointer(30)},
+						tp{time.Unix(20, 0), float64Pointer(50)},
+						tp{time.Unix(30, 0), float64Pointer(70)}),
+				}},
+			},
+			results: Results{[]Value{
+				makeSeries("", data.Labels{"host": "a"},
+					tp{time.Unix(0, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(10, 0), float64Pointer(2)},
+					tp{time.Unix(20, 0), float64Pointer(2)},
+					tp{time.Unix(30, 0), float64Pointer(2)}),
+			}},
+		},
+		{
+			name: "noisy series sampled irregularly",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", nil,
+						tp{time.Unix(0, 0), float64Pointer(5)},
+						tp{time.Unix(2, 0), float64Pointer(9)},
+						tp{time.Unix(10, 0), float64Pointer(1)},
+						tp{time.Unix(15, 0), float64Pointer(1)},
+						tp{time.Unix(15, 500000000), float64Pointer(4)}),
+				}},
+			},
+			results: Results{[]Value{
+				makeSeries("", nil,
+					tp{time.Unix(0, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(2, 0), float64Pointer(2)},
+					tp{time.Unix(10, 0), float64Pointer(-1)},
+					tp{time.Unix(15, 0), float64Pointer(0)},
+					tp{time.Unix(15, 500000000), float64Pointer(6)}),
+			}},
+		},
+		{
+			name: "null and NaN points are skipped",
+			vars: Vars{
+				"A": Results{[]Value{
+					makeSeries("", nil,
+						tp{time.Unix(0, 0), float64Pointer(1)},
+						tp{time.Unix(10, 0), nil},
+						tp{time.Unix(20, 0), float64Pointer(math.NaN())},
+						tp{time.Unix(30, 0), float64Pointer(7)}),
+				}},
+			},
+			results: Results{[]Value{
+				makeSeries("", nil,
+					tp{time.Unix(0, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(10, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(20, 0), float64Pointer(math.NaN())},
+					tp{time.Unix(30, 0), float64Pointer(0.2)}),
+			}},
+		},
+		{
+			name: "numbers have no time",
+			vars: Vars{
+				"A": Results{[]Value{makeNumber("", nil, float64Pointer(1))}},
+			},
+			results: Results{[]Value{makeNumber("", nil, float64Pointer(math.NaN()))}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New("deriv($A)")
+			require.NoError(t, err)
+			res, err := e.Execute("", tt.vars)
+			require.NoError(t, err)
+			requireResultsEqual(t, tt.results, res)
+		})
+	}
+}
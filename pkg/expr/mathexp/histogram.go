@@ -0,0 +1,155 @@
+package mathexp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// bucketLabel is the label holding the upper bound of a histogram bucket.
+const bucketLabel = "le"
+
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// histogramQuantile calculates the q-quantile (0 <= q <= 1) from the buckets of one or more
+// histograms, like PromQL's histogram_quantile. Each Number or Series in varSet is a bucket and
+// must have an "le" label with the upper bound of the bucket, values without one are ignored.
+// Series are taken as the count of their last point. The buckets are grouped by their labels
+// other than "le" and a Number is returned for each group.
+//
+// The quantile is interpolated linearly within the bucket it falls into. A group without a +Inf
+// bucket or without observations has a NaN quantile. Bucket counts that decrease with the upper
+// bound are raised to the count of the previous bucket.
+func histogramQuantile(e *State, qArg Results, varSet Results) (Results, error) {
+	q, err := scalarArg(qArg)
+	if err != nil {
+		return Results{}, fmt.Errorf("histogram_quantile: %w", err)
+	}
+
+	type group struct {
+		labels  data.Labels
+		buckets []bucket
+	}
+	var groups []*group
+	groupsByKey := make(map[string]*group)
+
+	for _, val := range varSet.Values {
+		var f *float64
+		switch v := val.(type) {
+		case Number:
+			f = v.GetFloat64Value()
+		case Series:
+			if v.Len() == 0 {
+				continue
+			}
+			_, f = v.GetPoint(v.Len() - 1)
+		default:
+			continue
+		}
+		le, ok := val.GetLabels()[bucketLabel]
+		if !ok {
+			continue
+		}
+		upperBound, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			continue
+		}
+
+		labels := val.GetLabels().Copy()
+		delete(labels, bucketLabel)
+		key := labels.String()
+		g, ok := groupsByKey[key]
+		if !ok {
+			g = &group{labels: labels}
+			groupsByKey[key] = g
+			groups = append(groups, g)
+		}
+		count := math.NaN()
+		if f != nil {
+			count = *f
+		}
+		g.buckets = append(g.buckets, bucket{upperBound: upperBound, count: count})
+	}
+
+	newRes := Results{Values: make([]Value, 0, len(groups))}
+	for _, g := range groups {
+		n := NewNumber(e.RefID, g.labels)
+		v := bucketQuantile(q, g.buckets)
+		n.SetValue(&v)
+		newRes.Values = append(newRes.Values, n)
+	}
+	return newRes, nil
+}
+
+// bucketQuantile calculates the q-quantile of the cumulative counts of buckets.
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	switch {
+	case math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].upperBound < buckets[j].upperBound
+	})
+	if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].upperBound, 1) {
+		return math.NaN()
+	}
+
+	// Merge buckets with the same upper bound and make the counts monotonic.
+	merged := buckets[:1]
+	for _, b := range buckets[1:] {
+		last := &merged[len(merged)-1]
+		if b.upperBound == last.upperBound {
+			last.count += b.count
+			continue
+		}
+		merged = append(merged, b)
+	}
+	for i := range merged {
+		var previous float64
+		if i > 0 {
+			previous = merged[i-1].count
+		}
+		if math.IsNaN(merged[i].count) || merged[i].count < previous {
+			merged[i].count = previous
+		}
+	}
+	if len(merged) < 2 {
+		return math.NaN()
+	}
+
+	observations := merged[len(merged)-1].count
+	if observations == 0 {
+		return math.NaN()
+	}
+	rank := q * observations
+	b := sort.Search(len(merged)-1, func(i int) bool { return merged[i].count >= rank })
+
+	if b == len(merged)-1 {
+		// The quantile falls into the +Inf bucket, return the highest finite upper bound.
+		return merged[len(merged)-2].upperBound
+	}
+	if b == 0 && merged[0].upperBound <= 0 {
+		return merged[0].upperBound
+	}
+
+	var bucketStart float64
+	bucketEnd := merged[b].upperBound
+	count := merged[b].count
+	if b > 0 {
+		bucketStart = merged[b-1].upperBound
+		count -= merged[b-1].count
+		rank -= merged[b-1].count
+	}
+	return bucketStart + (bucketEnd-bucketStart)*(rank/count)
+}
@@ -0,0 +1,127 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := func(labels data.Labels, counts map[string]float64) []Value {
+		var vals []Value
+		for le, count := range counts {
+			l := labels.Copy()
+			l["le"] = le
+			vals = append(vals, makeNumber("A", l, float64Pointer(count)))
+		}
+		return vals
+	}
+	api := buckets(data.Labels{"job": "api"}, map[string]float64{"0.1": 50, "0.5": 80, "1": 95, "+Inf": 100})
+
+	var tests = []struct {
+		name     string
+		expr     string
+		vals     []Value
+		expected map[string]float64 // quantile by labels of the group
+	}{
+		{
+			name:     "quantile in the first bucket",
+			expr:     "histogram_quantile(0.5, $A)",
+			vals:     api,
+			expected: map[string]float64{"job=api": 0.1},
+		},
+		{
+			name:     "quantile is interpolated within the bucket",
+			expr:     "histogram_quantile(0.65, $A)",
+			vals:     api,
+			expected: map[string]float64{"job=api": 0.3},
+		},
+		{
+			name:     "quantile in the +Inf bucket is the highest finite upper bound",
+			expr:     "histogram_quantile(0.99, $A)",
+			vals:     api,
+			expected: map[string]float64{"job=api": 1},
+		},
+		{
+			name: "buckets are grouped by labels other than le",
+			expr: "histogram_quantile(0.9, $A)",
+			vals: append(buckets(data.Labels{"job": "web"}, map[string]float64{"0.5": 0, "1": 10, "+Inf": 10}), api...),
+			expected: map[string]float64{
+				"job=web": 0.95,
+				"job=api": 0.5 + 0.5*10/15,
+			},
+		},
+		{
+			name:     "non monotonic buckets are made monotonic",
+			expr:     "histogram_quantile(0.5, $A)",
+			vals:     buckets(data.Labels{"job": "api"}, map[string]float64{"0.1": 50, "0.5": 40, "1": 100, "+Inf": 100}),
+			expected: map[string]float64{"job=api": 0.1},
+		},
+		{
+			name:     "missing +Inf bucket is NaN",
+			expr:     "histogram_quantile(0.5, $A)",
+			vals:     buckets(data.Labels{"job": "api"}, map[string]float64{"0.1": 50, "0.5": 80}),
+			expected: map[string]float64{"job=api": math.NaN()},
+		},
+		{
+			name:     "no observations is NaN",
+			expr:     "histogram_quantile(0.5, $A)",
+			vals:     buckets(data.Labels{"job": "api"}, map[string]float64{"0.1": 0, "+Inf": 0}),
+			expected: map[string]float64{"job=api": math.NaN()},
+		},
+		{
+			name: "series use the count of their last point",
+			expr: "histogram_quantile(0.5, $A)",
+			vals: []Value{
+				makeSeries("A", data.Labels{"le": "1"},
+					tp{time.Unix(5, 0), float64Pointer(100)},
+					tp{time.Unix(10, 0), float64Pointer(5)}),
+				makeSeries("A", data.Labels{"le": "+Inf"},
+					tp{time.Unix(5, 0), float64Pointer(100)},
+					tp{time.Unix(10, 0), float64Pointer(10)}),
+			},
+			expected: map[string]float64{"": 1},
+		},
+		{
+			name:     "values without le label are ignored",
+			expr:     "histogram_quantile(0.5, $A)",
+			vals:     append(buckets(nil, map[string]float64{"1": 10, "+Inf": 10}), makeNumber("A", data.Labels{"job": "api"}, float64Pointer(3))),
+			expected: map[string]float64{"": 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			require.NoError(t, err)
+			res, err := e.Execute("B", Vars{"A": Results{tt.vals}})
+			require.NoError(t, err)
+
+			actual := make(map[string]float64)
+			for _, v := range res.Values {
+				n, ok := v.(Number)
+				require.True(t, ok, "expected a Number, got %T", v)
+				require.NotNil(t, n.GetFloat64Value())
+				actual[n.GetLabels().String()] = *n.GetFloat64Value()
+			}
+			require.Len(t, actual, len(tt.expected))
+			for labels, expected := range tt.expected {
+				require.Contains(t, actual, labels)
+				if math.IsNaN(expected) {
+					require.True(t, math.IsNaN(actual[labels]), "expected NaN for %s, got %v", labels, actual[labels])
+					continue
+				}
+				require.InDelta(t, expected, actual[labels], 1e-9, labels)
+			}
+		})
+	}
+}
+
+func TestHistogramQuantileOutOfRange(t *testing.T) {
+	require.True(t, math.IsInf(bucketQuantile(-0.5, []bucket{{1, 1}, {math.Inf(1), 1}}), -1))
+	require.True(t, math.IsInf(bucketQuantile(1.5, []bucket{{1, 1}, {math.Inf(1), 1}}), 1))
+	require.True(t, math.IsNaN(bucketQuantile(math.NaN(), []bucket{{1, 1}, {math.Inf(1), 1}})))
+}
@@ -56,8 +56,10 @@ const (
 	itemRightParen
 	itemString
 	itemFunc
-	itemVar // e.g. $A
-	itemPow // '**'
+	itemVar      // e.g. $A
+	itemPow      // '**'
+	itemQuestion // '?'
+	itemColon    // ':'
 )
 
 const eof = -1
@@ -190,6 +192,10 @@ Loop:
 			return lexString
 		case r == ',':
 			l.emit(itemComma)
+		case r == '?':
+			l.emit(itemQuestion)
+		case r == ':':
+			l.emit(itemColon)
 		case isSpace(r):
 			l.ignore()
 		case r == eof:
@@ -296,8 +302,7 @@ func lexVar(l *lexer) stateFn {
 				if !hasChar {
 					return l.errorf("incomplete variable")
 				}
-				l.emit(itemVar)
-				return lexItem
+				return lexVarSelector
 			case r == eof:
 				return l.errorf("unterminated variable missing closing }")
 			case isVarchar(r) || isSpace(r):
@@ -318,12 +323,34 @@ func lexVar(l *lexer) stateFn {
 				return l.errorf("incomplete variable")
 			}
 			l.backup()
-			l.emit(itemVar)
-			return lexItem
+			return lexVarSelector
 		}
 	}
 }
 
+// lexVarSelector scans the optional label selector following the name of a variable,
+// e.g. {job="api"}, as part of the variable. The selector is parsed by the parser.
+func lexVarSelector(l *lexer) stateFn {
+	if l.peek() == '{' {
+		inString := false
+		for {
+			switch r := l.next(); {
+			case r == eof:
+				return l.errorf("unterminated label selector missing closing }")
+			case inString && r == '\\':
+				_ = l.next()
+			case r == '"':
+				inString = !inString
+			case r == '}' && !inString:
+				l.emit(itemVar)
+				return lexItem
+			}
+		}
+	}
+	l.emit(itemVar)
+	return lexItem
+}
+
 func lexString(l *lexer) stateFn {
 	for {
 		switch l.next() {
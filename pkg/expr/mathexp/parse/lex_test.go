@@ -33,6 +33,8 @@ var itemName = map[itemType]string{
 	itemRightParen: ")",
 	itemString:     "string",
 	itemFunc:       "func",
+	itemQuestion:   "?",
+	itemColon:      ":",
 }
 
 func (i itemType) String() string {
@@ -113,6 +115,26 @@ var lexTests = []lexTest{
 		{itemVar, 0, "$A"},
 		tEOF,
 	}},
+	{"ternary", "$A > 1 ? 1 : 0", []item{
+		{itemVar, 0, "$A"},
+		tGt,
+		{itemNumber, 0, "1"},
+		{itemQuestion, 0, "?"},
+		{itemNumber, 0, "1"},
+		{itemColon, 0, ":"},
+		{itemNumber, 0, "0"},
+		tEOF,
+	}},
+	{"var with label selector", `$A{job="api", env!="dev"} * 2`, []item{
+		{itemVar, 0, `$A{job="api", env!="dev"}`},
+		tMult,
+		{itemNumber, 0, "2"},
+		tEOF,
+	}},
+	{"curly brace var with label selector", `${My Var}{path="/{id}"}`, []item{
+		{itemVar, 0, `${My Var}{path="/{id}"}`},
+		tEOF,
+	}},
 	// errors
 	{"unclosed quote", "\"", []item{
 		{itemError, 0, "unterminated string"},
@@ -126,6 +148,9 @@ var lexTests = []lexTest{
 	{"invalid curly var", "${adf sd", []item{
 		{itemError, 0, "unterminated variable missing closing }"},
 	}},
+	{"unclosed label selector", `$A{job="api"`, []item{
+		{itemError, 0, "unterminated label selector missing closing }"},
+	}},
 }
 
 // collect gathers the emitted items into a slice.
@@ -9,6 +9,7 @@ package parse
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // A Node is an element in the parse tree. The interface is trivial.
@@ -62,6 +63,8 @@ const (
 	NodeNumber
 	// NodeVar is variable: $A
 	NodeVar
+	// NodeTernary is a conditional: cond ? a : b
+	NodeTernary
 )
 
 // String returns the string representation of the NodeType
@@ -77,6 +80,8 @@ func (t NodeType) String() string {
 		return "NodeString"
 	case NodeNumber:
 		return "NodeNumber"
+	case NodeTernary:
+		return "NodeTernary"
 	default:
 		return "NodeUnknown"
 	}
@@ -90,6 +95,27 @@ type VarNode struct {
 	Pos
 	Name string // Without the $ or {}
 	Text string // Raw
+	// Selector holds the matchers of the optional label selector of the variable,
+	// e.g. $A{job="api"}. Only the values of the variable matching all of them are used.
+	Selector []LabelMatcher
+}
+
+// LabelMatcher matches the value of a label, e.g. job="api" or job!="api".
+type LabelMatcher struct {
+	Name   string
+	Value  string
+	Negate bool
+}
+
+// Matches reports whether labels match all the matchers of the selector of the variable.
+// Like in Prometheus, a missing label matches an empty value.
+func (n *VarNode) Matches(labels map[string]string) bool {
+	for _, m := range n.Selector {
+		if (labels[m.Name] == m.Value) == m.Negate {
+			return false
+		}
+	}
+	return true
 }
 
 func newVar(pos Pos, name, text string) *VarNode {
@@ -161,14 +187,17 @@ func (f *FuncNode) StringAST() string {
 
 // Check performs parse time checking on the FuncNode so it fulfills the Node interface.
 func (f *FuncNode) Check(t *Tree) error {
-	if len(f.Args) < len(f.F.Args) {
+	if len(f.Args) < len(f.F.Args)-f.F.OptionalArgs {
 		return fmt.Errorf("parse: not enough arguments for %s", f.Name)
-	} else if len(f.Args) > len(f.F.Args) {
+	} else if len(f.Args) > len(f.F.Args) && !f.F.Variadic {
 		return fmt.Errorf("parse: too many arguments for %s", f.Name)
 	}
 
 	for i, arg := range f.Args {
-		funcType := f.F.Args[i]
+		funcType := f.F.Args[len(f.F.Args)-1]
+		if i < len(f.F.Args) {
+			funcType = f.F.Args[i]
+		}
 		argType := arg.Return()
 		// if funcType == TypeNumberSet && argType == TypeScalar {
 		// 	argType = TypeNumberSet
@@ -298,6 +327,9 @@ type BinaryNode struct {
 	Args     [2]Node
 	Operator item
 	OpStr    string
+	// Matching is how the values of both arguments are matched. If nil, values are
+	// matched when the labels of one contain the labels of the other.
+	Matching *VectorMatching
 }
 
 func newBinary(operator item, arg1, arg2 Node) *BinaryNode {
@@ -306,11 +338,17 @@ func newBinary(operator item, arg1, arg2 Node) *BinaryNode {
 
 // String returns the string representation of the BinaryNode so it fulfills the Node interface.
 func (b *BinaryNode) String() string {
+	if b.Matching != nil {
+		return fmt.Sprintf("%s %s %s %s", b.Args[0], b.Operator.val, b.Matching, b.Args[1])
+	}
 	return fmt.Sprintf("%s %s %s", b.Args[0], b.Operator.val, b.Args[1])
 }
 
 // StringAST returns the string representation of abstract syntax tree of the BinaryNode so it fulfills the Node interface.
 func (b *BinaryNode) StringAST() string {
+	if b.Matching != nil {
+		return fmt.Sprintf("%s %s(%s, %s)", b.Operator.val, b.Matching, b.Args[0], b.Args[1])
+	}
 	return fmt.Sprintf("%s(%s, %s)", b.Operator.val, b.Args[0], b.Args[1])
 }
 
@@ -329,6 +367,62 @@ func (b *BinaryNode) Return() ReturnType {
 	return t0
 }
 
+// VectorMatchCardinality is the cardinality of the matching between the values
+// of the arguments of a binary operation.
+type VectorMatchCardinality int
+
+const (
+	// CardOneToOne matches each value of one side with at most one value of the other side.
+	CardOneToOne VectorMatchCardinality = iota
+	// CardManyToOne matches several values of the left side with one value of the right side.
+	CardManyToOne
+	// CardOneToMany matches one value of the left side with several values of the right side.
+	CardOneToMany
+)
+
+// VectorMatching describes how the values of the arguments of a binary operation are matched,
+// like the on, ignoring, group_left and group_right modifiers of PromQL binary operators.
+type VectorMatching struct {
+	// On is true if values are matched on Labels only, and false if they are matched
+	// on all their labels except Labels.
+	On     bool
+	Labels []string
+	Card   VectorMatchCardinality
+	// Include are the labels of the "one" side that are copied to the result of a
+	// many-to-one or one-to-many matching.
+	Include []string
+}
+
+// String returns the string representation of the VectorMatching as written in an expression.
+func (m *VectorMatching) String() string {
+	s := "ignoring"
+	if m.On {
+		s = "on"
+	}
+	s = fmt.Sprintf("%s(%s)", s, strings.Join(m.Labels, ", "))
+	switch m.Card {
+	case CardManyToOne:
+		s += fmt.Sprintf(" group_left(%s)", strings.Join(m.Include, ", "))
+	case CardOneToMany:
+		s += fmt.Sprintf(" group_right(%s)", strings.Join(m.Include, ", "))
+	}
+	return s
+}
+
+func (m *VectorMatching) check() error {
+	if !m.On {
+		return nil
+	}
+	for _, include := range m.Include {
+		for _, label := range m.Labels {
+			if include == label {
+				return fmt.Errorf("label %q must not occur in on and group clause at once", include)
+			}
+		}
+	}
+	return nil
+}
+
 // UnaryNode holds one argument and an operator.
 type UnaryNode struct {
 	NodeType
@@ -367,6 +461,54 @@ func (u *UnaryNode) Return() ReturnType {
 	return u.Arg.Return()
 }
 
+// TernaryNode holds a condition and the arguments to choose from depending on it.
+type TernaryNode struct {
+	NodeType
+	Pos
+	Cond Node
+	Args [2]Node
+}
+
+func newTernary(pos Pos, cond, arg1, arg2 Node) *TernaryNode {
+	return &TernaryNode{NodeType: NodeTernary, Pos: pos, Cond: cond, Args: [2]Node{arg1, arg2}}
+}
+
+// String returns the string representation of the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) String() string {
+	return fmt.Sprintf("%s ? %s : %s", n.Cond, n.Args[0], n.Args[1])
+}
+
+// StringAST returns the string representation of abstract syntax tree of the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) StringAST() string {
+	return fmt.Sprintf("?(%s, %s, %s)", n.Cond, n.Args[0], n.Args[1])
+}
+
+// Check performs parse time checking on the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) Check(t *Tree) error {
+	for _, arg := range []Node{n.Cond, n.Args[0], n.Args[1]} {
+		switch rt := arg.Return(); rt {
+		case TypeNumberSet, TypeSeriesSet, TypeScalar, TypeVariantSet:
+		default:
+			return fmt.Errorf(`parse: type error in %s, expected "number", got %s`, n, rt)
+		}
+		if err := arg.Check(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return returns the result type of the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) Return() ReturnType {
+	r := n.Cond.Return()
+	for _, arg := range n.Args {
+		if t := arg.Return(); t > r {
+			r = t
+		}
+	}
+	return r
+}
+
 // Walk invokes f on n and sub-nodes of n.
 func Walk(n Node, f func(Node)) {
 	f(n)
@@ -382,6 +524,10 @@ func Walk(n Node, f func(Node)) {
 		// Ignore since these node types have no sub nodes.
 	case *UnaryNode:
 		Walk(n.Arg, f)
+	case *TernaryNode:
+		Walk(n.Cond, f)
+		Walk(n.Args[0], f)
+		Walk(n.Args[1], f)
 	default:
 		panic(fmt.Errorf("other type: %T", n))
 	}
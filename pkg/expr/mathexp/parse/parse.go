@@ -8,10 +8,12 @@
 package parse
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Tree is the representation of a single parsed expression.
@@ -31,6 +33,8 @@ type Tree struct {
 // Func holds the structure of a parsed function call.
 type Func struct {
 	Args          []ReturnType
+	OptionalArgs  int  // number of trailing Args that may be omitted
+	Variadic      bool // the last of Args may be repeated
 	Return        ReturnType
 	F             interface{}
 	VariantReturn bool
@@ -47,6 +51,31 @@ func Parse(text string, funcs ...map[string]Func) (t *Tree, err error) {
 	return
 }
 
+// binaryOperators are the item types of the operators of binary operations.
+var binaryOperators = map[string]itemType{
+	"||": itemOr, "&&": itemAnd,
+	"==": itemEq, "!=": itemNotEq, ">": itemGreater, ">=": itemGreaterEq, "<": itemLess, "<=": itemLessEq,
+	"+": itemPlus, "-": itemMinus, "*": itemMult, "/": itemDiv, "%": itemMod, "**": itemPow,
+}
+
+// NewBinary returns the Tree of the binary operation op between the variables a and b,
+// whose values are matched as described by m, like the Tree parsed from "$a op m $b".
+// Unlike Parse, it accepts any variable and label names.
+func NewBinary(a, op, b string, m *VectorMatching) (*Tree, error) {
+	typ, ok := binaryOperators[op]
+	if !ok {
+		return nil, fmt.Errorf("unsupported binary operator %q", op)
+	}
+	if m != nil {
+		if err := m.check(); err != nil {
+			return nil, err
+		}
+	}
+	root := newBinary(item{typ: typ, val: op}, newVar(0, a, "${"+a+"}"), newVar(0, b, "${"+b+"}"))
+	root.Matching = m
+	return &Tree{Text: root.String(), Root: root, VarNames: []string{a, b}}, nil
+}
+
 // next returns the next token.
 func (t *Tree) next() item {
 	if t.peekCount > 0 {
@@ -103,7 +132,6 @@ func (t *Tree) expect(expected itemType, context string) item {
 }
 
 // expectOneOf consumes the next token and guarantees it has one of the required types.
-// nolint:unused
 func (t *Tree) expectOneOf(expected1, expected2 itemType, context string) item {
 	token := t.next()
 	if token.typ != expected1 && token.typ != expected2 {
@@ -157,7 +185,7 @@ func (t *Tree) Parse(text string, funcs ...map[string]Func) (err error) {
 // parse is the top-level parser for an expression.
 // It runs to EOF.
 func (t *Tree) parse() {
-	t.Root = t.O()
+	t.Root = t.T()
 	t.expect(itemEOF, "root input")
 	if err := t.Root.Check(t); err != nil {
 		t.error(err)
@@ -165,27 +193,42 @@ func (t *Tree) parse() {
 }
 
 /* Grammar:
-O -> A {"||" A}
-A -> C {"&&" C}
-C -> P {( "==" | "!=" | ">" | ">=" | "<" | "<=") P}
-P -> M {( "+" | "-" ) M}
-M -> E {( "*" | "/" ) F}
-E -> F {( "**" ) F}
-F -> v | "(" O ")" | "!" O | "-" O
+T -> O ["?" T ":" T]
+O -> A {"||" [match] A}
+A -> C {"&&" [match] C}
+C -> P {( "==" | "!=" | ">" | ">=" | "<" | "<=") [match] P}
+P -> M {( "+" | "-" ) [match] M}
+M -> E {( "*" | "/" ) [match] F}
+E -> F {( "**" ) [match] F}
+F -> v | "(" T ")" | "!" O | "-" O
 v -> number | func(..) | queryVar
 Func -> name "(" param {"," param} ")"
 param -> number | "string" | queryVar
+match -> ("on" | "ignoring") labels [("group_left" | "group_right") [labels]]
+labels -> "(" [label {"," label}] ")"
 */
 
 // expr:
 
+// T is O ["?" T ":" T] in the grammar.
+func (t *Tree) T() Node {
+	n := t.O()
+	if t.peek().typ != itemQuestion {
+		return n
+	}
+	token := t.next()
+	then := t.T()
+	t.expect(itemColon, "input: T()")
+	return newTernary(token.pos, n, then, t.T())
+}
+
 // O is A {"||" A} in the grammar.
 func (t *Tree) O() Node {
 	n := t.A()
 	for {
 		switch t.peek().typ {
 		case itemOr:
-			n = newBinary(t.next(), n, t.A())
+			n = t.binary(t.next(), n, t.A)
 		default:
 			return n
 		}
@@ -198,7 +241,7 @@ func (t *Tree) A() Node {
 	for {
 		switch t.peek().typ {
 		case itemAnd:
-			n = newBinary(t.next(), n, t.C())
+			n = t.binary(t.next(), n, t.C)
 		default:
 			return n
 		}
@@ -211,7 +254,7 @@ func (t *Tree) C() Node {
 	for {
 		switch t.peek().typ {
 		case itemEq, itemNotEq, itemGreater, itemGreaterEq, itemLess, itemLessEq:
-			n = newBinary(t.next(), n, t.P())
+			n = t.binary(t.next(), n, t.P)
 		default:
 			return n
 		}
@@ -224,7 +267,7 @@ func (t *Tree) P() Node {
 	for {
 		switch t.peek().typ {
 		case itemPlus, itemMinus:
-			n = newBinary(t.next(), n, t.M())
+			n = t.binary(t.next(), n, t.M)
 		default:
 			return n
 		}
@@ -237,7 +280,7 @@ func (t *Tree) M() Node {
 	for {
 		switch t.peek().typ {
 		case itemMult, itemDiv, itemMod:
-			n = newBinary(t.next(), n, t.E())
+			n = t.binary(t.next(), n, t.E)
 		default:
 			return n
 		}
@@ -250,14 +293,14 @@ func (t *Tree) E() Node {
 	for {
 		switch t.peek().typ {
 		case itemPow:
-			n = newBinary(t.next(), n, t.F())
+			n = t.binary(t.next(), n, t.F)
 		default:
 			return n
 		}
 	}
 }
 
-// F is v | "(" O ")" | "!" O | "-" O in the grammar.
+// F is v | "(" T ")" | "!" O | "-" O in the grammar.
 func (t *Tree) F() Node {
 	switch token := t.peek(); token.typ {
 	case itemNumber, itemFunc, itemVar:
@@ -266,7 +309,7 @@ func (t *Tree) F() Node {
 		return newUnary(t.next(), t.F())
 	case itemLeftParen:
 		t.next()
-		n := t.O()
+		n := t.T()
 		t.expect(itemRightParen, "input: F()")
 		return n
 	default:
@@ -275,6 +318,62 @@ func (t *Tree) F() Node {
 	return nil
 }
 
+// binary parses the optional vector matching of the operator and its right-hand
+// side with operand, and returns the BinaryNode lhs operator rhs.
+func (t *Tree) binary(operator item, lhs Node, operand func() Node) Node {
+	b := newBinary(operator, lhs, nil)
+	b.Matching = t.vectorMatching()
+	b.Args[1] = operand()
+	return b
+}
+
+// vectorMatching is ["on" | "ignoring"] labels [("group_left" | "group_right") [labels]]
+// in the grammar. It returns nil if there is no vector matching.
+func (t *Tree) vectorMatching() *VectorMatching {
+	token := t.peek()
+	if token.typ != itemFunc || (token.val != "on" && token.val != "ignoring") {
+		return nil
+	}
+	t.next()
+	m := &VectorMatching{
+		On:     token.val == "on",
+		Labels: t.labels(token.val),
+	}
+	token = t.peek()
+	if token.typ != itemFunc || (token.val != "group_left" && token.val != "group_right") {
+		return m
+	}
+	t.next()
+	m.Card = CardManyToOne
+	if token.val == "group_right" {
+		m.Card = CardOneToMany
+	}
+	if t.peek().typ == itemLeftParen {
+		m.Include = t.labels(token.val)
+	}
+	if err := m.check(); err != nil {
+		t.error(err)
+	}
+	return m
+}
+
+// labels is "(" [label {"," label}] ")" in the grammar.
+func (t *Tree) labels(context string) []string {
+	t.expect(itemLeftParen, context)
+	labels := []string{}
+	if t.peek().typ == itemRightParen {
+		t.next()
+		return labels
+	}
+	for {
+		token := t.expect(itemFunc, context)
+		labels = append(labels, token.val)
+		if t.expectOneOf(itemComma, itemRightParen, context).typ == itemRightParen {
+			return labels
+		}
+	}
+}
+
 // V is number | func(..) | queryVar in the grammar.
 func (t *Tree) v() Node {
 	switch token := t.next(); token.typ {
@@ -299,10 +398,77 @@ func (t *Tree) v() Node {
 // Var is queryVar in the grammar.
 func (t *Tree) Var() (v *VarNode) {
 	token := t.next()
-	varNoPrefix := strings.TrimPrefix(token.val, "$")
-	varNoBraces := strings.TrimSuffix(strings.TrimPrefix(varNoPrefix, "{"), "}")
-	t.VarNames = append(t.VarNames, varNoBraces)
-	return newVar(token.pos, varNoBraces, token.val)
+	name, selector := splitVar(token.val)
+	matchers, err := parseSelector(selector)
+	if err != nil {
+		t.errorf("invalid label selector in %s: %s", token.val, err)
+	}
+	t.VarNames = append(t.VarNames, name)
+	v = newVar(token.pos, name, token.val)
+	v.Selector = matchers
+	return v
+}
+
+// splitVar splits the text of a variable, e.g. $A, ${A} or $A{job="api"}, into its name
+// and its label selector, which is empty if there is none.
+func splitVar(text string) (name, selector string) {
+	text = strings.TrimPrefix(text, "$")
+	if strings.HasPrefix(text, "{") {
+		end := strings.IndexByte(text, '}')
+		return text[1:end], text[end+1:]
+	}
+	end := strings.IndexByte(text, '{')
+	if end == -1 {
+		return text, ""
+	}
+	return text[:end], text[end:]
+}
+
+// parseSelector parses a label selector such as {job="api", env!="dev"}. Matchers are
+// separated by commas and match a label name with = or != to a double-quoted value.
+func parseSelector(selector string) ([]LabelMatcher, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	s := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(selector, "{"), "}"))
+	if s == "" {
+		return nil, errors.New("empty label selector")
+	}
+	var matchers []LabelMatcher
+	for {
+		var m LabelMatcher
+		end := strings.IndexFunc(s, func(r rune) bool { return !isVarchar(r) })
+		if end <= 0 {
+			return nil, fmt.Errorf("expected a label name at %q", s)
+		}
+		m.Name, s = s[:end], strings.TrimLeftFunc(s[end:], unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(s, "!="):
+			m.Negate = true
+			s = s[2:]
+		case strings.HasPrefix(s, "="):
+			s = s[1:]
+		default:
+			return nil, fmt.Errorf("expected = or != after label %q", m.Name)
+		}
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil || quoted[0] != '"' {
+			return nil, fmt.Errorf("expected a double-quoted value for label %q", m.Name)
+		}
+		if m.Value, err = strconv.Unquote(quoted); err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+		s = strings.TrimLeftFunc(s[len(quoted):], unicode.IsSpace)
+		if s == "" {
+			return matchers, nil
+		}
+		if s[0] != ',' {
+			return nil, fmt.Errorf("expected , after the value of label %q", m.Name)
+		}
+		s = strings.TrimLeftFunc(s[1:], unicode.IsSpace)
+	}
 }
 
 // Func parses a FuncNode.
@@ -318,9 +484,10 @@ func (t *Tree) Func() (f *FuncNode) {
 		switch token = t.next(); token.typ {
 		default:
 			t.backup()
-			node := t.O()
+			node := t.T()
 			f.append(node)
-			if len(f.Args) == 1 && f.F.VariantReturn {
+			// A variadic function returns the widest type of its arguments.
+			if f.F.VariantReturn && (len(f.Args) == 1 || f.F.Variadic && node.Return() > f.F.Return) {
 				f.F.Return = node.Return()
 			}
 		case itemString:
@@ -332,6 +499,14 @@ func (t *Tree) Func() (f *FuncNode) {
 		case itemRightParen:
 			return
 		}
+		switch token = t.next(); token.typ {
+		case itemComma:
+			// continue with the next argument
+		case itemRightParen:
+			return
+		default:
+			t.unexpected(token, "func")
+		}
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
@@ -81,6 +82,67 @@ func Last(fv *Float64Field) *float64 {
 	return fv.GetValue(fv.Len() - 1)
 }
 
+// Diff returns the last non-null value minus the first non-null value. NaN values are skipped.
+// If there are fewer than two such values, NaN is returned.
+func Diff(fv *Float64Field) *float64 {
+	var first, last float64
+	count := 0
+	for i := 0; i < fv.Len(); i++ {
+		v := fv.GetValue(i)
+		if v == nil || math.IsNaN(*v) {
+			continue
+		}
+		if count == 0 {
+			first = *v
+		}
+		last = *v
+		count++
+	}
+	f := math.NaN()
+	if count > 1 {
+		f = last - first
+	}
+	return &f
+}
+
+// DiffAbs returns the absolute value of Diff.
+func DiffAbs(fv *Float64Field) *float64 {
+	f := math.Abs(*Diff(fv))
+	return &f
+}
+
+// Variance returns the population variance of the non-null values, that is the mean of their
+// squared deviations from their mean. NaN values are skipped. The values are considered to be
+// the whole population rather than a sample of it, so the sum of squares is divided by their
+// count and not by their count minus one. If there are fewer than two values, NaN is returned.
+func Variance(fv *Float64Field) *float64 {
+	// Welford's algorithm, to avoid the loss of precision of the sum of squares.
+	var mean, m2 float64
+	count := 0
+	for i := 0; i < fv.Len(); i++ {
+		v := fv.GetValue(i)
+		if v == nil || math.IsNaN(*v) {
+			continue
+		}
+		count++
+		delta := *v - mean
+		mean += delta / float64(count)
+		m2 += delta * (*v - mean)
+	}
+	f := math.NaN()
+	if count > 1 {
+		f = m2 / float64(count)
+	}
+	return &f
+}
+
+// StdDev returns the population standard deviation of the non-null values, that is the
+// square root of their Variance. If there are fewer than two values, NaN is returned.
+func StdDev(fv *Float64Field) *float64 {
+	f := math.Sqrt(*Variance(fv))
+	return &f
+}
+
 func GetReduceFunc(rFunc string) (ReducerFunc, error) {
 	switch strings.ToLower(rFunc) {
 	case "sum":
@@ -95,6 +157,14 @@ func GetReduceFunc(rFunc string) (ReducerFunc, error) {
 		return Count, nil
 	case "last":
 		return Last, nil
+	case "diff":
+		return Diff, nil
+	case "diff_abs":
+		return DiffAbs, nil
+	case "variance":
+		return Variance, nil
+	case "stddev":
+		return StdDev, nil
 	default:
 		return nil, fmt.Errorf("reduction %v not implemented", rFunc)
 	}
@@ -102,7 +172,7 @@ func GetReduceFunc(rFunc string) (ReducerFunc, error) {
 
 // GetSupportedReduceFuncs returns collection of supported function names
 func GetSupportedReduceFuncs() []string {
-	return []string{"sum", "mean", "min", "max", "count", "last"}
+	return []string{"sum", "mean", "min", "max", "count", "last", "diff", "diff_abs", "variance", "stddev"}
 }
 
 // Reduce turns the Series into a Number based on the given reduction function
@@ -133,6 +203,38 @@ func (s Series) Reduce(refID, rFunc string, mapper ReduceMapper) (Number, error)
 	return number, nil
 }
 
+// ReduceTime returns the time of the point picked by the "min" or "max" reduction of the Series.
+// If the mapper is defined it is applied to the Series first, like in Reduce. When several points
+// have the reduced value, the time of the first of them is returned. It returns false for other
+// reduction functions, or when the reduced value is not the value of a point, e.g. when it is NaN.
+func (s Series) ReduceTime(rFunc string, mapper ReduceMapper) (time.Time, bool) {
+	switch strings.ToLower(rFunc) {
+	case "min", "max":
+	default:
+		return time.Time{}, false
+	}
+	series := s
+	if mapper != nil {
+		series = mapSeries(s, mapper)
+	}
+	fVec := series.Frame.Fields[seriesTypeValIdx]
+	floatField := Float64Field(*fVec)
+	reduceFunc, err := GetReduceFunc(rFunc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	f := reduceFunc(&floatField)
+	if f == nil || math.IsNaN(*f) {
+		return time.Time{}, false
+	}
+	for i := 0; i < series.Len(); i++ {
+		if v := series.GetValue(i); v != nil && *v == *f {
+			return series.GetTime(i), true
+		}
+	}
+	return time.Time{}, false
+}
+
 type ReduceMapper interface {
 	MapInput(s *float64) *float64
 	MapOutput(v *float64) *float64
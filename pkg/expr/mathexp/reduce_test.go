@@ -241,6 +241,87 @@ func TestSeriesReduce(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "diff increasing counter with labels",
+			red:         "diff",
+			varToReduce: "A",
+			vars: Vars{
+				"A": Results{
+					[]Value{
+						makeSeries("temp", data.Labels{"host": "a"},
+							tp{time.Unix(5, 0), NaN},
+							tp{time.Unix(10, 0), float64Pointer(3)},
+							tp{time.Unix(15, 0), float64Pointer(7)},
+							tp{time.Unix(20, 0), float64Pointer(12)},
+							tp{time.Unix(25, 0), nil}),
+					},
+				},
+			},
+			errIs:     require.NoError,
+			resultsIs: require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("", data.Labels{"host": "a"}, float64Pointer(9)),
+				},
+			},
+		},
+		{
+			name:        "diff counter with reset",
+			red:         "diff",
+			varToReduce: "A",
+			vars: Vars{
+				"A": Results{
+					[]Value{
+						makeSeries("temp", nil,
+							tp{time.Unix(5, 0), float64Pointer(10)},
+							tp{time.Unix(10, 0), float64Pointer(15)},
+							tp{time.Unix(15, 0), float64Pointer(2)}),
+					},
+				},
+			},
+			errIs:     require.NoError,
+			resultsIs: require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("", nil, float64Pointer(-8)),
+				},
+			},
+		},
+		{
+			name:        "diff_abs counter with reset",
+			red:         "diff_abs",
+			varToReduce: "A",
+			vars: Vars{
+				"A": Results{
+					[]Value{
+						makeSeries("temp", nil,
+							tp{time.Unix(5, 0), float64Pointer(10)},
+							tp{time.Unix(10, 0), float64Pointer(15)},
+							tp{time.Unix(15, 0), float64Pointer(2)}),
+					},
+				},
+			},
+			errIs:     require.NoError,
+			resultsIs: require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("", nil, float64Pointer(8)),
+				},
+			},
+		},
+		{
+			name:        "diff series with a single non-null value",
+			red:         "diff",
+			varToReduce: "A",
+			vars:        seriesWithNil,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("", nil, NaN),
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -266,6 +347,44 @@ func TestSeriesReduce(t *testing.T) {
 	}
 }
 
+func TestSeriesReduceSpread(t *testing.T) {
+	// The population of this dataset has a mean of 5, a variance of 4 and a standard
+	// deviation of 2. The null and NaN points are skipped.
+	labels := data.Labels{"host": "a"}
+	points := []tp{
+		{time.Unix(1, 0), float64Pointer(2)},
+		{time.Unix(2, 0), float64Pointer(4)},
+		{time.Unix(3, 0), nil},
+		{time.Unix(4, 0), float64Pointer(4)},
+		{time.Unix(5, 0), float64Pointer(4)},
+		{time.Unix(6, 0), float64Pointer(5)},
+		{time.Unix(7, 0), NaN},
+		{time.Unix(8, 0), float64Pointer(5)},
+		{time.Unix(9, 0), float64Pointer(7)},
+		{time.Unix(10, 0), float64Pointer(9)},
+	}
+	series := makeSeries("temp", labels, points...)
+
+	for red, expected := range map[string]float64{"variance": 4, "stddev": 2} {
+		t.Run(red, func(t *testing.T) {
+			n, err := series.Reduce("B", red, nil)
+			require.NoError(t, err)
+			require.Equal(t, labels, n.GetLabels())
+			require.InDelta(t, expected, *n.GetFloat64Value(), 1e-9)
+
+			for name, s := range map[string]Series{
+				"empty":        makeSeries("temp", labels),
+				"single point": makeSeries("temp", labels, points[0]),
+				"single value": makeSeries("temp", labels, points[0], points[2], points[6]),
+			} {
+				n, err := s.Reduce("B", red, nil)
+				require.NoError(t, err)
+				require.True(t, math.IsNaN(*n.GetFloat64Value()), "%s series", name)
+			}
+		})
+	}
+}
+
 var seriesNonNumbers = Vars{
 	"A": Results{
 		[]Value{
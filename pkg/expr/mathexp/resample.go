@@ -7,18 +7,38 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
+// GetSupportedDownsamplers returns collection of supported downsampler names
+func GetSupportedDownsamplers() []string {
+	return []string{"sum", "mean", "min", "max", "last"}
+}
+
+// GetSupportedUpsamplers returns collection of supported upsampler names
+func GetSupportedUpsamplers() []string {
+	return []string{"pad", "backfilling", "fillna"}
+}
+
 // Resample turns the Series into a Number based on the given reduction function
 func (s Series) Resample(refID string, interval time.Duration, downsampler string, upsampler string, from, to time.Time) (Series, error) {
 	newSeriesLength := int(float64(to.Sub(from).Nanoseconds()) / float64(interval.Nanoseconds()))
 	if newSeriesLength <= 0 {
 		return s, fmt.Errorf("the series cannot be sampled further; the time range is shorter than the interval")
 	}
-	resampled := NewSeries(refID, s.GetLabels(), newSeriesLength+1)
+	times := make([]time.Time, 0, newSeriesLength+1)
+	for t := from; !t.After(to) && len(times) <= newSeriesLength; t = t.Add(interval) {
+		times = append(times, t)
+	}
+	return s.ResampleAt(refID, times, downsampler, upsampler)
+}
+
+// ResampleAt resamples the Series to a point at each of the given times, which must be
+// sorted. The value at a time is made of the points after the previous time and up to
+// that time, by the downsampler if there are several and by the upsampler if there are
+// none. The times don't need to be evenly spaced.
+func (s Series) ResampleAt(refID string, times []time.Time, downsampler string, upsampler string) (Series, error) {
+	resampled := NewSeries(refID, s.GetLabels(), len(times))
 	bookmark := 0
 	var lastSeen *float64
-	idx := 0
-	t := from
-	for !t.After(to) && idx <= newSeriesLength {
+	for idx, t := range times {
 		vals := make([]*float64, 0)
 		sIdx := bookmark
 		for {
@@ -77,8 +97,6 @@ func (s Series) Resample(refID string, interval time.Duration, downsampler strin
 			value = tmp
 		}
 		resampled.SetPoint(idx, t, value)
-		t = t.Add(interval)
-		idx++
 	}
 	return resampled, nil
 }
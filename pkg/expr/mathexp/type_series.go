@@ -192,6 +192,16 @@ func (s Series) AppendPoint(t time.Time, f *float64) {
 	s.Frame.Fields[seriesTypeValIdx].Append(f)
 }
 
+// Shift returns a copy of the series with the time of each point offset by d.
+func (s Series) Shift(d time.Duration) Series {
+	shifted := NewSeries(s.GetName(), s.GetLabels(), s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		shifted.SetPoint(i, t.Add(d), f)
+	}
+	return shifted
+}
+
 // Len returns the length of the series.
 func (s Series) Len() int {
 	return s.Frame.Fields[seriesTypeTimeIdx].Len()
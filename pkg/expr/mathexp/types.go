@@ -1,6 +1,8 @@
 package mathexp
 
 import (
+	"fmt"
+
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 
 	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
@@ -11,6 +13,51 @@ type Results struct {
 	Values Values
 }
 
+// Merge returns Results with the Values of r followed by the Values of each of others, in order.
+func (r Results) Merge(others ...Results) Results {
+	merged := Results{Values: make(Values, 0, len(r.Values))}
+	for _, res := range append([]Results{r}, others...) {
+		merged.Values = append(merged.Values, res.Values...)
+	}
+	return merged
+}
+
+// MergeDistinct is like Merge, but drops a Series, Number, or Scalar when a value of the same
+// type with the same name (the refID of the command that created it) and labels was already
+// merged. The first of the duplicate values is kept. Other values, such as NoData, are always kept.
+func (r Results) MergeDistinct(others ...Results) Results {
+	merged := Results{Values: make(Values, 0, len(r.Values))}
+	seen := make(map[string]struct{})
+	for _, res := range append([]Results{r}, others...) {
+		for _, v := range res.Values {
+			if key, ok := fingerprint(v); ok {
+				if _, dup := seen[key]; dup {
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+			merged.Values = append(merged.Values, v)
+		}
+	}
+	return merged
+}
+
+// fingerprint identifies a Series, Number, or Scalar by its type, name, and labels.
+func fingerprint(v Value) (string, bool) {
+	var name string
+	switch v := v.(type) {
+	case Series:
+		name = v.GetName()
+	case Number:
+		name = v.Frame.Fields[0].Name
+	case Scalar:
+		name = v.Frame.Fields[0].Name
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("%v:%s{%s}", v.Type(), name, v.GetLabels()), true
+}
+
 // Values is a slice of Value interfaces
 type Values []Value
 
@@ -323,3 +323,35 @@ func TestSeriesName(t *testing.T) {
 		})
 	}
 }
+
+func TestResultsMerge(t *testing.T) {
+	a1 := makeSeries("A", data.Labels{"host": "a"}, tp{time.Unix(5, 0), float64Pointer(1)})
+	a2 := makeSeries("A", data.Labels{"host": "b"}, tp{time.Unix(5, 0), float64Pointer(2)})
+	aDup := makeSeries("A", data.Labels{"host": "a"}, tp{time.Unix(5, 0), float64Pointer(3)})
+	bDup := makeSeries("B", data.Labels{"host": "a"}, tp{time.Unix(5, 0), float64Pointer(4)})
+	n := makeNumber("A", data.Labels{"host": "a"}, float64Pointer(5))
+	noData := NewNoData()
+
+	t.Run("Merge keeps all values in order", func(t *testing.T) {
+		merged := Results{Values{a1}}.Merge(Results{Values{aDup, a2}}, Results{Values{noData, noData}})
+		require.Equal(t, Values{a1, aDup, a2, noData, noData}, merged.Values)
+	})
+
+	t.Run("MergeDistinct drops values with the same refID and labels", func(t *testing.T) {
+		merged := Results{Values{a1, a2}}.MergeDistinct(Results{Values{aDup, bDup}})
+		require.Equal(t, Values{a1, a2, bDup}, merged.Values)
+	})
+
+	t.Run("MergeDistinct keeps values of different types and NoData", func(t *testing.T) {
+		merged := Results{Values{a1, noData}}.MergeDistinct(Results{Values{n, noData}})
+		require.Equal(t, Values{a1, noData, n, noData}, merged.Values)
+	})
+
+	t.Run("Merge does not modify the receiver", func(t *testing.T) {
+		r := Results{Values: make(Values, 1, 2)}
+		r.Values[0] = a1
+		_ = r.Merge(Results{Values{a2}})
+		require.Len(t, r.Values, 1)
+		require.Nil(t, r.Values[:2][1])
+	})
+}
@@ -60,6 +60,32 @@ func (rn *rawNode) GetCommandType() (c CommandType, err error) {
 	return ParseCommandType(typeString)
 }
 
+// outputRefID returns the refID that names the results of the command of type cmdType
+// built from the node: the optional "outputRefId" field of the query, which lets a node
+// publish its results under another name, or else the refID of the node. It returns an
+// error if the node has no refID, or if the command is a join, whose results keep the
+// names of its inputs.
+func (rn *rawNode) outputRefID(cmdType CommandType) (string, error) {
+	if rn.RefID == "" {
+		return "", ErrMissingRefID{Command: cmdType}
+	}
+	rawOutput, ok := rn.Query["outputRefId"]
+	if !ok {
+		return rn.RefID, nil
+	}
+	if cmdType == TypeJoin {
+		return "", fmt.Errorf("field \"outputRefId\" is not supported by join expression '%s': its results keep the names of its inputs", rn.RefID)
+	}
+	output, ok := rawOutput.(string)
+	if !ok {
+		return "", newErrInvalidInputType(rn.RefID, "outputRefId", "a string", rawOutput)
+	}
+	if output == "" {
+		return "", fmt.Errorf("field \"outputRefId\" in expression '%s' must not be empty", rn.RefID)
+	}
+	return output, nil
+}
+
 // String returns a string representation of the node. In particular for
 // %v formatting in error messages.
 func (b *baseNode) String() string {
@@ -92,7 +118,26 @@ func (gn *CMDNode) NodeType() NodeType {
 // other nodes they must have already been executed and their results must
 // already by in vars.
 func (gn *CMDNode) Execute(ctx context.Context, now time.Time, vars mathexp.Vars, _ *Service) (mathexp.Results, error) {
-	return gn.Command.Execute(ctx, now, vars)
+	logger := logger.FromContext(ctx).New("commandType", gn.CMDType.String(), "refId", gn.refID)
+
+	inputVars := gn.Command.NeedsVars()
+	inputValues := 0
+	for _, v := range inputVars {
+		inputValues += len(vars[v].Values)
+	}
+
+	start := time.Now()
+	res, err := gn.Command.Execute(ctx, now, vars)
+	duration := time.Since(start)
+	expressionsCommandSeconds.WithLabelValues(gn.CMDType.String()).Observe(duration.Seconds())
+	if err != nil {
+		expressionsCommandCounter.WithLabelValues(gn.CMDType.String(), "failure").Inc()
+		logger.Error("Failed to execute expression command", "error", err, "duration", duration)
+		return res, err
+	}
+	expressionsCommandCounter.WithLabelValues(gn.CMDType.String(), "success").Inc()
+	logger.Debug("Expression command executed", "inputVars", len(inputVars), "inputValues", inputValues, "duration", duration)
+	return res, nil
 }
 
 func buildCMDNode(dp *simple.DirectedGraph, rn *rawNode) (*CMDNode, error) {
@@ -117,9 +162,38 @@ func buildCMDNode(dp *simple.DirectedGraph, rn *rawNode) (*CMDNode, error) {
 	case TypeResample:
 		node.Command, err = UnmarshalResampleCommand(rn)
 	case TypeClassicConditions:
-		node.Command, err = classic.UnmarshalConditionsCmd(rn.Query, rn.RefID)
+		var refID string
+		if refID, err = rn.outputRefID(commandType); err == nil {
+			node.Command, err = classic.UnmarshalConditionsCmd(rn.Query, refID)
+		}
 	case TypeThreshold:
 		node.Command, err = UnmarshalThresholdCommand(rn)
+	case TypeJoin:
+		node.Command, err = UnmarshalJoinCommand(rn)
+	case TypeBroadcast:
+		node.Command, err = UnmarshalBroadcastCommand(rn)
+	case TypeNumberToSeries:
+		node.Command, err = UnmarshalNumberToSeriesCommand(rn)
+	case TypeCast:
+		node.Command, err = UnmarshalCastCommand(rn)
+	case TypeRolling:
+		node.Command, err = UnmarshalRollingCommand(rn)
+	case TypeValueFilter:
+		node.Command, err = UnmarshalValueFilterCommand(rn)
+	case TypeRelabel:
+		node.Command, err = UnmarshalRelabelCommand(rn)
+	case TypeRate:
+		node.Command, err = UnmarshalRateCommand(rn)
+	case TypeIncrease:
+		node.Command, err = UnmarshalIncreaseCommand(rn)
+	case TypeFill:
+		node.Command, err = UnmarshalFillCommand(rn)
+	case TypeAggregate:
+		node.Command, err = UnmarshalAggregateCommand(rn)
+	case TypeCumulative:
+		node.Command, err = UnmarshalCumulativeCommand(rn)
+	case TypePromQLJoin:
+		node.Command, err = UnmarshalPromQLJoinCommand(rn)
 	default:
 		return nil, fmt.Errorf("expression command type '%v' in expression '%v' not implemented", commandType, rn.RefID)
 	}
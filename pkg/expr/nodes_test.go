@@ -1,10 +1,20 @@
 package expr
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
 )
 
 type expectedError struct{}
@@ -40,3 +50,186 @@ func TestQueryError_Unwrap(t *testing.T) {
 		assert.True(t, errors.As(e, &expectedAsError))
 	})
 }
+
+func TestCMDNode_Execute_Metrics(t *testing.T) {
+	mathCmd, err := NewMathCommand("B", "$A * 2", mathexp.DivByZeroDefault)
+	require.NoError(t, err)
+	mathNode := &CMDNode{baseNode: baseNode{refID: "B"}, CMDType: TypeMath, Command: mathCmd}
+
+	failing, err := NewMathCommand("C", "$A / 0", mathexp.DivByZeroError)
+	require.NoError(t, err)
+	failingNode := &CMDNode{baseNode: baseNode{refID: "C"}, CMDType: TypeMath, Command: failing}
+
+	reduce, err := NewReduceCommand("D", "mean", "A", nil)
+	require.NoError(t, err)
+	reduceNode := &CMDNode{baseNode: baseNode{refID: "D"}, CMDType: TypeReduce, Command: reduce}
+
+	n := mathexp.NewNumber("A", nil)
+	n.SetValue(ptr.Float64(1))
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{n}}}
+
+	mathSuccess := testutil.ToFloat64(expressionsCommandCounter.WithLabelValues("math", "success"))
+	mathFailure := testutil.ToFloat64(expressionsCommandCounter.WithLabelValues("math", "failure"))
+	reduceSuccess := testutil.ToFloat64(expressionsCommandCounter.WithLabelValues("reduce", "success"))
+	observations := func(command string) uint64 {
+		m := &dto.Metric{}
+		require.NoError(t, expressionsCommandSeconds.WithLabelValues(command).(prometheus.Histogram).Write(m))
+		return m.GetHistogram().GetSampleCount()
+	}
+	mathObservations := observations("math")
+	reduceObservations := observations("reduce")
+
+	_, err = mathNode.Execute(context.Background(), time.Now(), vars, nil)
+	require.NoError(t, err)
+	_, err = failingNode.Execute(context.Background(), time.Now(), vars, nil)
+	require.Error(t, err)
+	_, err = reduceNode.Execute(context.Background(), time.Now(), vars, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, mathSuccess+1, testutil.ToFloat64(expressionsCommandCounter.WithLabelValues("math", "success")))
+	assert.Equal(t, mathFailure+1, testutil.ToFloat64(expressionsCommandCounter.WithLabelValues("math", "failure")))
+	assert.Equal(t, reduceSuccess+1, testutil.ToFloat64(expressionsCommandCounter.WithLabelValues("reduce", "success")))
+	assert.Equal(t, mathObservations+2, observations("math"))
+	assert.Equal(t, reduceObservations+1, observations("reduce"))
+}
+
+func TestBuildCMDNode_RefID(t *testing.T) {
+	tr := RelativeTimeRange{From: -time.Hour}
+	conditions := []interface{}{map[string]interface{}{
+		"evaluator": map[string]interface{}{"type": "gt", "params": []interface{}{1.0}},
+		"operator":  map[string]interface{}{"type": "and"},
+		"query":     map[string]interface{}{"params": []interface{}{"A"}},
+		"reducer":   map[string]interface{}{"type": "avg"},
+	}}
+	queries := map[CommandType]map[string]interface{}{
+		TypeMath:              {"expression": "$A + 1"},
+		TypeReduce:            {"expression": "$A", "reducer": "mean"},
+		TypeResample:          {"expression": "$A", "window": "1m", "downsampler": "mean", "upsampler": "pad"},
+		TypeClassicConditions: {"conditions": conditions},
+		TypeThreshold:         {"expression": "$A", "conditions": conditions},
+		TypeJoin:              {"expressions": []interface{}{"$A", "$B"}},
+		TypeBroadcast:         {"valueExpression": "$A", "shapeExpression": "$B"},
+		TypeNumberToSeries:    {"expression": "$A"},
+		TypeCast:              {"expression": "$A", "to": "number"},
+		TypeRolling:           {"expression": "$A", "window": "5m", "reducer": "mean"},
+		TypeValueFilter:       {"expression": "$A", "operator": "gt", "threshold": 1.0},
+		TypeRelabel:           {"expression": "$A", "prefix": "source_"},
+		TypeRate:              {"expression": "$A"},
+		TypeIncrease:          {"expression": "$A"},
+		TypeFill:              {"expression": "$A", "mode": "zero"},
+		TypeAggregate:         {"expression": "$A", "operation": "sum"},
+		TypeCumulative:        {"expression": "$A"},
+		TypePromQLJoin:        {"left": "$A", "right": "$B", "operator": "+"},
+	}
+	require.Len(t, queries, int(TypePromQLJoin), "every command type must be tested")
+
+	for cmdType, query := range queries {
+		query["type"] = cmdType.String()
+
+		t.Run(cmdType.String(), func(t *testing.T) {
+			node, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{RefID: "B", Query: query, TimeRange: tr})
+			require.NoError(t, err)
+			require.Equal(t, "B", node.Command.RefID())
+		})
+
+		t.Run(cmdType.String()+" without refID", func(t *testing.T) {
+			_, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{Query: query, TimeRange: tr})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "is missing a refId")
+		})
+	}
+}
+
+func TestErrMissingRefID(t *testing.T) {
+	_, err := UnmarshalMathCommand(&rawNode{Query: map[string]interface{}{"expression": "$A + 1"}})
+	var missing ErrMissingRefID
+	require.True(t, errors.As(err, &missing))
+	require.Equal(t, TypeMath, missing.Command)
+	require.EqualError(t, err, "math expression is missing a refId")
+}
+
+func TestBuildCMDNode_OutputRefID(t *testing.T) {
+	series := mathexp.NewSeries("A", nil, 2)
+	series.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+	series.SetPoint(1, time.Unix(60, 0), ptr.Float64(3))
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{series}}}
+
+	t.Run("math results are named by outputRefId", func(t *testing.T) {
+		node, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"type": "math", "expression": "$A * 2", "outputRefId": "doubled"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "B", node.RefID())
+		require.Equal(t, "doubled", node.Command.RefID())
+		require.Equal(t, []string{"A"}, node.Command.NeedsVars())
+
+		res, err := node.Command.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, "doubled", res.Values[0].(mathexp.Series).GetName())
+	})
+
+	t.Run("reduce results are named by outputRefId", func(t *testing.T) {
+		node, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"type": "reduce", "expression": "$A", "reducer": "max", "outputRefId": "peak"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, node.Command.NeedsVars())
+
+		res, err := node.Command.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		require.Equal(t, "peak", res.Values[0].(mathexp.Number).Frame.Fields[0].Name)
+	})
+
+	t.Run("input values returned unchanged are named by outputRefId", func(t *testing.T) {
+		node, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{
+			RefID:     "B",
+			TimeRange: RelativeTimeRange{From: -time.Hour},
+			Query:     map[string]interface{}{"type": "cast", "expression": "$A", "to": "series", "outputRefId": "casted"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, node.Command.NeedsVars())
+
+		res, err := node.Command.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		casted := res.Values[0].(mathexp.Series)
+		require.Equal(t, "casted", casted.GetName())
+		require.Equal(t, series.Len(), casted.Len())
+		require.Equal(t, "A", series.GetName())
+	})
+
+	t.Run("should fail on outputRefId for join, whose results keep the names of its inputs", func(t *testing.T) {
+		_, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"type": "join", "expressions": []interface{}{"$A"}, "outputRefId": "joined"},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "outputRefId")
+	})
+
+	t.Run("results are named by the refID by default", func(t *testing.T) {
+		node, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"type": "math", "expression": "$A * 2"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "B", node.Command.RefID())
+
+		res, err := node.Command.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Equal(t, "B", res.Values[0].(mathexp.Series).GetName())
+	})
+
+	t.Run("should fail on an empty outputRefId", func(t *testing.T) {
+		_, err := buildCMDNode(simple.NewDirectedGraph(), &rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"type": "math", "expression": "$A * 2", "outputRefId": ""},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "outputRefId")
+	})
+}
@@ -0,0 +1,118 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// NumberToSeriesCommand is an expression command that turns each number of its input
+// into a series with a single point, so reduced values can be charted on a time axis.
+type NumberToSeriesCommand struct {
+	VarToConvert string
+	// AtTime is the time of the point of each series. If nil, the end of TimeRange is used.
+	AtTime    *time.Time
+	TimeRange TimeRange
+	refID     string
+}
+
+// NewNumberToSeriesCommand creates a new NumberToSeriesCommand.
+func NewNumberToSeriesCommand(refID, varToConvert string, atTime *time.Time, tr TimeRange) (*NumberToSeriesCommand, error) {
+	if atTime == nil && tr == nil {
+		return nil, fmt.Errorf("either atTime or a time range must be specified for refID %s", refID)
+	}
+	return &NumberToSeriesCommand{
+		VarToConvert: varToConvert,
+		AtTime:       atTime,
+		TimeRange:    tr,
+		refID:        refID,
+	}, nil
+}
+
+// UnmarshalNumberToSeriesCommand creates a NumberToSeriesCommand from Grafana's frontend query.
+// The optional "atTime" is either an RFC 3339 timestamp or a number of milliseconds since epoch.
+func UnmarshalNumberToSeriesCommand(rn *rawNode) (*NumberToSeriesCommand, error) {
+	refID, err := rn.outputRefID(TypeNumberToSeries)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToConvert, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToConvert = strings.TrimPrefix(varToConvert, "$")
+
+	var atTime *time.Time
+	if rawAtTime, ok := rn.Query["atTime"]; ok {
+		var t time.Time
+		switch v := rawAtTime.(type) {
+		case float64:
+			t = time.UnixMilli(int64(v))
+		case string:
+			var err error
+			t, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf(`failed to parse "atTime" field %q: %w`, v, err)
+			}
+		default:
+			return nil, newErrInvalidInputType(rn.RefID, "atTime", "an RFC 3339 string or a number of milliseconds", rawAtTime)
+		}
+		atTime = &t
+	}
+
+	return NewNumberToSeriesCommand(refID, varToConvert, atTime, rn.TimeRange)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (nc *NumberToSeriesCommand) NeedsVars() []string {
+	return []string{nc.VarToConvert}
+}
+
+// RefID returns the refID that names the results of the command.
+func (nc *NumberToSeriesCommand) RefID() string {
+	return nc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. Each series keeps the labels of its number.
+func (nc *NumberToSeriesCommand) Execute(_ context.Context, now time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+
+	var at time.Time
+	if nc.AtTime != nil {
+		at = *nc.AtTime
+	} else {
+		at = nc.TimeRange.AbsoluteTime(now).To
+	}
+
+	for _, val := range vars[nc.VarToConvert].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Number:
+			var f *float64
+			if p := v.GetFloat64Value(); p != nil {
+				value := *p
+				f = &value
+			}
+			s := mathexp.NewSeries(nc.refID, v.GetLabels().Copy(), 1)
+			s.SetPoint(0, at, f)
+			newRes.Values = append(newRes.Values, s)
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: nc.refID, Input: nc.VarToConvert, Command: TypeNumberToSeries, Expected: parse.TypeNumberSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
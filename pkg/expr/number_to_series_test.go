@@ -0,0 +1,97 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestNumberToSeriesCommand(t *testing.T) {
+	now := time.Unix(1000, 0)
+	number := mathexp.NewNumber("A", data.Labels{"host": "a"})
+	number.SetValue(ptr.Float64(3))
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{number}}}
+
+	requireSinglePoint := func(t *testing.T, res mathexp.Results, expectedTime time.Time) {
+		t.Helper()
+		require.Len(t, res.Values, 1)
+		s, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, "B", s.GetName())
+		require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+		require.Equal(t, 1, s.Len())
+		tm, f := s.GetPoint(0)
+		require.True(t, expectedTime.Equal(tm), "expected %v, got %v", expectedTime, tm)
+		require.Equal(t, ptr.Float64(3), f)
+	}
+
+	t.Run("should default to the end of the time range", func(t *testing.T) {
+		cmd, err := UnmarshalNumberToSeriesCommand(&rawNode{
+			RefID:     "B",
+			Query:     map[string]interface{}{"expression": "$A"},
+			TimeRange: RelativeTimeRange{From: -time.Hour, To: -time.Minute},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+		res, err := cmd.Execute(context.Background(), now, vars)
+		require.NoError(t, err)
+		requireSinglePoint(t, res, now.Add(-time.Minute))
+	})
+
+	t.Run("should use atTime when given", func(t *testing.T) {
+		cmd, err := UnmarshalNumberToSeriesCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "A",
+				"atTime":     "2022-01-01T10:00:00Z",
+			},
+			TimeRange: RelativeTimeRange{From: -time.Hour},
+		})
+		require.NoError(t, err)
+
+		res, err := cmd.Execute(context.Background(), now, vars)
+		require.NoError(t, err)
+		requireSinglePoint(t, res, time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC))
+	})
+
+	t.Run("should accept atTime in milliseconds", func(t *testing.T) {
+		cmd, err := UnmarshalNumberToSeriesCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{
+				"expression": "A",
+				"atTime":     float64(5000),
+			},
+		})
+		require.NoError(t, err)
+
+		res, err := cmd.Execute(context.Background(), now, vars)
+		require.NoError(t, err)
+		requireSinglePoint(t, res, time.UnixMilli(5000))
+	})
+
+	t.Run("should fail without atTime nor time range", func(t *testing.T) {
+		_, err := UnmarshalNumberToSeriesCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "A"},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("should fail on series input", func(t *testing.T) {
+		cmd, err := NewNumberToSeriesCommand("B", "A", nil, RelativeTimeRange{From: -time.Hour})
+		require.NoError(t, err)
+
+		_, err = cmd.Execute(context.Background(), now, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{mathexp.NewSeries("A", nil, 0)}},
+		})
+		var mismatch ErrInputTypeMismatch
+		require.ErrorAs(t, err, &mismatch)
+	})
+}
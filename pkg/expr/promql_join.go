@@ -0,0 +1,195 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+var supportedPromQLJoinOperators = []string{"+", "-", "*", "/", "%", "^", "==", "!=", ">", "<", ">=", "<="}
+
+// PromQLJoinCommand is an expression command that combines the series or numbers of two
+// inputs with a binary operator, matching them like PromQL's vector matching. A value of
+// the left input is matched with the value of the right input that has the same labels,
+// or only the same On labels, or the same labels but the Ignoring ones. Values without a
+// match are dropped.
+//
+// The matching is one-to-one unless GroupLeft is set: then several values of the left input
+// may be matched with the same value of the right input (many-to-one), like group_left.
+// It is the matching of the on and ignoring modifiers of math expressions, see
+// mathexp.NewBinary, whatever the names of the inputs and labels.
+type PromQLJoinCommand struct {
+	LeftVar  string
+	RightVar string
+	Operator string
+	// On and Ignoring are the labels values are matched on, or are not matched on. Only one
+	// of them may be set.
+	On       []string
+	Ignoring []string
+	// GroupLeft makes the matching many-to-one. The results then have the labels of the left
+	// values, plus the Include labels of the right ones.
+	GroupLeft  bool
+	Include    []string
+	Expression *mathexp.Expr
+	refID      string
+}
+
+// NewPromQLJoinCommand creates a new PromQLJoinCommand. divByZero controls the result of
+// dividing by zero, see mathexp.DivByZeroPolicy.
+func NewPromQLJoinCommand(refID, leftVar, rightVar, operator string, on, ignoring []string, groupLeft bool, include []string, divByZero mathexp.DivByZeroPolicy) (*PromQLJoinCommand, error) {
+	if !isSupported(operator, supportedPromQLJoinOperators) {
+		return nil, fmt.Errorf("promql join operator %q is not supported. Supported: %v", operator, supportedPromQLJoinOperators)
+	}
+	if len(on) > 0 && len(ignoring) > 0 {
+		return nil, fmt.Errorf(`promql join "on" and "ignoring" cannot be specified together`)
+	}
+	if len(include) > 0 && !groupLeft {
+		return nil, fmt.Errorf(`promql join labels to include can only be specified with "groupLeft"`)
+	}
+
+	// Without "on", values are matched on all their labels but the ignored ones, which is
+	// ignoring() when none are.
+	matching := &parse.VectorMatching{On: len(on) > 0, Labels: ignoring}
+	if matching.On {
+		matching.Labels = on
+	}
+	if groupLeft {
+		matching.Card = parse.CardManyToOne
+		matching.Include = include
+	}
+	op := operator
+	if op == "^" {
+		op = "**"
+	}
+	expr, err := mathexp.NewBinary(leftVar, op, rightVar, matching)
+	if err != nil {
+		return nil, fmt.Errorf("invalid promql join: %w", err)
+	}
+	expr.DivByZero = divByZero
+
+	return &PromQLJoinCommand{
+		LeftVar:    leftVar,
+		RightVar:   rightVar,
+		Operator:   operator,
+		On:         on,
+		Ignoring:   ignoring,
+		GroupLeft:  groupLeft,
+		Include:    include,
+		Expression: expr,
+		refID:      refID,
+	}, nil
+}
+
+// UnmarshalPromQLJoinCommand creates a PromQLJoinCommand from Grafana's frontend query.
+// "groupLeft" is either a boolean, or the array of the labels to include from the right
+// values.
+func UnmarshalPromQLJoinCommand(rn *rawNode) (*PromQLJoinCommand, error) {
+	refID, err := rn.outputRefID(TypePromQLJoin)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, 2)
+	for _, field := range []string{"left", "right"} {
+		rawVar, ok := rn.Query[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: field})
+		}
+		v, ok := rawVar.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, field, "a string", rawVar)
+		}
+		vars[field] = strings.TrimPrefix(v, "$")
+	}
+
+	rawOperator, ok := rn.Query["operator"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "operator"}
+	}
+	operator, ok := rawOperator.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "operator", "a string", rawOperator)
+	}
+
+	on, err := unmarshalLabelNames(rn, "on")
+	if err != nil {
+		return nil, err
+	}
+	ignoring, err := unmarshalLabelNames(rn, "ignoring")
+	if err != nil {
+		return nil, err
+	}
+
+	var groupLeft bool
+	var include []string
+	if rawGroupLeft, ok := rn.Query["groupLeft"]; ok {
+		switch v := rawGroupLeft.(type) {
+		case bool:
+			groupLeft = v
+		case []interface{}:
+			groupLeft = true
+			include, err = unmarshalLabelNames(rn, "groupLeft")
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, newErrInvalidInputType(rn.RefID, "groupLeft", "a boolean or an array of strings", rawGroupLeft)
+		}
+	}
+
+	var divByZero mathexp.DivByZeroPolicy
+	if rawDivByZero, ok := rn.Query["divideByZero"]; ok {
+		s, ok := rawDivByZero.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "divideByZero", "a string", rawDivByZero)
+		}
+		divByZero, err = mathexp.ParseDivByZeroPolicy(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewPromQLJoinCommand(refID, vars["left"], vars["right"], operator, on, ignoring, groupLeft, include, divByZero)
+}
+
+// unmarshalLabelNames returns the optional array of label names of the field of the query.
+func unmarshalLabelNames(rn *rawNode, field string) ([]string, error) {
+	raw, ok := rn.Query[field]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, field, "an array of strings", raw)
+	}
+	names := make([]string, 0, len(list))
+	for _, l := range list {
+		name, ok := l.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, field, "an array of strings", l)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (pc *PromQLJoinCommand) NeedsVars() []string {
+	return []string{pc.LeftVar, pc.RightVar}
+}
+
+// RefID returns the refID that names the results of the command.
+func (pc *PromQLJoinCommand) RefID() string {
+	return pc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. It fails when the matching is ambiguous: when several right values
+// have the same matching labels, or several left ones do and GroupLeft is not set.
+func (pc *PromQLJoinCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	return pc.Expression.Execute(pc.refID, vars)
+}
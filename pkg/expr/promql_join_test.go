@@ -0,0 +1,166 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestPromQLJoinCommand(t *testing.T) {
+	number := func(labels data.Labels, f float64) mathexp.Number {
+		n := mathexp.NewNumber("", labels)
+		n.SetValue(&f)
+		return n
+	}
+	type result struct {
+		labels data.Labels
+		value  *float64
+	}
+	execute := func(t *testing.T, query map[string]interface{}, vars mathexp.Vars) ([]result, error) {
+		t.Helper()
+		query["left"] = "$A"
+		query["right"] = "$B"
+		cmd, err := UnmarshalPromQLJoinCommand(&rawNode{RefID: "C", Query: query})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A", "B"}, cmd.NeedsVars())
+
+		res, err := cmd.Execute(context.Background(), time.Now(), vars)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]result, 0, len(res.Values))
+		for _, v := range res.Values {
+			n, ok := v.(mathexp.Number)
+			require.True(t, ok)
+			results = append(results, result{n.GetLabels(), n.GetFloat64Value()})
+		}
+		return results, nil
+	}
+
+	t.Run("one-to-one ignoring a label", func(t *testing.T) {
+		actual, err := execute(t, map[string]interface{}{"operator": "/", "ignoring": []interface{}{"code"}}, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"method": "get", "code": "500"}, 24),
+				number(data.Labels{"method": "put", "code": "500"}, 3),
+				number(data.Labels{"method": "del", "code": "500"}, 1),
+			}},
+			"B": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"method": "get"}, 600),
+				number(data.Labels{"method": "put"}, 300),
+				number(data.Labels{"method": "post"}, 100),
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []result{
+			{data.Labels{"method": "get"}, ptr.Float64(0.04)},
+			{data.Labels{"method": "put"}, ptr.Float64(0.01)},
+		}, actual)
+	})
+
+	t.Run("many-to-one with groupLeft", func(t *testing.T) {
+		actual, err := execute(t, map[string]interface{}{"operator": "*", "on": []interface{}{"job"}, "groupLeft": []interface{}{"team"}}, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"job": "api", "instance": "a"}, 2),
+				number(data.Labels{"job": "api", "instance": "b"}, 3),
+				number(data.Labels{"job": "db", "instance": "c"}, 4),
+			}},
+			"B": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"job": "api", "team": "web"}, 10),
+				number(data.Labels{"job": "db", "team": "storage"}, 100),
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []result{
+			{data.Labels{"job": "api", "instance": "a", "team": "web"}, ptr.Float64(20)},
+			{data.Labels{"job": "api", "instance": "b", "team": "web"}, ptr.Float64(30)},
+			{data.Labels{"job": "db", "instance": "c", "team": "storage"}, ptr.Float64(400)},
+		}, actual)
+	})
+
+	t.Run("comparison returns 1 or 0", func(t *testing.T) {
+		actual, err := execute(t, map[string]interface{}{"operator": ">"}, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{number(data.Labels{"host": "a"}, 5), number(data.Labels{"host": "b"}, 1)}},
+			"B": mathexp.Results{Values: mathexp.Values{number(data.Labels{"host": "a"}, 2), number(data.Labels{"host": "b"}, 2)}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []result{
+			{data.Labels{"host": "a"}, ptr.Float64(1)},
+			{data.Labels{"host": "b"}, ptr.Float64(0)},
+		}, actual)
+	})
+
+	t.Run("series are matched point by point", func(t *testing.T) {
+		series := func(labels data.Labels, values ...float64) mathexp.Series {
+			s := mathexp.NewSeries("", labels, len(values))
+			for i, f := range values {
+				f := f
+				s.SetPoint(i, time.Unix(int64(i), 0), &f)
+			}
+			return s
+		}
+		query := map[string]interface{}{"operator": "-", "ignoring": []interface{}{"kind"}, "left": "$A", "right": "$B"}
+		cmd, err := UnmarshalPromQLJoinCommand(&rawNode{RefID: "C", Query: query})
+		require.NoError(t, err)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{series(data.Labels{"host": "a", "kind": "total"}, 10, 20)}},
+			"B": mathexp.Results{Values: mathexp.Values{series(data.Labels{"host": "a", "kind": "used"}, 4, 5)}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Values, 1)
+		s, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+		require.Equal(t, 2, s.Len())
+		require.Equal(t, ptr.Float64(6), s.GetValue(0))
+		require.Equal(t, ptr.Float64(15), s.GetValue(1))
+	})
+
+	t.Run("division by zero follows the policy", func(t *testing.T) {
+		vars := mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{number(data.Labels{"host": "a"}, 5)}},
+			"B": mathexp.Results{Values: mathexp.Values{number(data.Labels{"host": "a"}, 0)}},
+		}
+		actual, err := execute(t, map[string]interface{}{"operator": "/", "divideByZero": "zero"}, vars)
+		require.NoError(t, err)
+		require.Equal(t, []result{{data.Labels{"host": "a"}, ptr.Float64(0)}}, actual)
+
+		_, err = execute(t, map[string]interface{}{"operator": "/", "divideByZero": "error"}, vars)
+		require.Error(t, err)
+	})
+
+	t.Run("should fail on many-to-one matching without groupLeft", func(t *testing.T) {
+		_, err := execute(t, map[string]interface{}{"operator": "*", "on": []interface{}{"job"}}, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"job": "api", "instance": "a"}, 2),
+				number(data.Labels{"job": "api", "instance": "b"}, 3),
+			}},
+			"B": mathexp.Results{Values: mathexp.Values{number(data.Labels{"job": "api"}, 10)}},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "many-to-many matching not allowed, use group_left or group_right")
+	})
+
+	t.Run("should fail on duplicates on the right side", func(t *testing.T) {
+		_, err := execute(t, map[string]interface{}{"operator": "*", "on": []interface{}{"job"}, "groupLeft": true}, mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{number(data.Labels{"job": "api"}, 2)}},
+			"B": mathexp.Results{Values: mathexp.Values{
+				number(data.Labels{"job": "api", "team": "web"}, 10),
+				number(data.Labels{"job": "api", "team": "ops"}, 20),
+			}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("should fail with both on and ignoring", func(t *testing.T) {
+		_, err := UnmarshalPromQLJoinCommand(&rawNode{RefID: "C", Query: map[string]interface{}{
+			"left": "$A", "right": "$B", "operator": "+", "on": []interface{}{"job"}, "ignoring": []interface{}{"instance"},
+		}})
+		require.Error(t, err)
+	})
+}
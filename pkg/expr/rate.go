@@ -0,0 +1,160 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// RateCommand is an expression command that computes the per-second rate of increase of
+// counter series. A decrease between two points is a counter reset: the counter is assumed
+// to have restarted from zero, so the increase is the value after the reset.
+type RateCommand struct {
+	VarToRate string
+	// Range is the window the rate of each point is computed over. When zero, the rate is
+	// computed between consecutive points.
+	Range time.Duration
+	refID string
+}
+
+// NewRateCommand creates a new RateCommand.
+func NewRateCommand(refID, varToRate string, rng time.Duration) (*RateCommand, error) {
+	if rng < 0 {
+		return nil, fmt.Errorf("rate range must not be negative, got %v", rng)
+	}
+	return &RateCommand{
+		VarToRate: varToRate,
+		Range:     rng,
+		refID:     refID,
+	}, nil
+}
+
+// UnmarshalRateCommand creates a RateCommand from Grafana's frontend query.
+func UnmarshalRateCommand(rn *rawNode) (*RateCommand, error) {
+	refID, err := rn.outputRefID(TypeRate)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToRate, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToRate = strings.TrimPrefix(varToRate, "$")
+
+	var rng time.Duration
+	if rawRange, ok := rn.Query["range"]; ok {
+		s, ok := rawRange.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "range", "a string", rawRange)
+		}
+		var err error
+		rng, err = gtime.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse rate "range" duration field %q: %w`, s, err)
+		}
+	}
+
+	return NewRateCommand(refID, varToRate, rng)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (rc *RateCommand) NeedsVars() []string {
+	return []string{rc.VarToRate}
+}
+
+// RefID returns the refID that names the results of the command.
+func (rc *RateCommand) RefID() string {
+	return rc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (rc *RateCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[rc.VarToRate].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			newRes.Values = append(newRes.Values, rc.rate(v))
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: rc.refID, Input: rc.VarToRate, Command: TypeRate, Expected: parse.TypeSeriesSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// rate returns the rate series of s, whose points must be sorted by time. Null and NaN
+// values are skipped. Each point of the result has the time of the point of s it ends at:
+//   - without Range, the rate is the increase since the previous point divided by the
+//     seconds between them, so the result is one point shorter than s;
+//   - with Range, the rate is the increase since the first point within (t-Range, t]
+//     divided by the seconds between them. Points without an earlier point in their
+//     range are dropped.
+func (rc *RateCommand) rate(s mathexp.Series) mathexp.Series {
+	type point struct {
+		t time.Time
+		v float64
+		// total is the increase of the counter since the first point, adjusted for resets.
+		total float64
+	}
+	points := make([]point, 0, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if f == nil || math.IsNaN(*f) {
+			continue
+		}
+		p := point{t: t, v: *f}
+		if n := len(points); n > 0 {
+			prev := points[n-1]
+			p.total = prev.total + counterIncrease(prev.v, p.v)
+		}
+		points = append(points, p)
+	}
+
+	res := mathexp.NewSeries(rc.refID, s.GetLabels().Copy(), 0)
+	start := 0
+	for i := 1; i < len(points); i++ {
+		if rc.Range == 0 {
+			start = i - 1
+		} else {
+			for points[i].t.Sub(points[start].t) >= rc.Range {
+				start++
+			}
+			if start == i {
+				continue
+			}
+		}
+		seconds := points[i].t.Sub(points[start].t).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		f := (points[i].total - points[start].total) / seconds
+		res.AppendPoint(points[i].t, &f)
+	}
+	return res
+}
+
+// counterIncrease returns the increase of a counter from prev to cur. A decrease is a
+// counter reset, in which case the counter restarted from zero and increased by cur.
+func counterIncrease(prev, cur float64) float64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
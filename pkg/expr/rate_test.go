@@ -0,0 +1,83 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestRateCommand(t *testing.T) {
+	// counter returns a series with a point every 10 seconds.
+	counter := func(values ...float64) mathexp.Series {
+		s := mathexp.NewSeries("A", data.Labels{"job": "api"}, len(values))
+		for i, v := range values {
+			s.SetPoint(i, time.Unix(int64(i*10), 0), ptr.Float64(v))
+		}
+		return s
+	}
+	type point struct {
+		sec  int64
+		rate float64
+	}
+
+	tests := []struct {
+		name     string
+		query    map[string]interface{}
+		input    mathexp.Series
+		expected []point
+	}{
+		{
+			name:     "monotonic counter",
+			query:    map[string]interface{}{"expression": "$A"},
+			input:    counter(0, 10, 30, 60),
+			expected: []point{{10, 1}, {20, 2}, {30, 3}},
+		},
+		{
+			name:     "counter with a reset",
+			query:    map[string]interface{}{"expression": "$A"},
+			input:    counter(0, 10, 20, 5, 15),
+			expected: []point{{10, 1}, {20, 1}, {30, 0.5}, {40, 1}},
+		},
+		{
+			name:     "counter with a reset over a range",
+			query:    map[string]interface{}{"expression": "$A", "range": "30s"},
+			input:    counter(0, 10, 20, 5, 15),
+			expected: []point{{10, 1}, {20, 1}, {30, 0.75}, {40, 0.75}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := UnmarshalRateCommand(&rawNode{RefID: "B", Query: tt.query})
+			require.NoError(t, err)
+			require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+			res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{tt.input}},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+			s, ok := res.Values[0].(mathexp.Series)
+			require.True(t, ok)
+			require.Equal(t, data.Labels{"job": "api"}, s.GetLabels())
+			require.Equal(t, len(tt.expected), s.Len())
+			for i, e := range tt.expected {
+				pt, f := s.GetPoint(i)
+				require.Equal(t, time.Unix(e.sec, 0), pt)
+				require.NotNil(t, f)
+				require.InDelta(t, e.rate, *f, 1e-9)
+			}
+		})
+	}
+
+	t.Run("should fail on an invalid range", func(t *testing.T) {
+		_, err := UnmarshalRateCommand(&rawNode{RefID: "B", Query: map[string]interface{}{"expression": "$A", "range": "foo"}})
+		require.Error(t, err)
+	})
+}
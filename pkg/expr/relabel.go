@@ -0,0 +1,157 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// RelabelCommand is an expression command that renames and prefixes the labels of numbers
+// and series, e.g. to keep labels apart before joining results. Labels are renamed first,
+// then Prefix is added to all labels.
+type RelabelCommand struct {
+	VarToRelabel string
+	// Rename maps label names to their new name.
+	Rename map[string]string
+	Prefix string
+	refID  string
+}
+
+// NewRelabelCommand creates a new RelabelCommand.
+func NewRelabelCommand(refID, varToRelabel string, rename map[string]string, prefix string) (*RelabelCommand, error) {
+	if len(rename) == 0 && prefix == "" {
+		return nil, fmt.Errorf("relabel expression '%s' must rename or prefix labels", refID)
+	}
+	for from, to := range rename {
+		if to == "" {
+			return nil, fmt.Errorf("relabel expression '%s' cannot rename label %q to an empty name", refID, from)
+		}
+	}
+	return &RelabelCommand{
+		VarToRelabel: varToRelabel,
+		Rename:       rename,
+		Prefix:       prefix,
+		refID:        refID,
+	}, nil
+}
+
+// UnmarshalRelabelCommand creates a RelabelCommand from Grafana's frontend query.
+func UnmarshalRelabelCommand(rn *rawNode) (*RelabelCommand, error) {
+	refID, err := rn.outputRefID(TypeRelabel)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToRelabel, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToRelabel = strings.TrimPrefix(varToRelabel, "$")
+
+	var rename map[string]string
+	if rawRename, ok := rn.Query["rename"]; ok {
+		m, ok := rawRename.(map[string]interface{})
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "rename", "an object", rawRename)
+		}
+		rename = make(map[string]string, len(m))
+		for from, rawTo := range m {
+			to, ok := rawTo.(string)
+			if !ok {
+				return nil, newErrInvalidInputType(rn.RefID, "rename."+from, "a string", rawTo)
+			}
+			rename[from] = to
+		}
+	}
+
+	var prefix string
+	if rawPrefix, ok := rn.Query["prefix"]; ok {
+		prefix, ok = rawPrefix.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "prefix", "a string", rawPrefix)
+		}
+	}
+
+	return NewRelabelCommand(refID, varToRelabel, rename, prefix)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (rc *RelabelCommand) NeedsVars() []string {
+	return []string{rc.VarToRelabel}
+}
+
+// RefID returns the refID that names the results of the command.
+func (rc *RelabelCommand) RefID() string {
+	return rc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. The input values are not modified, copies with the new labels
+// are returned.
+func (rc *RelabelCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[rc.VarToRelabel].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			labels, err := rc.relabel(v.GetLabels())
+			if err != nil {
+				return newRes, err
+			}
+			s := mathexp.NewSeries(rc.refID, labels, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				t, f := v.GetPoint(i)
+				s.SetPoint(i, t, f)
+			}
+			newRes.Values = append(newRes.Values, s)
+		case mathexp.Number:
+			labels, err := rc.relabel(v.GetLabels())
+			if err != nil {
+				return newRes, err
+			}
+			n := mathexp.NewNumber(rc.refID, labels)
+			n.SetValue(v.GetFloat64Value())
+			newRes.Values = append(newRes.Values, n)
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: rc.refID, Input: rc.VarToRelabel, Command: TypeRelabel, Expected: parse.TypeVariantSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// relabel returns a copy of labels with the labels renamed and prefixed. It fails if two
+// labels end up with the same name.
+func (rc *RelabelCommand) relabel(labels data.Labels) (data.Labels, error) {
+	if len(labels) == 0 {
+		return labels, nil
+	}
+	res := make(data.Labels, len(labels))
+	from := make(map[string]string, len(labels))
+	for k, v := range labels {
+		name := k
+		if to, ok := rc.Rename[k]; ok {
+			name = to
+		}
+		name = rc.Prefix + name
+		if other, ok := from[name]; ok {
+			return nil, fmt.Errorf("relabel expression '%s' maps both labels %q and %q to %q", rc.refID, other, k, name)
+		}
+		from[name] = k
+		res[name] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,79 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestRelabelCommand(t *testing.T) {
+	series := mathexp.NewSeries("A", data.Labels{"instance": "a:9090", "job": "api"}, 2)
+	series.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+	series.SetPoint(1, time.Unix(60, 0), ptr.Float64(2))
+	number := mathexp.NewNumber("A", data.Labels{"instance": "b:9090"})
+	number.SetValue(ptr.Float64(3))
+	vars := mathexp.Vars{"A": mathexp.Results{Values: mathexp.Values{series, number}}}
+
+	execute := func(t *testing.T, query map[string]interface{}) mathexp.Results {
+		t.Helper()
+		cmd, err := UnmarshalRelabelCommand(&rawNode{RefID: "B", Query: query})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, cmd.NeedsVars())
+		res, err := cmd.Execute(context.Background(), time.Now(), vars)
+		require.NoError(t, err)
+		require.Len(t, res.Values, 2)
+		return res
+	}
+
+	t.Run("should rename a label", func(t *testing.T) {
+		res := execute(t, map[string]interface{}{
+			"expression": "$A",
+			"rename":     map[string]interface{}{"instance": "host"},
+		})
+
+		s, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"host": "a:9090", "job": "api"}, s.GetLabels())
+		require.Equal(t, 2, s.Len())
+		pt, f := s.GetPoint(1)
+		require.Equal(t, time.Unix(60, 0), pt)
+		require.Equal(t, ptr.Float64(2), f)
+
+		n, ok := res.Values[1].(mathexp.Number)
+		require.True(t, ok)
+		require.Equal(t, data.Labels{"host": "b:9090"}, n.GetLabels())
+		require.Equal(t, ptr.Float64(3), n.GetFloat64Value())
+
+		// The input is not modified.
+		require.Equal(t, data.Labels{"instance": "a:9090", "job": "api"}, series.GetLabels())
+	})
+
+	t.Run("should prefix all labels", func(t *testing.T) {
+		res := execute(t, map[string]interface{}{
+			"expression": "$A",
+			"rename":     map[string]interface{}{"instance": "host"},
+			"prefix":     "src_",
+		})
+		require.Equal(t, data.Labels{"src_host": "a:9090", "src_job": "api"}, res.Values[0].GetLabels())
+		require.Equal(t, data.Labels{"src_host": "b:9090"}, res.Values[1].GetLabels())
+	})
+
+	t.Run("should fail on label collisions", func(t *testing.T) {
+		cmd, err := NewRelabelCommand("B", "A", map[string]string{"instance": "job"}, "")
+		require.NoError(t, err)
+		_, err = cmd.Execute(context.Background(), time.Now(), vars)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `to "job"`)
+	})
+
+	t.Run("should fail without rename or prefix", func(t *testing.T) {
+		_, err := UnmarshalRelabelCommand(&rawNode{RefID: "B", Query: map[string]interface{}{"expression": "$A"}})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,166 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+// RollingCommand is an expression command that smooths series with a moving aggregation:
+// each point is replaced by the reduction of the points within the Window that ends at it,
+// including the point itself. The result has the same timestamps as the input.
+type RollingCommand struct {
+	VarToRoll string
+	Window    time.Duration
+	Reducer   string
+	refID     string
+}
+
+// GetSupportedRollingReducers returns the reducers supported by the rolling command.
+func GetSupportedRollingReducers() []string {
+	return []string{"mean", "sum", "min", "max"}
+}
+
+// NewRollingCommand creates a new RollingCommand.
+func NewRollingCommand(refID, varToRoll string, window time.Duration, reducer string) (*RollingCommand, error) {
+	if !isSupported(reducer, GetSupportedRollingReducers()) {
+		return nil, fmt.Errorf("rolling reducer %q is not supported. Supported: %v", reducer, GetSupportedRollingReducers())
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("rolling window must be greater than zero, got %v", window)
+	}
+	return &RollingCommand{
+		VarToRoll: varToRoll,
+		Window:    window,
+		Reducer:   reducer,
+		refID:     refID,
+	}, nil
+}
+
+// UnmarshalRollingCommand creates a RollingCommand from Grafana's frontend query.
+func UnmarshalRollingCommand(rn *rawNode) (*RollingCommand, error) {
+	refID, err := rn.outputRefID(TypeRolling)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToRoll, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToRoll = strings.TrimPrefix(varToRoll, "$")
+
+	rawWindow, ok := rn.Query["window"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "window"}
+	}
+	windowString, ok := rawWindow.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "window", "a string", rawWindow)
+	}
+	window, err := gtime.ParseDuration(windowString)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse rolling "window" duration field %q: %w`, windowString, err)
+	}
+
+	rawReducer, ok := rn.Query["reducer"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "reducer"}
+	}
+	reducer, ok := rawReducer.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "reducer", "a string", rawReducer)
+	}
+
+	return NewRollingCommand(refID, varToRoll, window, reducer)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (rc *RollingCommand) NeedsVars() []string {
+	return []string{rc.VarToRoll}
+}
+
+// RefID returns the refID that names the results of the command.
+func (rc *RollingCommand) RefID() string {
+	return rc.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (rc *RollingCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[rc.VarToRoll].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Series:
+			newRes.Values = append(newRes.Values, rc.roll(v))
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: rc.refID, Input: rc.VarToRoll, Command: TypeRolling, Expected: parse.TypeSeriesSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// roll returns the series of the rolling reduction of s, whose points must be sorted by time.
+// A point aggregates the points of s in (t-Window, t]. The first points, for which the full
+// window is not available, aggregate the points available so far. Null and NaN values are
+// skipped, and a point is null when its window has no other value.
+func (rc *RollingCommand) roll(s mathexp.Series) mathexp.Series {
+	res := mathexp.NewSeries(rc.refID, s.GetLabels().Copy(), s.Len())
+	start := 0
+	for i := 0; i < s.Len(); i++ {
+		t := s.GetTime(i)
+		for t.Sub(s.GetTime(start)) >= rc.Window {
+			start++
+		}
+
+		var values []float64
+		for j := start; j <= i; j++ {
+			if f := s.GetValue(j); f != nil && !math.IsNaN(*f) {
+				values = append(values, *f)
+			}
+		}
+		res.SetPoint(i, t, rc.reduce(values))
+	}
+	return res
+}
+
+func (rc *RollingCommand) reduce(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	f := values[0]
+	switch rc.Reducer {
+	case "sum", "mean":
+		for _, v := range values[1:] {
+			f += v
+		}
+		if rc.Reducer == "mean" {
+			f /= float64(len(values))
+		}
+	case "min":
+		for _, v := range values[1:] {
+			f = math.Min(f, v)
+		}
+	case "max":
+		for _, v := range values[1:] {
+			f = math.Max(f, v)
+		}
+	}
+	return &f
+}
@@ -0,0 +1,129 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+func TestRollingCommand(t *testing.T) {
+	series := func(values ...*float64) mathexp.Series {
+		s := mathexp.NewSeries("A", data.Labels{"host": "a"}, len(values))
+		for i, v := range values {
+			s.SetPoint(i, time.Unix(int64(i*60), 0), v)
+		}
+		return s
+	}
+	input := series(ptr.Float64(1), ptr.Float64(2), ptr.Float64(3), ptr.Float64(4), ptr.Float64(10))
+
+	tests := []struct {
+		name     string
+		window   string
+		reducer  string
+		input    mathexp.Series
+		expected []*float64
+	}{
+		{
+			name:     "moving average with a partial window for the first point",
+			window:   "2m",
+			reducer:  "mean",
+			input:    input,
+			expected: []*float64{ptr.Float64(1), ptr.Float64(1.5), ptr.Float64(2.5), ptr.Float64(3.5), ptr.Float64(7)},
+		},
+		{
+			name:     "moving average with partial windows for the first two points",
+			window:   "3m",
+			reducer:  "mean",
+			input:    input,
+			expected: []*float64{ptr.Float64(1), ptr.Float64(1.5), ptr.Float64(2), ptr.Float64(3), ptr.Float64(17.0 / 3)},
+		},
+		{
+			name:     "moving sum",
+			window:   "2m",
+			reducer:  "sum",
+			input:    input,
+			expected: []*float64{ptr.Float64(1), ptr.Float64(3), ptr.Float64(5), ptr.Float64(7), ptr.Float64(14)},
+		},
+		{
+			name:     "moving min",
+			window:   "2m",
+			reducer:  "min",
+			input:    input,
+			expected: []*float64{ptr.Float64(1), ptr.Float64(1), ptr.Float64(2), ptr.Float64(3), ptr.Float64(4)},
+		},
+		{
+			name:     "moving max",
+			window:   "2m",
+			reducer:  "max",
+			input:    input,
+			expected: []*float64{ptr.Float64(1), ptr.Float64(2), ptr.Float64(3), ptr.Float64(4), ptr.Float64(10)},
+		},
+		{
+			name:     "null values are skipped",
+			window:   "2m",
+			reducer:  "mean",
+			input:    series(ptr.Float64(1), nil, nil, ptr.Float64(4), ptr.Float64(10)),
+			expected: []*float64{ptr.Float64(1), ptr.Float64(1), nil, ptr.Float64(4), ptr.Float64(7)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := UnmarshalRollingCommand(&rawNode{
+				RefID: "B",
+				Query: map[string]interface{}{"expression": "$A", "window": tt.window, "reducer": tt.reducer},
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+			res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+				"A": mathexp.Results{Values: mathexp.Values{tt.input}},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.Values, 1)
+			s, ok := res.Values[0].(mathexp.Series)
+			require.True(t, ok)
+			require.Equal(t, data.Labels{"host": "a"}, s.GetLabels())
+			require.Equal(t, len(tt.expected), s.Len())
+			for i, e := range tt.expected {
+				pt, f := s.GetPoint(i)
+				require.Equal(t, tt.input.GetTime(i), pt)
+				if e == nil {
+					require.Nil(t, f)
+					continue
+				}
+				require.NotNil(t, f)
+				require.InDelta(t, *e, *f, 1e-9)
+			}
+		})
+	}
+
+	t.Run("should fail on numbers", func(t *testing.T) {
+		cmd, err := NewRollingCommand("B", "A", time.Minute, "mean")
+		require.NoError(t, err)
+		_, err = cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{mathexp.NewNumber("A", nil)}},
+		})
+		require.ErrorIs(t, err, ErrInputTypeMismatch{RefID: "B", Input: "A", Command: TypeRolling, Expected: parse.TypeSeriesSet, Actual: parse.TypeNumberSet})
+	})
+
+	t.Run("should fail on invalid fields", func(t *testing.T) {
+		for _, q := range []map[string]interface{}{
+			{"expression": "$A", "reducer": "mean"},
+			{"expression": "$A", "window": "1m"},
+			{"expression": "$A", "window": "1m", "reducer": "last"},
+			{"expression": "$A", "window": "0s", "reducer": "mean"},
+			{"expression": "$A", "window": "foo", "reducer": "mean"},
+		} {
+			_, err := UnmarshalRollingCommand(&rawNode{RefID: "B", Query: q})
+			require.Error(t, err)
+		}
+	})
+}
@@ -12,9 +12,9 @@ import (
 
 type ThresholdCommand struct {
 	ReferenceVar  string
-	RefID         string
 	ThresholdFunc string
 	Conditions    []float64
+	refID         string
 }
 
 const (
@@ -30,10 +30,10 @@ var (
 
 func NewThresholdCommand(refID, referenceVar, thresholdFunc string, conditions []float64) (*ThresholdCommand, error) {
 	return &ThresholdCommand{
-		RefID:         refID,
 		ReferenceVar:  referenceVar,
 		ThresholdFunc: thresholdFunc,
 		Conditions:    conditions,
+		refID:         refID,
 	}, nil
 }
 
@@ -48,6 +48,10 @@ type ConditionEvalJSON struct {
 
 // UnmarshalResampleCommand creates a ResampleCMD from Grafana's frontend query.
 func UnmarshalThresholdCommand(rn *rawNode) (*ThresholdCommand, error) {
+	refID, err := rn.outputRefID(TypeThreshold)
+	if err != nil {
+		return nil, err
+	}
 	rawQuery := rn.Query
 
 	rawExpression, ok := rawQuery["expression"]
@@ -80,7 +84,7 @@ func UnmarshalThresholdCommand(rn *rawNode) (*ThresholdCommand, error) {
 	}
 	firstCondition := conditions[0]
 
-	return NewThresholdCommand(rn.RefID, referenceVar, firstCondition.Evaluator.Type, firstCondition.Evaluator.Params)
+	return NewThresholdCommand(refID, referenceVar, firstCondition.Evaluator.Type, firstCondition.Evaluator.Params)
 }
 
 // NeedsVars returns the variable names (refIds) that are dependencies
@@ -89,13 +93,18 @@ func (tc *ThresholdCommand) NeedsVars() []string {
 	return []string{tc.ReferenceVar}
 }
 
+// RefID returns the refID that names the results of the command.
+func (tc *ThresholdCommand) RefID() string {
+	return tc.refID
+}
+
 func (tc *ThresholdCommand) Execute(ctx context.Context, now time.Time, vars mathexp.Vars) (mathexp.Results, error) {
 	mathExpression, err := createMathExpression(tc.ReferenceVar, tc.ThresholdFunc, tc.Conditions)
 	if err != nil {
 		return mathexp.Results{}, err
 	}
 
-	mathCommand, err := NewMathCommand(tc.ReferenceVar, mathExpression)
+	mathCommand, err := NewMathCommand(tc.refID, mathExpression, mathexp.DivByZeroDefault)
 	if err != nil {
 		return mathexp.Results{}, err
 	}
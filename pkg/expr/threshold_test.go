@@ -1,10 +1,15 @@
 package expr
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
 )
 
 func TestNewThresholdCommand(t *testing.T) {
@@ -90,7 +95,7 @@ func TestUnmarshalThresholdCommand(t *testing.T) {
 		require.NoError(t, json.Unmarshal(q, &qmap))
 
 		cmd, err := UnmarshalThresholdCommand(&rawNode{
-			RefID:      "",
+			RefID:      "B",
 			Query:      qmap,
 			QueryType:  "",
 			DataSource: nil,
@@ -113,6 +118,27 @@ func TestThresholdCommandVars(t *testing.T) {
 	require.Equal(t, cmd.NeedsVars(), []string{"A"})
 }
 
+func TestThresholdCommandExecute(t *testing.T) {
+	series := mathexp.NewSeries("A", nil, 2)
+	series.SetPoint(0, time.Unix(0, 0), ptr.Float64(1))
+	series.SetPoint(1, time.Unix(60, 0), ptr.Float64(3))
+
+	cmd, err := NewThresholdCommand("B", "A", ThresholdIsAbove, []float64{2})
+	require.NoError(t, err)
+
+	res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+		"A": mathexp.Results{Values: mathexp.Values{series}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Values, 1)
+	result, ok := res.Values[0].(mathexp.Series)
+	require.True(t, ok)
+	// The results are named after the threshold expression, not its input.
+	require.Equal(t, "B", result.GetName())
+	require.Equal(t, ptr.Float64(0), result.GetValue(0))
+	require.Equal(t, ptr.Float64(1), result.GetValue(1))
+}
+
 func TestCreateMathExpression(t *testing.T) {
 	type testCase struct {
 		description string
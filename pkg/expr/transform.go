@@ -13,7 +13,9 @@ import (
 )
 
 var (
-	expressionsQuerySummary *prometheus.SummaryVec
+	expressionsQuerySummary   *prometheus.SummaryVec
+	expressionsCommandCounter *prometheus.CounterVec
+	expressionsCommandSeconds *prometheus.HistogramVec
 )
 
 func init() {
@@ -26,7 +28,24 @@ func init() {
 		[]string{"status"},
 	)
 
-	prometheus.MustRegister(expressionsQuerySummary)
+	expressionsCommandCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "expressions_command_executions_total",
+			Help: "Number of executed expression commands by command type and status",
+		},
+		[]string{"command", "status"},
+	)
+
+	expressionsCommandSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "expressions_command_duration_seconds",
+			Help:    "Duration of expression command execution by command type",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		},
+		[]string{"command"},
+	)
+
+	prometheus.MustRegister(expressionsQuerySummary, expressionsCommandCounter, expressionsCommandSeconds)
 }
 
 // Request is similar to plugins.DataQuery but with the Time Ranges is per Query.
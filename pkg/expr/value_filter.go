@@ -0,0 +1,168 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+	"github.com/grafana/grafana/pkg/expr/mathexp/parse"
+)
+
+const (
+	ValueFilterGt  = "gt"
+	ValueFilterLt  = "lt"
+	ValueFilterGte = "gte"
+	ValueFilterLte = "lte"
+	ValueFilterEq  = "eq"
+	ValueFilterNeq = "neq"
+)
+
+var supportedValueFilterOperators = []string{ValueFilterGt, ValueFilterLt, ValueFilterGte, ValueFilterLte, ValueFilterEq, ValueFilterNeq}
+
+// ValueFilterCommand is an expression command that keeps the numbers of its input whose
+// value compared to Threshold with Operator is true. Null and NaN values never match.
+// When Reducer is set, series are accepted too: each series is kept as it is if its
+// value reduced by Reducer matches.
+type ValueFilterCommand struct {
+	VarToFilter string
+	Operator    string
+	Threshold   float64
+	Reducer     string
+	refID       string
+}
+
+// NewValueFilterCommand creates a new ValueFilterCommand. reducer may be empty, in which
+// case the command fails on series.
+func NewValueFilterCommand(refID, varToFilter, operator string, threshold float64, reducer string) (*ValueFilterCommand, error) {
+	if !isSupported(operator, supportedValueFilterOperators) {
+		return nil, fmt.Errorf("value filter operator %q is not supported. Supported: %v", operator, supportedValueFilterOperators)
+	}
+	if reducer != "" {
+		if _, err := mathexp.GetReduceFunc(reducer); err != nil {
+			return nil, err
+		}
+	}
+	return &ValueFilterCommand{
+		VarToFilter: varToFilter,
+		Operator:    operator,
+		Threshold:   threshold,
+		Reducer:     reducer,
+		refID:       refID,
+	}, nil
+}
+
+// UnmarshalValueFilterCommand creates a ValueFilterCommand from Grafana's frontend query.
+func UnmarshalValueFilterCommand(rn *rawNode) (*ValueFilterCommand, error) {
+	refID, err := rn.outputRefID(TypeValueFilter)
+	if err != nil {
+		return nil, err
+	}
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("%w: must be a reference to an existing query or expression", ErrMissingField{RefID: rn.RefID, Field: "expression"})
+	}
+	varToFilter, ok := rawVar.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "expression", "a string", rawVar)
+	}
+	varToFilter = strings.TrimPrefix(varToFilter, "$")
+
+	rawOperator, ok := rn.Query["operator"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "operator"}
+	}
+	operator, ok := rawOperator.(string)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "operator", "a string", rawOperator)
+	}
+
+	rawThreshold, ok := rn.Query["threshold"]
+	if !ok {
+		return nil, ErrMissingField{RefID: rn.RefID, Field: "threshold"}
+	}
+	threshold, ok := rawThreshold.(float64)
+	if !ok {
+		return nil, newErrInvalidInputType(rn.RefID, "threshold", "a number", rawThreshold)
+	}
+
+	var reducer string
+	if rawReducer, ok := rn.Query["reducer"]; ok {
+		reducer, ok = rawReducer.(string)
+		if !ok {
+			return nil, newErrInvalidInputType(rn.RefID, "reducer", "a string", rawReducer)
+		}
+	}
+
+	return NewValueFilterCommand(refID, varToFilter, operator, threshold, reducer)
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (vf *ValueFilterCommand) NeedsVars() []string {
+	return []string{vf.VarToFilter}
+}
+
+// RefID returns the refID that names the results of the command.
+func (vf *ValueFilterCommand) RefID() string {
+	return vf.refID
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (vf *ValueFilterCommand) Execute(_ context.Context, _ time.Time, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[vf.VarToFilter].Values {
+		switch v := val.(type) {
+		case nil:
+			continue
+		case mathexp.Number:
+			if vf.matches(v.GetFloat64Value()) {
+				copyV := mathexp.NewNumber(vf.refID, v.GetLabels())
+				copyV.SetValue(v.GetFloat64Value())
+				newRes.Values = append(newRes.Values, copyV)
+			}
+		case mathexp.Series:
+			if vf.Reducer == "" {
+				return newRes, ErrInputTypeMismatch{RefID: vf.refID, Input: vf.VarToFilter, Command: TypeValueFilter, Expected: parse.TypeNumberSet, Actual: val.Type()}
+			}
+			num, err := v.Reduce(vf.refID, vf.Reducer, nil)
+			if err != nil {
+				return newRes, err
+			}
+			if vf.matches(num.GetFloat64Value()) {
+				newRes.Values = append(newRes.Values, renameSeries(v, vf.refID))
+			}
+		case mathexp.NoData:
+			newRes.Values = append(newRes.Values, v.New())
+			return newRes, nil
+		default:
+			return newRes, ErrInputTypeMismatch{RefID: vf.refID, Input: vf.VarToFilter, Command: TypeValueFilter, Expected: parse.TypeNumberSet, Actual: val.Type()}
+		}
+	}
+	return newRes, nil
+}
+
+// matches returns true if f compared to the threshold with the operator is true.
+func (vf *ValueFilterCommand) matches(f *float64) bool {
+	if f == nil || math.IsNaN(*f) {
+		return false
+	}
+	switch vf.Operator {
+	case ValueFilterGt:
+		return *f > vf.Threshold
+	case ValueFilterLt:
+		return *f < vf.Threshold
+	case ValueFilterGte:
+		return *f >= vf.Threshold
+	case ValueFilterLte:
+		return *f <= vf.Threshold
+	case ValueFilterEq:
+		return *f == vf.Threshold
+	case ValueFilterNeq:
+		return *f != vf.Threshold
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package expr
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+	ptr "github.com/xorcare/pointer"
+
+	"github.com/grafana/grafana/pkg/expr/mathexp"
+)
+
+func TestValueFilterCommand(t *testing.T) {
+	number := func(host string, f *float64) mathexp.Number {
+		n := mathexp.NewNumber("A", data.Labels{"host": host})
+		n.SetValue(f)
+		return n
+	}
+	input := mathexp.Values{
+		number("a", ptr.Float64(70)),
+		number("b", ptr.Float64(80)),
+		number("c", ptr.Float64(90)),
+		number("nan", ptr.Float64(math.NaN())),
+		number("null", nil),
+	}
+
+	tests := []struct {
+		operator string
+		expected []string
+	}{
+		{operator: "gt", expected: []string{"c"}},
+		{operator: "lt", expected: []string{"a"}},
+		{operator: "gte", expected: []string{"b", "c"}},
+		{operator: "lte", expected: []string{"a", "b"}},
+		{operator: "eq", expected: []string{"b"}},
+		// NaN and null never match, even with neq
+		{operator: "neq", expected: []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operator, func(t *testing.T) {
+			cmd, err := UnmarshalValueFilterCommand(&rawNode{
+				RefID: "B",
+				Query: map[string]interface{}{"expression": "$A", "operator": tt.operator, "threshold": 80.0},
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"A"}, cmd.NeedsVars())
+
+			res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+				"A": mathexp.Results{Values: input},
+			})
+			require.NoError(t, err)
+			var hosts []string
+			for _, v := range res.Values {
+				hosts = append(hosts, v.GetLabels()["host"])
+			}
+			require.Equal(t, tt.expected, hosts)
+		})
+	}
+
+	t.Run("series are kept if their reduced value matches", func(t *testing.T) {
+		cmd, err := UnmarshalValueFilterCommand(&rawNode{
+			RefID: "B",
+			Query: map[string]interface{}{"expression": "$A", "operator": "gt", "threshold": 80.0, "reducer": "max"},
+		})
+		require.NoError(t, err)
+
+		series := func(host string, values ...float64) mathexp.Series {
+			s := mathexp.NewSeries("A", data.Labels{"host": host}, len(values))
+			for i, v := range values {
+				s.SetPoint(i, time.Unix(int64(i), 0), ptr.Float64(v))
+			}
+			return s
+		}
+		high := series("high", 10, 95, 20)
+		res, err := cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{series("low", 10, 20), high}},
+		})
+		require.NoError(t, err)
+		// The series is kept unchanged, but named after the filter.
+		require.Equal(t, mathexp.Values{renameSeries(high, "B")}, res.Values)
+		result, ok := res.Values[0].(mathexp.Series)
+		require.True(t, ok)
+		require.Equal(t, "B", result.GetName())
+	})
+
+	t.Run("should fail on series without reducer", func(t *testing.T) {
+		cmd, err := NewValueFilterCommand("B", "A", "gt", 80, "")
+		require.NoError(t, err)
+		_, err = cmd.Execute(context.Background(), time.Now(), mathexp.Vars{
+			"A": mathexp.Results{Values: mathexp.Values{mathexp.NewSeries("A", nil, 0)}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("should fail on invalid fields", func(t *testing.T) {
+		for _, q := range []map[string]interface{}{
+			{"expression": "$A", "threshold": 80.0},
+			{"expression": "$A", "operator": "gt"},
+			{"expression": "$A", "operator": "above", "threshold": 80.0},
+			{"expression": "$A", "operator": "gt", "threshold": "80"},
+			{"expression": "$A", "operator": "gt", "threshold": 80.0, "reducer": "median"},
+		} {
+			_, err := UnmarshalValueFilterCommand(&rawNode{RefID: "B", Query: q})
+			require.Error(t, err)
+		}
+	})
+}
@@ -1,7 +1,18 @@
 package tracing
 
+import (
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
 func InitializeTracerForTest() Tracer {
 	ots := &Opentelemetry{enabled: noopExporter}
 	_ = ots.initOpentelemetryTracer()
 	return ots
 }
+
+// InitializeTracerForTestWithSpanRecorder returns a Tracer that records the spans it creates in sr.
+func InitializeTracerForTestWithSpanRecorder(sr *tracetest.SpanRecorder) Tracer {
+	tp := tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(sr))
+	return &Opentelemetry{tracerProvider: tp, tracer: tp.Tracer("test")}
+}
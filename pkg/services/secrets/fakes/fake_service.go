@@ -2,6 +2,7 @@ package fakes
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/grafana/grafana/pkg/services/secrets"
 )
@@ -15,6 +16,9 @@ func NewFakeSecretsService() FakeSecretsService {
 func (f FakeSecretsService) Encrypt(_ context.Context, payload []byte, _ secrets.EncryptionOptions) ([]byte, error) {
 	return payload, nil
 }
+func (f FakeSecretsService) EncryptWithProvider(_ context.Context, payload []byte, _ secrets.ProviderID, _ secrets.EncryptionOptions) ([]byte, error) {
+	return payload, nil
+}
 func (f FakeSecretsService) Decrypt(_ context.Context, payload []byte) ([]byte, error) {
 	return payload, nil
 }
@@ -33,6 +37,20 @@ func (f FakeSecretsService) DecryptJsonData(_ context.Context, sjd map[string][]
 	}
 	return result, nil
 }
+func (f FakeSecretsService) EncryptJSON(_ context.Context, v interface{}, _ secrets.EncryptionOptions) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func (f FakeSecretsService) DecryptJSON(_ context.Context, blob []byte, v interface{}) error {
+	if len(blob) == 0 {
+		return nil
+	}
+	return json.Unmarshal(blob, v)
+}
+
 func (f FakeSecretsService) GetDecryptedValue(_ context.Context, sjd map[string][]byte, key, fallback string) string {
 	if value, ok := sjd[key]; ok {
 		return string(value)
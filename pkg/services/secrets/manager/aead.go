@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/grafana/grafana/pkg/services/encryption"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// sealAESGCM encrypts payload with AES-GCM, using a key derived from dataKey, and
+// authenticates associatedData along with it. The result is laid out as the salt,
+// the nonce and then the ciphertext, like the payloads of the aes-gcm decipher.
+func sealAESGCM(payload, dataKey, associatedData []byte) ([]byte, error) {
+	salt, err := util.GetRandomString(encryption.SaltLength)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, encryption.SaltLength+len(nonce)+len(payload)+gcm.Overhead())
+	sealed = append(sealed, salt...)
+	sealed = append(sealed, nonce...)
+	return gcm.Seal(sealed, nonce, payload, associatedData), nil
+}
+
+// openAESGCM decrypts a payload encrypted by sealAESGCM. It fails if the payload
+// was tampered with or associatedData doesn't match the one it was encrypted with.
+func openAESGCM(payload, dataKey, associatedData []byte) ([]byte, error) {
+	if len(payload) < encryption.SaltLength {
+		return nil, errors.New("unable to compute salt")
+	}
+
+	gcm, err := newGCM(dataKey, string(payload[:encryption.SaltLength]))
+	if err != nil {
+		return nil, err
+	}
+
+	payload = payload[encryption.SaltLength:]
+	if len(payload) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("payload too short")
+	}
+
+	nonce, ciphertext := payload[:gcm.NonceSize()], payload[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, associatedData)
+}
+
+func newGCM(dataKey []byte, salt string) (cipher.AEAD, error) {
+	key, err := encryption.KeyToBytes(string(dataKey), salt)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -1,11 +1,8 @@
 package manager
 
 import (
-	"strconv"
 	"sync"
 	"time"
-
-	"github.com/prometheus/client_golang/prometheus"
 )
 
 type dataKeyCacheEntry struct {
@@ -40,13 +37,10 @@ func (c *dataKeyCache) getById(id string) (*dataKeyCacheEntry, bool) {
 	defer c.mtx.RUnlock()
 
 	entry, exists := c.byId[id]
+	hit := exists && !entry.expired()
+	observeCacheRead("byId", hit)
 
-	cacheReadsCounter.With(prometheus.Labels{
-		"hit":    strconv.FormatBool(exists),
-		"method": "byId",
-	}).Inc()
-
-	if !exists || entry.expired() {
+	if !hit {
 		return nil, false
 	}
 
@@ -58,13 +52,10 @@ func (c *dataKeyCache) getByLabel(label string) (*dataKeyCacheEntry, bool) {
 	defer c.mtx.RUnlock()
 
 	entry, exists := c.byLabel[label]
+	hit := exists && !entry.expired()
+	observeCacheRead("byLabel", hit)
 
-	cacheReadsCounter.With(prometheus.Labels{
-		"hit":    strconv.FormatBool(exists),
-		"method": "byLabel",
-	}).Inc()
-
-	if !exists || entry.expired() {
+	if !hit {
 		return nil, false
 	}
 
@@ -2,16 +2,19 @@ package manager
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"sync"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/hashicorp/go-multierror"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/grafana/grafana/pkg/infra/log"
@@ -26,6 +29,38 @@ import (
 
 const (
 	keyIdDelimiter = '#'
+	// compressedDelimiter replaces the closing keyIdDelimiter when the
+	// payload was gzip-compressed before being encrypted. It can't be
+	// part of the base64-encoded key id.
+	compressedDelimiter = '*'
+	// versionedDelimiter replaces the closing keyIdDelimiter when it's
+	// followed by a format version byte. Payloads closed by keyIdDelimiter
+	// or compressedDelimiter are the unversioned forms of the
+	// formatEncryptionService and formatEncryptionServiceCompressed ones.
+	versionedDelimiter = '$'
+)
+
+// Format versions of the payloads closed by versionedDelimiter. The version byte
+// follows the delimiter and selects how the rest of the payload is decrypted, so
+// that new formats can be introduced while payloads of the previous ones are
+// still decrypted. Payloads of unknown versions are rejected.
+//
+// Payloads encrypted by the encryption service are still written unversioned, so
+// that older Grafana versions can decrypt them, e.g. when rolling back.
+const (
+	// formatEncryptionService payloads are encrypted by the encryption service,
+	// like the unversioned payloads closed by keyIdDelimiter.
+	formatEncryptionService byte = 0
+	// formatAESGCM payloads are encrypted with AES-GCM, authenticating the
+	// payload header (key id and format version) as associated data.
+	formatAESGCM byte = 1
+	// formatAESGCMCompressed payloads are formatAESGCM payloads that were
+	// gzip-compressed before being encrypted.
+	formatAESGCMCompressed byte = 2
+	// formatEncryptionServiceCompressed payloads are formatEncryptionService
+	// payloads that were gzip-compressed before being encrypted, like the
+	// unversioned payloads closed by compressedDelimiter.
+	formatEncryptionServiceCompressed byte = 3
 )
 
 var (
@@ -50,6 +85,16 @@ type SecretsService struct {
 
 	currentProviderID secrets.ProviderID
 
+	// compressionMinSize is the payload size, in bytes, from which payloads
+	// are gzip-compressed before being encrypted. Zero disables compression.
+	compressionMinSize int
+	// authenticatedEncryption makes payloads be encrypted with AES-GCM,
+	// binding them to their data key id, see formatAESGCM.
+	authenticatedEncryption bool
+	// fallbackProviders are the providers tried in turn to decrypt a data key
+	// when the provider that encrypted it fails.
+	fallbackProviders []secrets.ProviderID
+
 	log log.Logger
 }
 
@@ -67,16 +112,29 @@ func ProvideSecretsService(
 		settings.KeyValue("security", "encryption_provider").MustString(kmsproviders.Default),
 	))
 
+	compressionMinSize, err := strconv.Atoi(settings.KeyValue("security.encryption", "compression_min_size").MustString("0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compression_min_size: %w", err)
+	}
+
+	var fallbackProviders []secrets.ProviderID
+	for _, id := range util.SplitString(settings.KeyValue("security", "fallback_encryption_providers").MustString("")) {
+		fallbackProviders = append(fallbackProviders, kmsproviders.NormalizeProviderID(secrets.ProviderID(id)))
+	}
+
 	s := &SecretsService{
-		store:               store,
-		enc:                 enc,
-		settings:            settings,
-		usageStats:          usageStats,
-		kmsProvidersService: kmsProvidersService,
-		dataKeyCache:        newDataKeyCache(ttl),
-		currentProviderID:   currentProviderID,
-		features:            features,
-		log:                 log.New("secrets"),
+		store:                   store,
+		enc:                     enc,
+		settings:                settings,
+		usageStats:              usageStats,
+		kmsProvidersService:     kmsProvidersService,
+		dataKeyCache:            newDataKeyCache(ttl),
+		currentProviderID:       currentProviderID,
+		compressionMinSize:      compressionMinSize,
+		features:                features,
+		authenticatedEncryption: settings.KeyValue("security.encryption", "authenticated_encryption").MustBool(false),
+		fallbackProviders:       fallbackProviders,
+		log:                     log.New("secrets"),
 	}
 
 	enabled := !features.IsEnabled(featuremgmt.FlagDisableEnvelopeEncryption)
@@ -160,41 +218,88 @@ var b64 = base64.RawStdEncoding
 func (s *SecretsService) Encrypt(ctx context.Context, payload []byte, opt secrets.EncryptionOptions) ([]byte, error) {
 	// Use legacy encryption service if featuremgmt.FlagDisableEnvelopeEncryption toggle is on
 	if s.features.IsEnabled(featuremgmt.FlagDisableEnvelopeEncryption) {
-		return s.enc.Encrypt(ctx, payload, setting.SecretKey)
+		// The secret key is read from the settings, like Decrypt does.
+		return s.enc.Encrypt(ctx, payload, s.settings.KeyValue("security", "secret_key").Value())
 	}
 
+	// If encryption featuremgmt.FlagEnvelopeEncryption toggle is on, use envelope encryption
+	return s.encrypt(ctx, payload, opt, s.currentProviderID)
+}
+
+// EncryptWithProvider is like Encrypt, but the payload is encrypted with a data key of the
+// given provider instead of the current one, e.g. to have a KMS protect the most sensitive
+// secrets. Its data keys are not shared with the other providers since their labels include
+// the provider. The payload is decrypted by Decrypt like any other, through its data key id.
+func (s *SecretsService) EncryptWithProvider(ctx context.Context, payload []byte, providerID secrets.ProviderID, opt secrets.EncryptionOptions) ([]byte, error) {
+	if s.features.IsEnabled(featuremgmt.FlagDisableEnvelopeEncryption) {
+		return nil, fmt.Errorf("failed to encrypt with provider '%s': envelope encryption is disabled", providerID)
+	}
+
+	providerID = kmsproviders.NormalizeProviderID(providerID)
+	if _, exists := s.providers[providerID]; !exists {
+		return nil, fmt.Errorf("could not find encryption provider '%s'", providerID)
+	}
+
+	return s.encrypt(ctx, payload, opt, providerID)
+}
+
+// encrypt encrypts the payload with envelope encryption, using the current data key of the
+// given provider.
+func (s *SecretsService) encrypt(ctx context.Context, payload []byte, opt secrets.EncryptionOptions, providerID secrets.ProviderID) ([]byte, error) {
 	var err error
-	defer func() {
-		opsCounter.With(prometheus.Labels{
-			"success":   strconv.FormatBool(err == nil),
-			"operation": OpEncrypt,
-		}).Inc()
-	}()
+	defer func(start time.Time) {
+		observeOp(OpEncrypt, start, err)
+	}(time.Now())
 
-	// If encryption featuremgmt.FlagEnvelopeEncryption toggle is on, use envelope encryption
 	scope := opt()
-	label := secrets.KeyLabel(scope, s.currentProviderID)
+	label := secrets.KeyLabel(scope, providerID)
 
 	var id string
 	var dataKey []byte
-	id, dataKey, err = s.currentDataKey(ctx, label, scope)
+	id, dataKey, err = s.currentDataKey(ctx, label, scope, providerID)
 	if err != nil {
 		s.log.Error("Failed to get current data key", "error", err, "label", label)
 		return nil, err
 	}
 
-	var encrypted []byte
-	encrypted, err = s.enc.Encrypt(ctx, payload, string(dataKey))
+	compressed := false
+	if s.compressionMinSize > 0 && len(payload) >= s.compressionMinSize {
+		var compressedPayload []byte
+		compressedPayload, err = compress(payload)
+		if err != nil {
+			s.log.Error("Failed to compress secret", "error", err)
+			return nil, err
+		}
+		// Payloads that don't shrink are stored uncompressed.
+		if len(compressedPayload) < len(payload) {
+			payload = compressedPayload
+			compressed = true
+		}
+	}
+
+	var prefix, encrypted []byte
+	if s.authenticatedEncryption {
+		version := formatAESGCM
+		if compressed {
+			version = formatAESGCMCompressed
+		}
+		// The prefix is authenticated, so that the payload can't be
+		// decrypted under another key id or format version.
+		prefix = envelopePrefix(id, versionedDelimiter, version)
+		encrypted, err = sealAESGCM(payload, dataKey, prefix)
+	} else {
+		delimiter := byte(keyIdDelimiter)
+		if compressed {
+			delimiter = compressedDelimiter
+		}
+		prefix = envelopePrefix(id, delimiter)
+		encrypted, err = s.enc.Encrypt(ctx, payload, string(dataKey))
+	}
 	if err != nil {
 		s.log.Error("Failed to encrypt secret", "error", err)
 		return nil, err
 	}
 
-	prefix := make([]byte, b64.EncodedLen(len(id))+2)
-	b64.Encode(prefix[1:], []byte(id))
-	prefix[0] = keyIdDelimiter
-	prefix[len(prefix)-1] = keyIdDelimiter
-
 	blob := make([]byte, len(prefix)+len(encrypted))
 	copy(blob, prefix)
 	copy(blob[len(prefix):], encrypted)
@@ -202,10 +307,20 @@ func (s *SecretsService) Encrypt(ctx context.Context, payload []byte, opt secret
 	return blob, nil
 }
 
+// envelopePrefix returns the prefix of a payload encrypted with the data key id,
+// closed by the given delimiter and format version, if any.
+func envelopePrefix(id string, delimiter byte, version ...byte) []byte {
+	prefix := make([]byte, 0, b64.EncodedLen(len(id))+2+len(version))
+	prefix = append(prefix, keyIdDelimiter)
+	prefix = append(prefix, b64.EncodeToString([]byte(id))...)
+	prefix = append(prefix, delimiter)
+	return append(prefix, version...)
+}
+
 // currentDataKey looks up for current data key in cache or database by name, and decrypts it.
 // If there's no current data key in cache nor in database it generates a new random data key,
 // and stores it into both the in-memory cache and database (encrypted by the encryption provider).
-func (s *SecretsService) currentDataKey(ctx context.Context, label string, scope string) (string, []byte, error) {
+func (s *SecretsService) currentDataKey(ctx context.Context, label string, scope string, providerID secrets.ProviderID) (string, []byte, error) {
 	// We want only one request fetching current data key at time to
 	// avoid the creation of multiple ones in case there's no one existing.
 	s.mtx.Lock()
@@ -219,7 +334,7 @@ func (s *SecretsService) currentDataKey(ctx context.Context, label string, scope
 
 	// If no existing data key was found, create a new one
 	if dataKey == nil {
-		id, dataKey, err = s.newDataKey(ctx, label, scope)
+		id, dataKey, err = s.newDataKey(ctx, label, scope, providerID)
 		if err != nil {
 			return "", nil, err
 		}
@@ -245,14 +360,8 @@ func (s *SecretsService) dataKeyByLabel(ctx context.Context, label string) (stri
 		return "", nil, err
 	}
 
-	// 2.1 Find the encryption provider.
-	provider, exists := s.providers[kmsproviders.NormalizeProviderID(dataKey.Provider)]
-	if !exists {
-		return "", nil, fmt.Errorf("could not find encryption provider '%s'", dataKey.Provider)
-	}
-
-	// 2.2 Decrypt the data key fetched from the database.
-	decrypted, err := provider.Decrypt(ctx, dataKey.EncryptedData)
+	// 2. Decrypt the data key fetched from the database.
+	decrypted, err := s.decryptDataKey(ctx, dataKey)
 	if err != nil {
 		return "", nil, err
 	}
@@ -263,8 +372,8 @@ func (s *SecretsService) dataKeyByLabel(ctx context.Context, label string) (stri
 	return dataKey.Id, decrypted, nil
 }
 
-// newDataKey creates a new random data key, encrypts it and stores it into the database and cache.
-func (s *SecretsService) newDataKey(ctx context.Context, label string, scope string) (string, []byte, error) {
+// newDataKey creates a new random data key, encrypts it with the given provider and stores it into the database and cache.
+func (s *SecretsService) newDataKey(ctx context.Context, label string, scope string, providerID secrets.ProviderID) (string, []byte, error) {
 	// 1. Create new data key.
 	dataKey, err := newRandomDataKey()
 	if err != nil {
@@ -272,13 +381,15 @@ func (s *SecretsService) newDataKey(ctx context.Context, label string, scope str
 	}
 
 	// 2.1 Find the encryption provider.
-	provider, exists := s.providers[s.currentProviderID]
+	provider, exists := s.providers[providerID]
 	if !exists {
-		return "", nil, fmt.Errorf("could not find encryption provider '%s'", s.currentProviderID)
+		return "", nil, fmt.Errorf("could not find encryption provider '%s'", providerID)
 	}
 
 	// 2.2 Encrypt the data key.
+	start := time.Now()
 	encrypted, err := provider.Encrypt(ctx, dataKey)
+	observeProviderOp(string(providerID), OpEncrypt, start, err)
 	if err != nil {
 		return "", nil, err
 	}
@@ -289,7 +400,7 @@ func (s *SecretsService) newDataKey(ctx context.Context, label string, scope str
 	dbDataKey := secrets.DataKey{
 		Active:        true,
 		Id:            id,
-		Provider:      s.currentProviderID,
+		Provider:      providerID,
 		EncryptedData: encrypted,
 		Label:         label,
 		Scope:         scope,
@@ -314,16 +425,13 @@ func newRandomDataKey() ([]byte, error) {
 
 func (s *SecretsService) Decrypt(ctx context.Context, payload []byte) ([]byte, error) {
 	var err error
-	defer func() {
-		opsCounter.With(prometheus.Labels{
-			"success":   strconv.FormatBool(err == nil),
-			"operation": OpDecrypt,
-		}).Inc()
+	defer func(start time.Time) {
+		observeOp(OpDecrypt, start, err)
 
 		if err != nil {
 			s.log.Error("Failed to decrypt secret", "error", err)
 		}
-	}()
+	}(time.Now())
 
 	if len(payload) == 0 {
 		err = fmt.Errorf("unable to decrypt empty payload")
@@ -339,37 +447,101 @@ func (s *SecretsService) Decrypt(ctx context.Context, payload []byte) ([]byte, e
 		return nil, err
 	}
 
-	var dataKey []byte
+	var (
+		dataKey []byte
+		keyId   string
+		// version is the format version of the payload, and header its prefix
+		// when closed by versionedDelimiter, which may be authenticated along
+		// with it. Unversioned payloads are formatEncryptionService ones.
+		version = formatEncryptionService
+		header  []byte
+	)
 
 	if !s.encryptedWithEnvelopeEncryption(payload) {
 		secretKey := s.settings.KeyValue("security", "secret_key").Value()
 		dataKey = []byte(secretKey)
 	} else {
+		blob := payload
 		payload = payload[1:]
-		endOfKey := bytes.Index(payload, []byte{keyIdDelimiter})
+		endOfKey := bytes.IndexAny(payload, string([]byte{keyIdDelimiter, compressedDelimiter, versionedDelimiter}))
 		if endOfKey == -1 {
-			err = fmt.Errorf("could not find valid key id in encrypted payload")
+			err = &secrets.DecryptionError{Err: errors.New("could not find valid key id in encrypted payload")}
 			return nil, err
 		}
 		b64Key := payload[:endOfKey]
+		switch payload[endOfKey] {
+		case compressedDelimiter:
+			version = formatEncryptionServiceCompressed
+		case versionedDelimiter:
+			if endOfKey+1 >= len(payload) {
+				err = &secrets.DecryptionError{Err: errors.New("could not find format version in encrypted payload")}
+				return nil, err
+			}
+			version = payload[endOfKey+1]
+			header = blob[:endOfKey+3]
+			endOfKey++
+		}
 		payload = payload[endOfKey+1:]
-		keyId := make([]byte, b64.DecodedLen(len(b64Key)))
-		_, err = b64.Decode(keyId, b64Key)
+		rawKeyId := make([]byte, b64.DecodedLen(len(b64Key)))
+		_, err = b64.Decode(rawKeyId, b64Key)
 		if err != nil {
+			err = &secrets.DecryptionError{Err: fmt.Errorf("invalid key id: %w", err)}
 			return nil, err
 		}
+		keyId = string(rawKeyId)
 
-		dataKey, err = s.dataKeyById(ctx, string(keyId))
+		dataKey, err = s.dataKeyById(ctx, keyId)
 		if err != nil {
-			s.log.Error("Failed to lookup data key by id", "id", string(keyId), "error", err)
+			s.log.Error("Failed to lookup data key by id", "id", keyId, "error", err)
+			err = &secrets.DecryptionError{KeyId: keyId, Err: err}
 			return nil, err
 		}
 	}
 
 	var decrypted []byte
-	decrypted, err = s.enc.Decrypt(ctx, payload, string(dataKey))
+	switch version {
+	case formatEncryptionService, formatEncryptionServiceCompressed:
+		decrypted, err = s.enc.Decrypt(ctx, payload, string(dataKey))
+	case formatAESGCM, formatAESGCMCompressed:
+		decrypted, err = openAESGCM(payload, dataKey, header)
+	default:
+		err = fmt.Errorf("unsupported payload format version %d, it may have been encrypted by a newer version of Grafana", version)
+	}
+	if err == nil && (version == formatEncryptionServiceCompressed || version == formatAESGCMCompressed) {
+		decrypted, err = decompress(decrypted)
+	}
+	if err != nil {
+		err = &secrets.DecryptionError{KeyId: keyId, Err: err}
+		return nil, err
+	}
+
+	return decrypted, nil
+}
+
+func compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(payload []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	defer func() { _ = r.Close() }()
 
-	return decrypted, err
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return decompressed, nil
 }
 
 func (s *SecretsService) EncryptJsonData(ctx context.Context, kv map[string]string, opt secrets.EncryptionOptions) (map[string][]byte, error) {
@@ -398,6 +570,35 @@ func (s *SecretsService) DecryptJsonData(ctx context.Context, sjd map[string][]b
 	return decrypted, nil
 }
 
+// EncryptJSON encrypts the JSON encoding of v. A nil v is encrypted to an empty payload,
+// so that nothing needs to be stored for it.
+func (s *SecretsService) EncryptJSON(ctx context.Context, v interface{}, opt secrets.EncryptionOptions) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secret: %w", err)
+	}
+	return s.Encrypt(ctx, payload, opt)
+}
+
+// DecryptJSON decrypts a payload encrypted by EncryptJSON into v, which must be a pointer.
+// An empty payload leaves v untouched.
+func (s *SecretsService) DecryptJSON(ctx context.Context, blob []byte, v interface{}) error {
+	if len(blob) == 0 {
+		return nil
+	}
+	payload, err := s.Decrypt(ctx, blob)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("failed to unmarshal secret into %T: %w", v, err)
+	}
+	return nil
+}
+
 func (s *SecretsService) GetDecryptedValue(ctx context.Context, sjd map[string][]byte, key, fallback string) string {
 	if value, ok := sjd[key]; ok {
 		decryptedData, err := s.Decrypt(ctx, value)
@@ -425,14 +626,8 @@ func (s *SecretsService) dataKeyById(ctx context.Context, id string) ([]byte, er
 		return nil, err
 	}
 
-	// 2.1. Find the encryption provider.
-	provider, exists := s.providers[kmsproviders.NormalizeProviderID(dataKey.Provider)]
-	if !exists {
-		return nil, fmt.Errorf("could not find encryption provider '%s'", dataKey.Provider)
-	}
-
-	// 2.2. Encrypt the data key.
-	decrypted, err := provider.Decrypt(ctx, dataKey.EncryptedData)
+	// 2. Decrypt the data key.
+	decrypted, err := s.decryptDataKey(ctx, dataKey)
 	if err != nil {
 		return nil, err
 	}
@@ -443,6 +638,84 @@ func (s *SecretsService) dataKeyById(ctx context.Context, id string) ([]byte, er
 	return decrypted, nil
 }
 
+// decryptDataKey decrypts the data key with the provider that encrypted it. If that fails,
+// e.g. because the provider is unavailable during a migration, the fallback providers are
+// tried in turn, and the errors of all of them are returned if none succeeds.
+func (s *SecretsService) decryptDataKey(ctx context.Context, dataKey *secrets.DataKey) ([]byte, error) {
+	providerID := kmsproviders.NormalizeProviderID(dataKey.Provider)
+	decrypted, err := s.decryptDataKeyWith(ctx, providerID, dataKey)
+	if err == nil || len(s.fallbackProviders) == 0 {
+		return decrypted, err
+	}
+
+	errs := multierror.Append(nil, err)
+	for _, fallbackID := range s.fallbackProviders {
+		if fallbackID == providerID {
+			continue
+		}
+		s.log.Warn("Failed to decrypt data key, trying a fallback provider",
+			"id", dataKey.Id, "provider", providerID, "fallback", fallbackID, "error", err)
+		decrypted, err = s.decryptDataKeyWith(ctx, fallbackID, dataKey)
+		if err == nil {
+			return decrypted, nil
+		}
+		errs = multierror.Append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to decrypt data key '%s' with its provider and the fallback providers: %w", dataKey.Id, errs)
+}
+
+// decryptDataKeyWith decrypts the data key with the given provider.
+func (s *SecretsService) decryptDataKeyWith(ctx context.Context, providerID secrets.ProviderID, dataKey *secrets.DataKey) ([]byte, error) {
+	provider, exists := s.providers[providerID]
+	if !exists {
+		return nil, fmt.Errorf("could not find encryption provider '%s'", providerID)
+	}
+
+	start := time.Now()
+	decrypted, err := provider.Decrypt(ctx, dataKey.EncryptedData)
+	observeProviderOp(string(providerID), OpDecrypt, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("provider '%s': %w", providerID, err)
+	}
+	return decrypted, nil
+}
+
+// healthCheckPayload is the plaintext encrypted and decrypted back by HealthCheck.
+var healthCheckPayload = []byte("grafana secrets health check")
+
+// HealthCheck checks that secrets can be encrypted and decrypted back, e.g. to tell whether an
+// instance is ready after its providers and keys are configured. The payload goes through the
+// full Encrypt and Decrypt path, so with envelope encryption the current data key of the root
+// scope is created if needed, and it must then be resolvable through its provider.
+func (s *SecretsService) HealthCheck(ctx context.Context) error {
+	encrypted, err := s.Encrypt(ctx, healthCheckPayload, secrets.WithoutScope())
+	if err != nil {
+		return fmt.Errorf("secrets health check failed to encrypt: %w", err)
+	}
+
+	decrypted, err := s.Decrypt(ctx, encrypted)
+	if err != nil {
+		return fmt.Errorf("secrets health check failed to decrypt: %w", err)
+	}
+	if !bytes.Equal(decrypted, healthCheckPayload) {
+		return errors.New("secrets health check failed: the decrypted payload doesn't match the encrypted one")
+	}
+
+	if s.features.IsEnabled(featuremgmt.FlagDisableEnvelopeEncryption) {
+		return nil
+	}
+
+	label := secrets.KeyLabel(secrets.WithoutScope()(), s.currentProviderID)
+	_, dataKey, err := s.dataKeyByLabel(ctx, label)
+	if err != nil {
+		return fmt.Errorf("secrets health check failed to resolve the root data key: %w", err)
+	}
+	if dataKey == nil {
+		return fmt.Errorf("secrets health check failed: no root data key found with label '%s'", label)
+	}
+	return nil
+}
+
 func (s *SecretsService) GetProviders() map[secrets.ProviderID]secrets.Provider {
 	return s.providers
 }
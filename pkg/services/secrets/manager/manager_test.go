@@ -1,11 +1,15 @@
 package manager
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"errors"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/ini.v1"
@@ -265,6 +269,179 @@ func (f *fakeKMS) Provide() (map[secrets.ProviderID]secrets.Provider, error) {
 	return providers, nil
 }
 
+func TestSecretsService_EncryptWithProvider(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	store := database.ProvideSecretsStore(testDB)
+	svc := SetupTestService(t, store)
+
+	kms := &copyProvider{}
+	svc.providers["fakeKMS.v1"] = kms
+
+	builtin, err := svc.Encrypt(ctx, []byte("grafana"), secrets.WithoutScope())
+	require.NoError(t, err)
+	protected, err := svc.EncryptWithProvider(ctx, []byte("grafana-kms"), "fakeKMS.v1", secrets.WithoutScope())
+	require.NoError(t, err)
+	assert.Equal(t, 1, kms.encryptions)
+
+	// The data keys of the providers are distinct, and labeled after their provider.
+	dataKeys, err := store.GetAllDataKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, dataKeys, 2)
+	providers := map[secrets.ProviderID]string{}
+	for _, k := range dataKeys {
+		providers[k.Provider] = k.Label
+	}
+	assert.Equal(t, secrets.KeyLabel("root", svc.currentProviderID), providers[svc.currentProviderID])
+	assert.Equal(t, secrets.KeyLabel("root", "fakeKMS.v1"), providers["fakeKMS.v1"])
+
+	// Both payloads are decrypted through Decrypt, by a service without cached data keys.
+	svc.dataKeyCache.flush()
+	decrypted, err := svc.Decrypt(ctx, builtin)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("grafana"), decrypted)
+	decrypted, err = svc.Decrypt(ctx, protected)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("grafana-kms"), decrypted)
+	assert.Equal(t, 1, kms.decryptions)
+
+	t.Run("should fail on an unknown provider", func(t *testing.T) {
+		_, err := svc.EncryptWithProvider(ctx, []byte("grafana"), "unknown.v1", secrets.WithoutScope())
+		require.Error(t, err)
+	})
+}
+
+func TestSecretsService_FallbackProviders(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	svc := SetupTestService(t, database.ProvideSecretsStore(testDB))
+
+	// The primary provider can encrypt data keys, but no longer decrypt them.
+	primary := &copyProvider{decryptErr: errors.New("primary is unavailable")}
+	svc.providers["primary.v1"] = primary
+	encrypted, err := svc.EncryptWithProvider(ctx, []byte("grafana"), "primary.v1", secrets.WithoutScope())
+	require.NoError(t, err)
+
+	t.Run("a fallback provider decrypts the data key", func(t *testing.T) {
+		svc.dataKeyCache.flush()
+		backup := &copyProvider{}
+		svc.providers["backup.v1"] = backup
+		svc.fallbackProviders = []secrets.ProviderID{"missing.v1", "backup.v1"}
+
+		decrypted, err := svc.Decrypt(ctx, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+		assert.Equal(t, 1, backup.decryptions)
+	})
+
+	t.Run("the errors of all the providers are returned when they all fail", func(t *testing.T) {
+		svc.dataKeyCache.flush()
+		svc.providers["broken.v1"] = &copyProvider{decryptErr: errors.New("broken is unavailable")}
+		svc.fallbackProviders = []secrets.ProviderID{"missing.v1", "broken.v1"}
+
+		_, err := svc.Decrypt(ctx, encrypted)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "primary is unavailable")
+		assert.Contains(t, err.Error(), "could not find encryption provider 'missing.v1'")
+		assert.Contains(t, err.Error(), "broken is unavailable")
+	})
+}
+
+func TestSecretsService_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("healthy", func(t *testing.T) {
+		testDB := db.InitTestDB(t)
+		svc := SetupTestService(t, database.ProvideSecretsStore(testDB))
+		require.NoError(t, svc.HealthCheck(ctx))
+	})
+
+	t.Run("healthy with envelope encryption disabled", func(t *testing.T) {
+		testDB := db.InitTestDB(t)
+		svc := SetupDisabledTestService(t, database.ProvideSecretsStore(testDB))
+		require.NoError(t, svc.HealthCheck(ctx))
+	})
+
+	t.Run("broken provider", func(t *testing.T) {
+		testDB := db.InitTestDB(t)
+		svc := SetupTestService(t, database.ProvideSecretsStore(testDB))
+		svc.providers["broken.v1"] = &copyProvider{decryptErr: errors.New("broken is unavailable")}
+		svc.currentProviderID = "broken.v1"
+
+		err := svc.HealthCheck(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "broken is unavailable")
+	})
+}
+
+func TestSecretsService_EncryptJSON(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	svc := SetupTestService(t, database.ProvideSecretsStore(testDB))
+
+	type credentials struct {
+		User     string            `json:"user"`
+		Password string            `json:"password"`
+		Headers  map[string]string `json:"headers"`
+	}
+	type settings struct {
+		URL         string       `json:"url"`
+		Credentials *credentials `json:"credentials"`
+		Scopes      []string     `json:"scopes"`
+	}
+	original := settings{
+		URL:         "https://example.com",
+		Credentials: &credentials{User: "admin", Password: "secret", Headers: map[string]string{"X-Org": "1"}},
+		Scopes:      []string{"read", "write"},
+	}
+
+	encrypted, err := svc.EncryptJSON(ctx, original, secrets.WithoutScope())
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(encrypted, []byte("secret")))
+
+	var decrypted settings
+	require.NoError(t, svc.DecryptJSON(ctx, encrypted, &decrypted))
+	assert.Equal(t, original, decrypted)
+
+	t.Run("nil values are encrypted to empty payloads, which leave values untouched", func(t *testing.T) {
+		encrypted, err := svc.EncryptJSON(ctx, nil, secrets.WithoutScope())
+		require.NoError(t, err)
+		assert.Empty(t, encrypted)
+
+		decrypted := settings{URL: "unchanged"}
+		require.NoError(t, svc.DecryptJSON(ctx, encrypted, &decrypted))
+		assert.Equal(t, settings{URL: "unchanged"}, decrypted)
+	})
+
+	t.Run("should fail to decrypt into a mismatched type", func(t *testing.T) {
+		var scopes []string
+		err := svc.DecryptJSON(ctx, encrypted, &scopes)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to unmarshal secret into *[]string")
+	})
+}
+
+// copyProvider is a provider whose encrypted blobs are copies of the original ones.
+type copyProvider struct {
+	encryptions int
+	decryptions int
+	// decryptErr, if set, is returned by Decrypt.
+	decryptErr error
+}
+
+func (p *copyProvider) Encrypt(_ context.Context, blob []byte) ([]byte, error) {
+	p.encryptions++
+	return append([]byte{}, blob...), nil
+}
+
+func (p *copyProvider) Decrypt(_ context.Context, blob []byte) ([]byte, error) {
+	if p.decryptErr != nil {
+		return nil, p.decryptErr
+	}
+	p.decryptions++
+	return append([]byte{}, blob...), nil
+}
+
 func TestSecretsService_Run(t *testing.T) {
 	ctx := context.Background()
 	testDB := db.InitTestDB(t)
@@ -425,6 +602,352 @@ func TestSecretsService_Decrypt(t *testing.T) {
 	})
 }
 
+func TestSecretsService_DecryptTampered(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	store := database.ProvideSecretsStore(testDB)
+	svc := SetupTestService(t, store)
+
+	ciphertext, err := svc.Encrypt(ctx, []byte("grafana"), secrets.WithoutScope())
+	require.NoError(t, err)
+
+	endOfKey := bytes.IndexByte(ciphertext[1:], keyIdDelimiter) + 1
+	require.Greater(t, endOfKey, 1)
+	keyId, err := b64.DecodeString(string(ciphertext[1:endOfKey]))
+	require.NoError(t, err)
+
+	tamper := func(f func(payload []byte) []byte) []byte {
+		payload := make([]byte, len(ciphertext))
+		copy(payload, ciphertext)
+		return f(payload)
+	}
+
+	testCases := []struct {
+		desc          string
+		payload       []byte
+		expectedKeyId string
+	}{
+		{
+			desc: "missing key id delimiter",
+			payload: tamper(func(payload []byte) []byte {
+				return payload[:endOfKey]
+			}),
+		},
+		{
+			desc: "key id that is not base64",
+			payload: tamper(func(payload []byte) []byte {
+				payload[1] = '!'
+				return payload
+			}),
+		},
+		{
+			desc: "key id of an unknown data key",
+			payload: tamper(func(payload []byte) []byte {
+				unknown := b64.EncodeToString([]byte("unknown"))
+				return append([]byte("#"+unknown+"#"), payload[endOfKey+1:]...)
+			}),
+			expectedKeyId: "unknown",
+		},
+		{
+			desc: "truncated body",
+			payload: tamper(func(payload []byte) []byte {
+				return payload[:endOfKey+4]
+			}),
+			expectedKeyId: string(keyId),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := svc.Decrypt(ctx, tc.payload)
+			require.Error(t, err)
+			require.ErrorIs(t, err, secrets.ErrDecryptionFailed)
+
+			var decryptionErr *secrets.DecryptionError
+			require.ErrorAs(t, err, &decryptionErr)
+			require.Equal(t, tc.expectedKeyId, decryptionErr.KeyId)
+			require.NotNil(t, decryptionErr.Unwrap())
+		})
+	}
+}
+
+func TestSecretsService_Compression(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	store := database.ProvideSecretsStore(testDB)
+	svc := SetupTestService(t, store)
+	svc.compressionMinSize = 1024
+
+	// delimiter returns the byte closing the key id of an envelope encrypted payload.
+	delimiter := func(t *testing.T, ciphertext []byte) byte {
+		t.Helper()
+		require.Equal(t, byte(keyIdDelimiter), ciphertext[0])
+		end := bytes.IndexAny(ciphertext[1:], string([]byte{keyIdDelimiter, compressedDelimiter}))
+		require.NotEqual(t, -1, end)
+		return ciphertext[end+1]
+	}
+
+	t.Run("large compressible payload should be compressed", func(t *testing.T) {
+		plaintext := bytes.Repeat([]byte(`{"url":"http://localhost:9090","access":"proxy"}`), 1000)
+
+		ciphertext, err := svc.Encrypt(ctx, plaintext, secrets.WithoutScope())
+		require.NoError(t, err)
+		assert.Equal(t, byte(compressedDelimiter), delimiter(t, ciphertext))
+		assert.Less(t, len(ciphertext), len(plaintext))
+
+		decrypted, err := svc.Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("small payload should not be compressed", func(t *testing.T) {
+		plaintext := make([]byte, 64)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		ciphertext, err := svc.Encrypt(ctx, plaintext, secrets.WithoutScope())
+		require.NoError(t, err)
+		assert.Equal(t, byte(keyIdDelimiter), delimiter(t, ciphertext))
+
+		decrypted, err := svc.Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("large incompressible payload should not be compressed", func(t *testing.T) {
+		plaintext := make([]byte, 4096)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		ciphertext, err := svc.Encrypt(ctx, plaintext, secrets.WithoutScope())
+		require.NoError(t, err)
+		assert.Equal(t, byte(keyIdDelimiter), delimiter(t, ciphertext))
+
+		decrypted, err := svc.Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("compressed payload should be decrypted with compression disabled", func(t *testing.T) {
+		plaintext := bytes.Repeat([]byte("grafana"), 1000)
+
+		ciphertext, err := svc.Encrypt(ctx, plaintext, secrets.WithoutScope())
+		require.NoError(t, err)
+
+		decrypted, err := SetupTestService(t, store).Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+}
+
+func TestSecretsService_AuthenticatedEncryption(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	store := database.ProvideSecretsStore(testDB)
+	svc := SetupTestService(t, store)
+	svc.authenticatedEncryption = true
+
+	// split returns the key id, the format version and the body of a payload closed by versionedDelimiter.
+	split := func(t *testing.T, ciphertext []byte) (string, byte, []byte) {
+		t.Helper()
+		require.Equal(t, byte(keyIdDelimiter), ciphertext[0])
+		end := bytes.IndexByte(ciphertext[1:], versionedDelimiter) + 1
+		require.Greater(t, end, 1)
+		keyId, err := b64.DecodeString(string(ciphertext[1:end]))
+		require.NoError(t, err)
+		return string(keyId), ciphertext[end+1], ciphertext[end+2:]
+	}
+
+	ciphertext, err := svc.Encrypt(ctx, []byte("grafana"), secrets.WithoutScope())
+	require.NoError(t, err)
+	keyId, version, body := split(t, ciphertext)
+	require.Equal(t, formatAESGCM, version)
+
+	t.Run("payload should be decrypted", func(t *testing.T) {
+		decrypted, err := svc.Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+	})
+
+	t.Run("payload should be decrypted with authenticated encryption disabled", func(t *testing.T) {
+		decrypted, err := SetupTestService(t, store).Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+	})
+
+	t.Run("compressed payload should be decrypted", func(t *testing.T) {
+		svc.compressionMinSize = 1024
+		t.Cleanup(func() { svc.compressionMinSize = 0 })
+		plaintext := bytes.Repeat([]byte("grafana"), 1000)
+
+		compressed, err := svc.Encrypt(ctx, plaintext, secrets.WithoutScope())
+		require.NoError(t, err)
+		_, version, _ := split(t, compressed)
+		require.Equal(t, formatAESGCMCompressed, version)
+
+		decrypted, err := svc.Decrypt(ctx, compressed)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("legacy payload should be decrypted", func(t *testing.T) {
+		legacy, err := SetupTestService(t, store).Encrypt(ctx, []byte("grafana"), secrets.WithoutScope())
+		require.NoError(t, err)
+
+		decrypted, err := svc.Decrypt(ctx, legacy)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+	})
+
+	t.Run("payload under another key id should fail authentication", func(t *testing.T) {
+		other, err := svc.Encrypt(ctx, []byte("grafana"), secrets.WithScope("user:10"))
+		require.NoError(t, err)
+		otherKeyId, _, _ := split(t, other)
+		require.NotEqual(t, keyId, otherKeyId)
+
+		tampered := append(envelopePrefix(otherKeyId, versionedDelimiter, formatAESGCM), body...)
+		_, err = svc.Decrypt(ctx, tampered)
+		require.ErrorIs(t, err, secrets.ErrDecryptionFailed)
+		var decryptionErr *secrets.DecryptionError
+		require.ErrorAs(t, err, &decryptionErr)
+		require.Equal(t, otherKeyId, decryptionErr.KeyId)
+	})
+
+	t.Run("payload should fail authentication with the right key and another key id", func(t *testing.T) {
+		dataKey, err := svc.dataKeyById(ctx, keyId)
+		require.NoError(t, err)
+
+		_, err = openAESGCM(body, dataKey, envelopePrefix(keyId, versionedDelimiter, formatAESGCM))
+		require.NoError(t, err)
+		_, err = openAESGCM(body, dataKey, envelopePrefix("another", versionedDelimiter, formatAESGCM))
+		require.Error(t, err)
+	})
+
+	t.Run("payload under another format version should fail authentication", func(t *testing.T) {
+		tampered := append(envelopePrefix(keyId, versionedDelimiter, formatAESGCMCompressed), body...)
+		_, err := svc.Decrypt(ctx, tampered)
+		require.ErrorIs(t, err, secrets.ErrDecryptionFailed)
+	})
+
+	t.Run("payload with an unknown format version should fail", func(t *testing.T) {
+		tampered := append(envelopePrefix(keyId, versionedDelimiter, 42), body...)
+		_, err := svc.Decrypt(ctx, tampered)
+		require.ErrorIs(t, err, secrets.ErrDecryptionFailed)
+		require.Contains(t, err.Error(), "unsupported payload format version 42")
+	})
+}
+
+func TestSecretsService_FormatVersions(t *testing.T) {
+	ctx := context.Background()
+	testDB := db.InitTestDB(t)
+	store := database.ProvideSecretsStore(testDB)
+	svc := SetupTestService(t, store)
+
+	// Payloads encrypted by the encryption service are written unversioned.
+	ciphertext, err := svc.Encrypt(ctx, []byte("grafana"), secrets.WithoutScope())
+	require.NoError(t, err)
+	require.Equal(t, byte(keyIdDelimiter), ciphertext[0])
+	endOfKey := bytes.IndexByte(ciphertext[1:], keyIdDelimiter) + 1
+	require.Greater(t, endOfKey, 1)
+	rawKeyId, err := b64.DecodeString(string(ciphertext[1:endOfKey]))
+	require.NoError(t, err)
+	keyId, body := string(rawKeyId), ciphertext[endOfKey+1:]
+
+	t.Run("unversioned payload should be decrypted", func(t *testing.T) {
+		decrypted, err := svc.Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+	})
+
+	t.Run("legacy payload should be decrypted", func(t *testing.T) {
+		// Legacy payloads are encrypted by the encryption service with the secret key.
+		secretKey := svc.settings.KeyValue("security", "secret_key").Value()
+		legacy, err := svc.enc.Encrypt(ctx, []byte("grafana"), secretKey)
+		require.NoError(t, err)
+		require.NotEqual(t, byte(keyIdDelimiter), legacy[0])
+
+		decrypted, err := svc.Decrypt(ctx, legacy)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+	})
+
+	t.Run("versioned payload should be decrypted", func(t *testing.T) {
+		versioned := append(envelopePrefix(keyId, versionedDelimiter, formatEncryptionService), body...)
+		decrypted, err := svc.Decrypt(ctx, versioned)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("grafana"), decrypted)
+	})
+
+	t.Run("versioned compressed payload should be decrypted", func(t *testing.T) {
+		svc.compressionMinSize = 1024
+		t.Cleanup(func() { svc.compressionMinSize = 0 })
+		plaintext := bytes.Repeat([]byte("grafana"), 1000)
+
+		compressed, err := svc.Encrypt(ctx, plaintext, secrets.WithoutScope())
+		require.NoError(t, err)
+		end := bytes.IndexByte(compressed[1:], compressedDelimiter) + 1
+		require.Greater(t, end, 1)
+
+		versioned := append(envelopePrefix(keyId, versionedDelimiter, formatEncryptionServiceCompressed), compressed[end+1:]...)
+		decrypted, err := svc.Decrypt(ctx, versioned)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("payload of an unknown future version should be rejected", func(t *testing.T) {
+		future := append(envelopePrefix(keyId, versionedDelimiter, 255), body...)
+		_, err := svc.Decrypt(ctx, future)
+		require.ErrorIs(t, err, secrets.ErrDecryptionFailed)
+		require.Contains(t, err.Error(), "unsupported payload format version 255")
+		var decryptionErr *secrets.DecryptionError
+		require.ErrorAs(t, err, &decryptionErr)
+		require.Equal(t, keyId, decryptionErr.KeyId)
+	})
+}
+
+func TestSecretsService_Metrics(t *testing.T) {
+	testDB := db.InitTestDB(t)
+	store := database.ProvideSecretsStore(testDB)
+	svc := SetupTestService(t, store)
+	ctx := context.Background()
+	provider := string(svc.currentProviderID)
+
+	counter := func(c interface {
+		WithLabelValues(...string) prometheus.Counter
+	}, labels ...string) float64 {
+		return testutil.ToFloat64(c.WithLabelValues(labels...))
+	}
+	byLabelMisses := counter(cacheReadsCounter, "false", "byLabel")
+	byIdMisses := counter(cacheReadsCounter, "false", "byId")
+	byIdHits := counter(cacheReadsCounter, "true", "byId")
+	providerEncrypts := counter(providerOpsCounter, provider, "true", OpEncrypt)
+	providerDecrypts := counter(providerOpsCounter, provider, "true", OpDecrypt)
+	decrypts := counter(opsCounter, "true", OpDecrypt)
+
+	// The first encryption creates the data key, so it misses the cache.
+	encrypted, err := svc.Encrypt(ctx, []byte("grafana"), secrets.WithoutScope())
+	require.NoError(t, err)
+	assert.Equal(t, byLabelMisses+1, counter(cacheReadsCounter, "false", "byLabel"))
+	assert.Equal(t, providerEncrypts+1, counter(providerOpsCounter, provider, "true", OpEncrypt))
+
+	// The first decryption misses the cache and has the provider decrypt the data key.
+	_, err = svc.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, byIdMisses+1, counter(cacheReadsCounter, "false", "byId"))
+	assert.Equal(t, byIdHits, counter(cacheReadsCounter, "true", "byId"))
+	assert.Equal(t, providerDecrypts+1, counter(providerOpsCounter, provider, "true", OpDecrypt))
+
+	// The second one finds the data key in the cache.
+	_, err = svc.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, byIdMisses+1, counter(cacheReadsCounter, "false", "byId"))
+	assert.Equal(t, byIdHits+1, counter(cacheReadsCounter, "true", "byId"))
+	assert.Equal(t, providerDecrypts+1, counter(providerOpsCounter, provider, "true", OpDecrypt))
+	assert.Equal(t, decrypts+2, counter(opsCounter, "true", OpDecrypt))
+
+	assert.Equal(t, float64(cacheHits.Load())/float64(cacheReads.Load()), testutil.ToFloat64(cacheHitRatio))
+}
+
 func TestIntegration_SecretsService(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
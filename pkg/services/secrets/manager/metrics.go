@@ -1,6 +1,10 @@
 package manager
 
 import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/grafana/grafana/pkg/infra/metrics"
@@ -34,14 +38,93 @@ var (
 		[]string{"hit", "method"},
 		map[string][]string{
 			"hit":    {"true", "false"},
-			"method": {"byId", "byName"},
+			"method": {"byId", "byLabel"},
+		},
+	)
+	opsDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.ExporterName,
+			Name:      "encryption_ops_duration_seconds",
+			Help:      "Histogram of the duration of encryption operations",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		},
+		[]string{"operation"},
+	)
+	providerOpsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.ExporterName,
+			Name:      "encryption_provider_ops_total",
+			Help:      "A counter for the operations of the encryption providers on data keys",
+		},
+		[]string{"provider", "success", "operation"},
+	)
+	providerOpsDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.ExporterName,
+			Name:      "encryption_provider_ops_duration_seconds",
+			Help:      "Histogram of the duration of the operations of the encryption providers on data keys",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
 		},
+		[]string{"provider", "operation"},
 	)
+	cacheHitRatio = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: metrics.ExporterName,
+			Name:      "encryption_cache_hit_ratio",
+			Help:      "The ratio of encryption cache reads that found an unexpired data key",
+		},
+		func() float64 {
+			reads := cacheReads.Load()
+			if reads == 0 {
+				return 0
+			}
+			return float64(cacheHits.Load()) / float64(reads)
+		},
+	)
+
+	// cacheReads and cacheHits count the reads of the data key cache to compute cacheHitRatio.
+	cacheReads, cacheHits atomic.Uint64
 )
 
 func init() {
 	prometheus.MustRegister(
 		opsCounter,
 		cacheReadsCounter,
+		opsDuration,
+		providerOpsCounter,
+		providerOpsDuration,
+		cacheHitRatio,
 	)
 }
+
+// observeOp records an encryption operation that started at start.
+func observeOp(operation string, start time.Time, err error) {
+	opsCounter.With(prometheus.Labels{
+		"success":   strconv.FormatBool(err == nil),
+		"operation": operation,
+	}).Inc()
+	opsDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// observeProviderOp records an operation of the encryption provider on a data key
+// that started at start.
+func observeProviderOp(provider, operation string, start time.Time, err error) {
+	providerOpsCounter.With(prometheus.Labels{
+		"provider":  provider,
+		"success":   strconv.FormatBool(err == nil),
+		"operation": operation,
+	}).Inc()
+	providerOpsDuration.WithLabelValues(provider, operation).Observe(time.Since(start).Seconds())
+}
+
+// observeCacheRead records a read of the data key cache by the given method.
+func observeCacheRead(method string, hit bool) {
+	cacheReadsCounter.With(prometheus.Labels{
+		"hit":    strconv.FormatBool(hit),
+		"method": method,
+	}).Inc()
+	cacheReads.Add(1)
+	if hit {
+		cacheHits.Add(1)
+	}
+}
@@ -15,6 +15,9 @@ type Service interface {
 	// the database transaction, look at database-specific methods present at the specific
 	// implementation present at manager.SecretsService.
 	Encrypt(ctx context.Context, payload []byte, opt EncryptionOptions) ([]byte, error)
+	// EncryptWithProvider is like Encrypt, but uses a data key of the given provider
+	// instead of the current one. It MUST NOT be used within database transactions either.
+	EncryptWithProvider(ctx context.Context, payload []byte, providerID ProviderID, opt EncryptionOptions) ([]byte, error)
 	Decrypt(ctx context.Context, payload []byte) ([]byte, error)
 
 	// EncryptJsonData MUST NOT be used within database transactions.
@@ -24,6 +27,11 @@ type Service interface {
 
 	GetDecryptedValue(ctx context.Context, sjd map[string][]byte, key, fallback string) string
 
+	// EncryptJSON MUST NOT be used within database transactions.
+	// Look at Encrypt method comment for further details.
+	EncryptJSON(ctx context.Context, v interface{}, opt EncryptionOptions) ([]byte, error)
+	DecryptJSON(ctx context.Context, blob []byte, v interface{}) error
+
 	RotateDataKeys(ctx context.Context) error
 	ReEncryptDataKeys(ctx context.Context) error
 }
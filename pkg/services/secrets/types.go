@@ -2,11 +2,40 @@ package secrets
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
 var ErrDataKeyNotFound = errors.New("data key not found")
 
+// ErrDecryptionFailed is returned (wrapped in a DecryptionError) when a payload
+// can't be decrypted, whether it's been tampered with or the key is wrong.
+var ErrDecryptionFailed = errors.New("failed to decrypt secret")
+
+// DecryptionError describes why a payload couldn't be decrypted. It matches
+// ErrDecryptionFailed with errors.Is, and unwraps to the underlying cause.
+type DecryptionError struct {
+	// KeyId is the id of the data key the payload was encrypted with,
+	// if it could be recovered from the payload.
+	KeyId string
+	Err   error
+}
+
+func (e *DecryptionError) Error() string {
+	if e.KeyId != "" {
+		return fmt.Sprintf("%s (key id %q): %s", ErrDecryptionFailed, e.KeyId, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", ErrDecryptionFailed, e.Err)
+}
+
+func (e *DecryptionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecryptionError) Is(target error) bool {
+	return target == ErrDecryptionFailed
+}
+
 type DataKey struct {
 	Active        bool
 	Id            string `xorm:"name"` // renaming the col in the db itself would break backward compatibility with 8.5.x
@@ -402,6 +402,30 @@ type Cfg struct {
 
 	// Data sources
 	DataSourceLimit int
+	// DataSourceQueryRateLimit is the default number of queries per second sent to a
+	// data source by the legacy query path. Zero means no limit.
+	DataSourceQueryRateLimit      float64
+	DataSourceQueryRateLimitBurst int
+	// DataSourceQueryRateLimitWait is true if queries over the rate limit wait for
+	// their turn, and false if they fail right away.
+	DataSourceQueryRateLimitWait bool
+	// DataSourceQueryRetryAttempts is the number of times a query of the legacy query path
+	// is sent to its data source when it fails with a transient error.
+	DataSourceQueryRetryAttempts int
+	// DataSourceQueryRetryBaseDelay is the delay before the first retry. It doubles on each retry.
+	DataSourceQueryRetryBaseDelay time.Duration
+	// DataSourceMaxResponseRows is the default maximum number of rows, across all frames, of a
+	// response of the legacy query path. Zero means no limit.
+	DataSourceMaxResponseRows int
+	// DataSourceQueryCacheTTL is the default time responses of the legacy query path are
+	// cached for. Zero disables the cache.
+	DataSourceQueryCacheTTL time.Duration
+	// DataSourceQueryCacheRelativeTime is true if responses to queries with a time range
+	// relative to now are cached too.
+	DataSourceQueryCacheRelativeTime bool
+	// DataSourceTypeAliases maps alternate data source types to the ID of the plugin that
+	// handles them in the legacy query path, in addition to the built-in aliases.
+	DataSourceTypeAliases map[string]string
 
 	// Snapshots
 	SnapshotEnabled       bool
@@ -1837,6 +1861,22 @@ func (cfg *Cfg) GetContentDeliveryURL(prefix string) string {
 func (cfg *Cfg) readDataSourcesSettings() {
 	datasources := cfg.Raw.Section("datasources")
 	cfg.DataSourceLimit = datasources.Key("datasource_limit").MustInt(5000)
+	cfg.DataSourceQueryRateLimit = datasources.Key("query_rate_limit").MustFloat64(0)
+	cfg.DataSourceQueryRateLimitBurst = datasources.Key("query_rate_limit_burst").MustInt(1)
+	cfg.DataSourceQueryRateLimitWait = datasources.Key("query_rate_limit_wait").MustBool(true)
+	cfg.DataSourceQueryRetryAttempts = datasources.Key("query_retry_attempts").MustInt(1)
+	cfg.DataSourceQueryRetryBaseDelay = datasources.Key("query_retry_base_delay").MustDuration(100 * time.Millisecond)
+	cfg.DataSourceMaxResponseRows = datasources.Key("max_response_rows").MustInt(0)
+	cfg.DataSourceQueryCacheTTL = datasources.Key("query_cache_ttl").MustDuration(0)
+	cfg.DataSourceQueryCacheRelativeTime = datasources.Key("query_cache_relative_time").MustBool(false)
+
+	cfg.DataSourceTypeAliases = make(map[string]string)
+	for _, aliasAndType := range util.SplitString(datasources.Key("type_aliases").String()) {
+		split := strings.SplitN(aliasAndType, ":", 2)
+		if len(split) == 2 {
+			cfg.DataSourceTypeAliases[split[0]] = split[1]
+		}
+	}
 }
 
 func GetAllowedOriginGlobs(originPatterns []string) ([]glob.Glob, error) {
@@ -40,6 +40,13 @@ type DataQuery struct {
 	User      *user.SignedInUser
 }
 
+// DataSourceQuery is a data request to a single data source, part of a request to mixed data sources.
+// New work should use the plugin SDK.
+type DataSourceQuery struct {
+	DataSource *datasources.DataSource
+	Query      DataQuery
+}
+
 type DataTable struct {
 	Columns []DataTableColumn `json:"columns"`
 	Rows    []DataRowValues   `json:"rows"`
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// defaultTypeAliases maps the new types of renamed core data sources to the ID of
+// the plugin that handles them.
+var defaultTypeAliases = map[string]string{
+	"grafana-postgresql-datasource": "postgres",
+	"grafana-testdata-datasource":   "testdata",
+	"grafana-pyroscope-datasource":  "phlare",
+}
+
+// newTypeAliases returns the default type aliases merged with the configured ones.
+func newTypeAliases(cfg *setting.Cfg) map[string]string {
+	aliases := make(map[string]string, len(defaultTypeAliases))
+	for alias, pluginID := range defaultTypeAliases {
+		aliases[alias] = pluginID
+	}
+	if cfg != nil {
+		for alias, pluginID := range cfg.DataSourceTypeAliases {
+			aliases[alias] = pluginID
+		}
+	}
+	return aliases
+}
+
+// pluginID returns the ID of the plugin that handles the queries of data sources of type dsType.
+func (h *Service) pluginID(dsType string) string {
+	if pluginID, ok := h.typeAliases[dsType]; ok {
+		return pluginID
+	}
+	return dsType
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/grafana/pkg/infra/localcache"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+// queryCache is an in-memory cache of the successful responses of data sources.
+type queryCache struct {
+	cache *localcache.CacheService
+
+	defaultTTL          time.Duration
+	defaultRelativeTime bool
+}
+
+func newQueryCache(cfg *setting.Cfg) *queryCache {
+	c := &queryCache{
+		cache: localcache.New(5*time.Minute, 10*time.Minute),
+	}
+	if cfg != nil {
+		c.defaultTTL = cfg.DataSourceQueryCacheTTL
+		c.defaultRelativeTime = cfg.DataSourceQueryCacheRelativeTime
+	}
+	return c
+}
+
+// ttl returns the time responses of ds are cached for. It is read from the queryCacheTTL
+// field of its JSON data, and falls back to the configured default.
+func (c *queryCache) ttl(ds *datasources.DataSource) time.Duration {
+	if ds.JsonData == nil {
+		return c.defaultTTL
+	}
+	if s := ds.JsonData.Get("queryCacheTTL").MustString(); s != "" {
+		if ttl, err := time.ParseDuration(s); err == nil {
+			return ttl
+		}
+	}
+	return c.defaultTTL
+}
+
+// key returns the cache key of query for ds, or false if the response of query must
+// not be cached.
+func (c *queryCache) key(ds *datasources.DataSource, query legacydata.DataQuery) (string, bool) {
+	if c.ttl(ds) <= 0 {
+		return "", false
+	}
+
+	var from, to string
+	if query.TimeRange != nil {
+		from, to = query.TimeRange.From, query.TimeRange.To
+	}
+	relativeTime := c.defaultRelativeTime
+	if ds.JsonData != nil {
+		relativeTime = ds.JsonData.Get("queryCacheRelativeTime").MustBool(relativeTime)
+	}
+	if !relativeTime && (strings.Contains(from, "now") || strings.Contains(to, "now")) {
+		return "", false
+	}
+
+	type subQuery struct {
+		RefID         string          `json:"refId"`
+		Model         json.RawMessage `json:"model"`
+		MaxDataPoints int64           `json:"maxDataPoints"`
+		IntervalMS    int64           `json:"intervalMs"`
+		QueryType     string          `json:"queryType"`
+	}
+	k := struct {
+		DataSourceID      int64             `json:"dataSourceId"`
+		DataSourceVersion int               `json:"dataSourceVersion"`
+		OrgID             int64             `json:"orgId"`
+		UserID            int64             `json:"userId"`
+		From              string            `json:"from"`
+		To                string            `json:"to"`
+		Headers           map[string]string `json:"headers"`
+		Queries           []subQuery        `json:"queries"`
+	}{
+		DataSourceID:      ds.ID,
+		DataSourceVersion: ds.Version,
+		From:              from,
+		To:                to,
+		Headers:           query.Headers,
+	}
+	// Responses can depend on the user, e.g. when the data source forwards their OAuth identity.
+	if query.User != nil {
+		k.OrgID, k.UserID = query.User.OrgID, query.User.UserID
+	}
+	for _, q := range query.Queries {
+		model, err := q.Model.MarshalJSON()
+		if err != nil {
+			return "", false
+		}
+		k.Queries = append(k.Queries, subQuery{
+			RefID:         q.RefID,
+			Model:         model,
+			MaxDataPoints: q.MaxDataPoints,
+			IntervalMS:    q.IntervalMS,
+			QueryType:     q.QueryType,
+		})
+	}
+
+	b, err := json.Marshal(k)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// cachedResponse is a cached legacydata.DataResponse. The data frames of its results are
+// stored Arrow encoded, and decoded on each hit, so that callers get their own frames and
+// can modify them without corrupting the cached ones. The responses of handleRequest only
+// have data frames, so the other fields of the results are not copied.
+type cachedResponse struct {
+	message string
+	results map[string]cachedResult
+}
+
+// cachedResult is a result of a cachedResponse, whose data frames are stored apart.
+//
+//nolint:staticcheck // legacydata.DataQueryResult deprecated
+type cachedResult struct {
+	result legacydata.DataQueryResult
+	// frames are the encoded data frames of result, nil if its frames are, and hasFrames
+	// is true if it has data frames at all.
+	frames    [][]byte
+	hasFrames bool
+}
+
+// get returns a copy of the response cached under key.
+//
+//nolint:staticcheck // legacydata.DataResponse deprecated
+func (c *queryCache) get(key string) (legacydata.DataResponse, bool) {
+	v, ok := c.cache.Get(key)
+	if !ok {
+		return legacydata.DataResponse{}, false
+	}
+	cached := v.(cachedResponse)
+	resp := legacydata.DataResponse{
+		Message: cached.message,
+		Results: make(map[string]legacydata.DataQueryResult, len(cached.results)),
+	}
+	for refID, r := range cached.results {
+		result := r.result
+		if r.hasFrames {
+			var frames data.Frames
+			if r.frames != nil {
+				var err error
+				if frames, err = data.UnmarshalArrowFrames(r.frames); err != nil {
+					return legacydata.DataResponse{}, false
+				}
+			}
+			result.Dataframes = legacydata.NewDecodedDataFrames(frames)
+		}
+		resp.Results[refID] = result
+	}
+	return resp, true
+}
+
+// set caches resp for the TTL of ds, unless one of its results failed.
+//
+//nolint:staticcheck // legacydata.DataResponse deprecated
+func (c *queryCache) set(ds *datasources.DataSource, key string, resp legacydata.DataResponse) {
+	cached := cachedResponse{
+		message: resp.Message,
+		results: make(map[string]cachedResult, len(resp.Results)),
+	}
+	for refID, r := range resp.Results {
+		if r.Error != nil {
+			return
+		}
+		entry := cachedResult{result: r}
+		if r.Dataframes != nil {
+			// The frames are encoded from the decoded ones rather than with Encoded, which
+			// would keep the encoded frames in resp, stale once the caller modifies them.
+			frames, err := r.Dataframes.Decoded()
+			if err != nil {
+				return
+			}
+			if frames != nil {
+				if entry.frames, err = frames.MarshalArrow(); err != nil {
+					return
+				}
+			}
+			entry.result.Dataframes = nil
+			entry.hasFrames = true
+		}
+		cached.results[refID] = entry
+	}
+	c.cache.Set(key, cached, c.ttl(ds))
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/tracing"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+func TestHandleRequest_Cache(t *testing.T) {
+	dsService := setupDataSourceService(t)
+
+	// countingClient returns the client and the number of queries it received.
+	countingClient := func() (*fakePluginsClient, *int) {
+		calls := 0
+		client := &fakePluginsClient{}
+		client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			calls++
+			resp := backend.NewQueryDataResponse()
+			resp.Responses["A"] = backend.DataResponse{}
+			return resp, nil
+		}
+		return client, &calls
+	}
+	query := func(ds *datasources.DataSource, from, to, expr string) legacydata.DataQuery {
+		return legacydata.DataQuery{
+			TimeRange: &legacydata.DataTimeRange{From: from, To: to},
+			Queries: []legacydata.DataSubQuery{
+				{RefID: "A", DataSource: ds, Model: simplejson.NewFromAny(map[string]interface{}{"expr": expr})},
+			},
+		}
+	}
+	newService := func(client *fakePluginsClient, cfg *setting.Cfg) *Service {
+		return ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), cfg)
+	}
+	ctx := context.Background()
+
+	t.Run("should return cached responses of identical queries", func(t *testing.T) {
+		client, calls := countingClient()
+		s := newService(client, &setting.Cfg{DataSourceQueryCacheTTL: time.Minute})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.New()}
+
+		res1, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+		require.NoError(t, err)
+		res2, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+		require.NoError(t, err)
+		require.Equal(t, 1, *calls)
+		require.Equal(t, res1, res2)
+	})
+
+	t.Run("should not share cached frames with callers", func(t *testing.T) {
+		calls := 0
+		client := &fakePluginsClient{}
+		client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			calls++
+			resp := backend.NewQueryDataResponse()
+			resp.Responses["A"] = backend.DataResponse{Frames: data.Frames{
+				data.NewFrame("frame", data.NewField("value", nil, []float64{1})),
+			}}
+			return resp, nil
+		}
+		s := newService(client, &setting.Cfg{DataSourceQueryCacheTTL: time.Minute})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.New()}
+
+		// Both the response that is cached and the ones returned on hits can be modified.
+		for i := 0; i < 2; i++ {
+			res, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+			require.NoError(t, err)
+			frames, err := res.Results["A"].Dataframes.Decoded()
+			require.NoError(t, err)
+			require.Len(t, frames, 1)
+			require.Equal(t, "frame", frames[0].Name)
+			frames[0].Name = "changed"
+			frames[0].Fields[0].Set(0, float64(2))
+		}
+
+		res, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+		require.NoError(t, err)
+		require.Equal(t, 1, calls)
+		frames, err := res.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		require.Equal(t, "frame", frames[0].Name)
+		require.Equal(t, float64(1), frames[0].Fields[0].At(0))
+	})
+
+	t.Run("should query the data source on a miss", func(t *testing.T) {
+		client, calls := countingClient()
+		s := newService(client, &setting.Cfg{DataSourceQueryCacheTTL: time.Minute})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.New()}
+
+		for _, q := range []legacydata.DataQuery{
+			query(ds, "1000", "2000", "up"),
+			query(ds, "1000", "3000", "up"),
+			query(ds, "1000", "2000", "down"),
+		} {
+			_, err := s.HandleRequest(ctx, ds, q)
+			require.NoError(t, err)
+		}
+		// Data sources don't share their cached responses.
+		other := &datasources.DataSource{ID: 2, JsonData: simplejson.New()}
+		_, err := s.HandleRequest(ctx, other, query(other, "1000", "2000", "up"))
+		require.NoError(t, err)
+		require.Equal(t, 4, *calls)
+	})
+
+	t.Run("should query the data source once the TTL expired", func(t *testing.T) {
+		client, calls := countingClient()
+		s := newService(client, &setting.Cfg{})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.NewFromAny(map[string]interface{}{
+			"queryCacheTTL": "20ms",
+		})}
+
+		_, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+		require.NoError(t, err)
+		_, err = s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+		require.NoError(t, err)
+		require.Equal(t, 1, *calls)
+
+		time.Sleep(40 * time.Millisecond)
+		_, err = s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+		require.NoError(t, err)
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("should not cache queries relative to now unless allowed", func(t *testing.T) {
+		client, calls := countingClient()
+		s := newService(client, &setting.Cfg{DataSourceQueryCacheTTL: time.Minute})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.New()}
+
+		for i := 0; i < 2; i++ {
+			_, err := s.HandleRequest(ctx, ds, query(ds, "now-1h", "now", "up"))
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, *calls)
+
+		ds.JsonData.Set("queryCacheRelativeTime", true)
+		for i := 0; i < 2; i++ {
+			_, err := s.HandleRequest(ctx, ds, query(ds, "now-1h", "now", "up"))
+			require.NoError(t, err)
+		}
+		require.Equal(t, 3, *calls)
+	})
+
+	t.Run("should not cache failed responses", func(t *testing.T) {
+		calls := 0
+		client := &fakePluginsClient{}
+		client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			calls++
+			resp := backend.NewQueryDataResponse()
+			resp.Responses["A"] = backend.DataResponse{Error: context.DeadlineExceeded}
+			return resp, nil
+		}
+		s := newService(client, &setting.Cfg{DataSourceQueryCacheTTL: time.Minute})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.New()}
+
+		for i := 0; i < 2; i++ {
+			_, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("should not cache by default", func(t *testing.T) {
+		client, calls := countingClient()
+		s := newService(client, nil)
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.New()}
+
+		for i := 0; i < 2; i++ {
+			_, err := s.HandleRequest(ctx, ds, query(ds, "1000", "2000", "up"))
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, *calls)
+	})
+}
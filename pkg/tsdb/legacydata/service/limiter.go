@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ErrRateLimited is returned when a query exceeds the rate limit of its data source
+// and queries are configured not to wait.
+var ErrRateLimited = errors.New("data source query rate limit exceeded")
+
+// rateLimiters holds a token bucket per data source ID, so each data source is
+// limited independently.
+type rateLimiters struct {
+	mu       sync.Mutex
+	limiters map[int64]*rate.Limiter
+
+	defaultLimit float64
+	defaultBurst int
+	wait         bool
+}
+
+func newRateLimiters(cfg *setting.Cfg) *rateLimiters {
+	r := &rateLimiters{
+		limiters:     make(map[int64]*rate.Limiter),
+		defaultBurst: 1,
+		wait:         true,
+	}
+	if cfg != nil {
+		r.defaultLimit = cfg.DataSourceQueryRateLimit
+		r.defaultBurst = cfg.DataSourceQueryRateLimitBurst
+		r.wait = cfg.DataSourceQueryRateLimitWait
+	}
+	return r
+}
+
+// limits returns the rate limit and burst of ds. They are read from the queryRateLimit and
+// queryRateLimitBurst fields of its JSON data, and fall back to the configured defaults.
+func (r *rateLimiters) limits(ds *datasources.DataSource) (float64, int) {
+	limit, burst := r.defaultLimit, r.defaultBurst
+	if ds.JsonData != nil {
+		limit = ds.JsonData.Get("queryRateLimit").MustFloat64(limit)
+		burst = ds.JsonData.Get("queryRateLimitBurst").MustInt(burst)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return limit, burst
+}
+
+// limiter returns the limiter of ds, or nil if ds is not rate limited.
+func (r *rateLimiters) limiter(ds *datasources.DataSource) *rate.Limiter {
+	limit, burst := r.limits(ds)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if limit <= 0 {
+		delete(r.limiters, ds.ID)
+		return nil
+	}
+
+	l, ok := r.limiters[ds.ID]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(limit), burst)
+		r.limiters[ds.ID] = l
+		return l
+	}
+	// The limits of the data source may have been updated since the limiter was created.
+	if l.Limit() != rate.Limit(limit) {
+		l.SetLimit(rate.Limit(limit))
+	}
+	if l.Burst() != burst {
+		l.SetBurst(burst)
+	}
+	return l
+}
+
+// acquire takes a token from the bucket of ds. Depending on the configuration, it either
+// waits until a token is available or ctx is done, or fails with ErrRateLimited.
+func (r *rateLimiters) acquire(ctx context.Context, ds *datasources.DataSource) error {
+	l := r.limiter(ds)
+	if l == nil {
+		return nil
+	}
+	if !r.wait {
+		if !l.Allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	if err := l.Wait(ctx); err != nil {
+		return fmt.Errorf("%w: %s", ErrRateLimited, err)
+	}
+	return nil
+}
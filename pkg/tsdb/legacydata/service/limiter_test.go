@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestRateLimiters(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should not limit when no rate limit is configured", func(t *testing.T) {
+		r := newRateLimiters(&setting.Cfg{})
+		ds := &datasources.DataSource{ID: 1}
+		for i := 0; i < 10; i++ {
+			require.NoError(t, r.acquire(ctx, ds))
+		}
+	})
+
+	t.Run("should fail over the rate limit when not waiting", func(t *testing.T) {
+		r := newRateLimiters(&setting.Cfg{
+			DataSourceQueryRateLimit:      0.01,
+			DataSourceQueryRateLimitBurst: 2,
+		})
+		ds := &datasources.DataSource{ID: 1}
+		require.NoError(t, r.acquire(ctx, ds))
+		require.NoError(t, r.acquire(ctx, ds))
+		require.ErrorIs(t, r.acquire(ctx, ds), ErrRateLimited)
+
+		// Each data source has its own bucket.
+		require.NoError(t, r.acquire(ctx, &datasources.DataSource{ID: 2}))
+	})
+
+	t.Run("should wait for a token over the rate limit", func(t *testing.T) {
+		r := newRateLimiters(&setting.Cfg{
+			DataSourceQueryRateLimit:      20,
+			DataSourceQueryRateLimitBurst: 1,
+			DataSourceQueryRateLimitWait:  true,
+		})
+		ds := &datasources.DataSource{ID: 1}
+		require.NoError(t, r.acquire(ctx, ds))
+
+		start := time.Now()
+		require.NoError(t, r.acquire(ctx, ds))
+		require.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+	})
+
+	t.Run("should fail when the context ends before a token is available", func(t *testing.T) {
+		r := newRateLimiters(&setting.Cfg{
+			DataSourceQueryRateLimit:      0.01,
+			DataSourceQueryRateLimitBurst: 1,
+			DataSourceQueryRateLimitWait:  true,
+		})
+		ds := &datasources.DataSource{ID: 1}
+		require.NoError(t, r.acquire(ctx, ds))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, r.acquire(timeoutCtx, ds), ErrRateLimited)
+	})
+
+	t.Run("should use the limits of the data source JSON data", func(t *testing.T) {
+		r := newRateLimiters(&setting.Cfg{})
+		ds := &datasources.DataSource{ID: 1, JsonData: simplejson.NewFromAny(map[string]interface{}{
+			"queryRateLimit":      0.01,
+			"queryRateLimitBurst": 1,
+		})}
+		r.wait = false
+		require.NoError(t, r.acquire(ctx, ds))
+		require.ErrorIs(t, r.acquire(ctx, ds), ErrRateLimited)
+
+		// Removing the limit from the data source removes its limiter.
+		ds.JsonData = simplejson.New()
+		require.NoError(t, r.acquire(ctx, ds))
+		require.NoError(t, r.acquire(ctx, ds))
+	})
+}
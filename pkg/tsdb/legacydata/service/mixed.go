@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+// maxMixedRequestConcurrency is the maximum number of data sources HandleMixedRequest queries at once.
+const maxMixedRequestConcurrency = 8
+
+// HandleMixedRequest handles the queries of a request to mixed data sources, querying each
+// data source concurrently, and returns the results of all the queries keyed by refID.
+// Errors of single queries are returned in their results, like HandleRequest does. If the
+// request to a data source fails, the requests still running are canceled and its error
+// is returned.
+//
+//nolint:staticcheck // legacydata.DataResponse deprecated
+func (h *Service) HandleMixedRequest(ctx context.Context, queries []legacydata.DataSourceQuery) (resp legacydata.DataResponse, err error) {
+	ctx, span := h.tracer.Start(ctx, "legacydata.HandleMixedRequest")
+	span.SetAttributes("datasources", len(queries), attribute.Key("datasources").Int(len(queries)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	refIDs := make(map[string]bool)
+	for _, q := range queries {
+		for _, sq := range q.Query.Queries {
+			if refIDs[sq.RefID] {
+				return legacydata.DataResponse{}, fmt.Errorf("duplicate query refID %q in mixed request", sq.RefID)
+			}
+			refIDs[sq.RefID] = true
+		}
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(maxMixedRequestConcurrency)
+	responses := make([]legacydata.DataResponse, len(queries))
+	for i, q := range queries {
+		i, q := i, q
+		g.Go(func() error {
+			resp, err := h.HandleRequest(gCtx, q.DataSource, q.Query)
+			if err != nil {
+				return fmt.Errorf("failed to query data source %q: %w", q.DataSource.UID, err)
+			}
+			responses[i] = resp
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return legacydata.DataResponse{}, err
+	}
+
+	resp = legacydata.DataResponse{
+		Results: make(map[string]legacydata.DataQueryResult, len(refIDs)),
+	}
+	for _, r := range responses {
+		for refID, qr := range r.Results {
+			resp.Results[refID] = qr
+		}
+	}
+	return resp, nil
+}
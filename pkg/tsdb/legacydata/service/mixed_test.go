@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/tracing"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+func TestHandleMixedRequest(t *testing.T) {
+	prometheus := &datasources.DataSource{ID: 1, UID: "prom", Type: "prometheus", JsonData: simplejson.New()}
+	loki := &datasources.DataSource{ID: 2, UID: "loki", Type: "loki", JsonData: simplejson.New()}
+	query := func(ds *datasources.DataSource, refIDs ...string) legacydata.DataSourceQuery {
+		q := legacydata.DataSourceQuery{DataSource: ds, Query: legacydata.DataQuery{TimeRange: &legacydata.DataTimeRange{}}}
+		for _, refID := range refIDs {
+			q.Query.Queries = append(q.Query.Queries, legacydata.DataSubQuery{RefID: refID, DataSource: ds, Model: simplejson.New()})
+		}
+		return q
+	}
+
+	// The fake plugins answer each query with a frame named after their plugin ID, except
+	// for queries with refID "ERR", which fail, and the plugin "failing", which fails.
+	client := &fakePluginsClient{}
+	client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		if req.PluginContext.PluginID == "failing" {
+			return nil, errors.New("plugin crashed")
+		}
+		resp := backend.NewQueryDataResponse()
+		for _, q := range req.Queries {
+			if q.RefID == "ERR" {
+				resp.Responses[q.RefID] = backend.DataResponse{Error: errors.New("bad query")}
+				continue
+			}
+			resp.Responses[q.RefID] = backend.DataResponse{Frames: data.Frames{data.NewFrame(req.PluginContext.PluginID)}}
+		}
+		return resp, nil
+	}
+	s := ProvideService(client, nil, setupDataSourceService(t), tracing.InitializeTracerForTest(), nil)
+
+	t.Run("should query each data source with its plugin", func(t *testing.T) {
+		res, err := s.HandleMixedRequest(context.Background(), []legacydata.DataSourceQuery{
+			query(prometheus, "A", "B"),
+			query(loki, "C"),
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Results, 3)
+
+		for refID, pluginID := range map[string]string{"A": "prometheus", "B": "prometheus", "C": "loki"} {
+			frames, err := res.Results[refID].Dataframes.Decoded()
+			require.NoError(t, err)
+			require.Len(t, frames, 1)
+			require.Equal(t, pluginID, frames[0].Name, refID)
+		}
+	})
+
+	t.Run("should return the errors of single queries in their results", func(t *testing.T) {
+		res, err := s.HandleMixedRequest(context.Background(), []legacydata.DataSourceQuery{
+			query(prometheus, "A"),
+			query(loki, "ERR"),
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Results, 2)
+		require.NoError(t, res.Results["A"].Error)
+		require.EqualError(t, res.Results["ERR"].Error, "bad query")
+	})
+
+	t.Run("should fail if a data source request fails", func(t *testing.T) {
+		failing := &datasources.DataSource{ID: 3, UID: "failing", Type: "failing", JsonData: simplejson.New()}
+		_, err := s.HandleMixedRequest(context.Background(), []legacydata.DataSourceQuery{
+			query(prometheus, "A"),
+			query(failing, "B"),
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "plugin crashed")
+		require.Contains(t, err.Error(), `"failing"`)
+	})
+
+	t.Run("should fail on duplicate refIDs", func(t *testing.T) {
+		_, err := s.HandleMixedRequest(context.Background(), []legacydata.DataSourceQuery{
+			query(prometheus, "A"),
+			query(loki, "A"),
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "duplicate query refID")
+	})
+}
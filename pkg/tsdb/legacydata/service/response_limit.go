@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ErrResponseTooLarge is returned when the response of a data source has more
+// rows than its limit.
+type ErrResponseTooLarge struct {
+	DataSourceUID string
+	Rows          int
+	Limit         int
+}
+
+func (e ErrResponseTooLarge) Error() string {
+	return fmt.Sprintf("response of data source %q has %d rows, which is more than the limit of %d", e.DataSourceUID, e.Rows, e.Limit)
+}
+
+// responseLimit holds the default maximum number of rows of a response.
+type responseLimit struct {
+	defaultMaxRows int
+}
+
+func newResponseLimit(cfg *setting.Cfg) responseLimit {
+	if cfg == nil {
+		return responseLimit{}
+	}
+	return responseLimit{defaultMaxRows: cfg.DataSourceMaxResponseRows}
+}
+
+// maxRows returns the maximum number of rows of a response of ds. It is read from the
+// maxResponseRows field of its JSON data, and falls back to the configured default.
+func (l responseLimit) maxRows(ds *datasources.DataSource) int {
+	if ds.JsonData != nil {
+		return ds.JsonData.Get("maxResponseRows").MustInt(l.defaultMaxRows)
+	}
+	return l.defaultMaxRows
+}
+
+// check returns ErrResponseTooLarge if the total number of rows of the frames of resp
+// is over the limit of ds. The size of a response can't be known before the query is
+// executed, so it is checked once the response is received.
+func (l responseLimit) check(ds *datasources.DataSource, resp *backend.QueryDataResponse) error {
+	limit := l.maxRows(ds)
+	if limit <= 0 || resp == nil {
+		return nil
+	}
+	rows := 0
+	for _, r := range resp.Responses {
+		for _, f := range r.Frames {
+			rows += f.Rows()
+		}
+	}
+	if rows > limit {
+		return ErrResponseTooLarge{DataSourceUID: ds.UID, Rows: rows, Limit: limit}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/tracing"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+func TestHandleRequest_ResponseLimit(t *testing.T) {
+	// The response has 3 rows in A and 2 rows in B.
+	client := &fakePluginsClient{}
+	client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		resp := backend.NewQueryDataResponse()
+		resp.Responses["A"] = backend.DataResponse{Frames: data.Frames{
+			data.NewFrame("a1", data.NewField("value", nil, []float64{1, 2})),
+			data.NewFrame("a2", data.NewField("value", nil, []float64{3})),
+		}}
+		resp.Responses["B"] = backend.DataResponse{Frames: data.Frames{
+			data.NewFrame("b", data.NewField("value", nil, []float64{4, 5})),
+		}}
+		return resp, nil
+	}
+	dsService := setupDataSourceService(t)
+	query := func(ds *datasources.DataSource) legacydata.DataQuery {
+		return legacydata.DataQuery{
+			TimeRange: &legacydata.DataTimeRange{},
+			Queries: []legacydata.DataSubQuery{
+				{RefID: "A", DataSource: ds, Model: simplejson.New()},
+				{RefID: "B", DataSource: ds, Model: simplejson.New()},
+			},
+		}
+	}
+
+	t.Run("should return responses under the limit", func(t *testing.T) {
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), &setting.Cfg{DataSourceMaxResponseRows: 5})
+		ds := &datasources.DataSource{ID: 1, UID: "ds", JsonData: simplejson.New()}
+
+		res, err := s.HandleRequest(context.Background(), ds, query(ds))
+		require.NoError(t, err)
+		require.Len(t, res.Results, 2)
+	})
+
+	t.Run("should fail on responses over the limit", func(t *testing.T) {
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), &setting.Cfg{DataSourceMaxResponseRows: 4})
+		ds := &datasources.DataSource{ID: 1, UID: "ds", JsonData: simplejson.New()}
+
+		_, err := s.HandleRequest(context.Background(), ds, query(ds))
+		require.ErrorIs(t, err, ErrResponseTooLarge{DataSourceUID: "ds", Rows: 5, Limit: 4})
+	})
+
+	t.Run("should use the limit of the data source JSON data", func(t *testing.T) {
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), &setting.Cfg{DataSourceMaxResponseRows: 100})
+		ds := &datasources.DataSource{ID: 1, UID: "ds", JsonData: simplejson.NewFromAny(map[string]interface{}{
+			"maxResponseRows": 2,
+		})}
+
+		_, err := s.HandleRequest(context.Background(), ds, query(ds))
+		require.ErrorIs(t, err, ErrResponseTooLarge{DataSourceUID: "ds", Rows: 5, Limit: 2})
+
+		// A limit of zero disables the default limit for the data source.
+		s = ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), &setting.Cfg{DataSourceMaxResponseRows: 2})
+		ds.JsonData = simplejson.NewFromAny(map[string]interface{}{"maxResponseRows": 0})
+		_, err = s.HandleRequest(context.Background(), ds, query(ds))
+		require.NoError(t, err)
+	})
+}
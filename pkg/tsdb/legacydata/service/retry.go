@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util/errutil"
+)
+
+// RetryableError is implemented by errors that can tell whether the failed
+// query is worth retrying.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// retryPolicy controls how many times a query is sent to a data source when it
+// fails with a transient error, and how long to wait between attempts.
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+}
+
+func newRetryPolicy(cfg *setting.Cfg) retryPolicy {
+	p := retryPolicy{attempts: 1}
+	if cfg != nil {
+		p.attempts = cfg.DataSourceQueryRetryAttempts
+		p.baseDelay = cfg.DataSourceQueryRetryBaseDelay
+	}
+	if p.attempts < 1 {
+		p.attempts = 1
+	}
+	return p
+}
+
+// delay returns the jittered delay before the given retry, starting at 1. The
+// delay doubles on each retry and is picked at random in [d/2, d).
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := p.baseDelay << (retry - 1)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)))
+}
+
+// isRetryable returns true if err is a transient error: an error that reports
+// itself as retryable, a rate limited request, or an unavailable plugin.
+func isRetryable(err error) bool {
+	var retryableErr RetryableError
+	if errors.As(err, &retryableErr) {
+		return retryableErr.Retryable()
+	}
+	var gfErr errutil.Error
+	if errors.As(err, &gfErr) && gfErr.Reason.Status() == errutil.StatusTooManyRequests {
+		return true
+	}
+	return errors.Is(err, plugins.ErrPluginUnavailable)
+}
+
+// queryData sends req to the plugin of ds, retrying transient errors according
+// to the retry policy. Every attempt is subject to the rate limit of ds. It gives
+// up early when the context ends or its deadline is before the next attempt.
+func (h *Service) queryData(ctx context.Context, ds *datasources.DataSource, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	for attempt := 1; ; attempt++ {
+		if err := h.rateLimiters.acquire(ctx, ds); err != nil {
+			return nil, err
+		}
+
+		resp, err := h.pluginsClient.QueryData(ctx, req)
+		if err == nil || attempt >= h.retryPolicy.attempts || !isRetryable(err) {
+			return resp, err
+		}
+
+		delay := h.retryPolicy.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/tracing"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/datasources"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/tsdb/legacydata"
+)
+
+type retryableTestError struct {
+	retryable bool
+}
+
+func (e retryableTestError) Error() string {
+	return fmt.Sprintf("retryable: %t", e.retryable)
+}
+
+func (e retryableTestError) Retryable() bool {
+	return e.retryable
+}
+
+func TestHandleRequest_Retry(t *testing.T) {
+	ds := &datasources.DataSource{ID: 12, Type: "unregisteredType", JsonData: simplejson.New()}
+	req := legacydata.DataQuery{
+		TimeRange: &legacydata.DataTimeRange{},
+		Queries: []legacydata.DataSubQuery{
+			{RefID: "A", DataSource: ds, Model: simplejson.New()},
+		},
+	}
+	cfg := &setting.Cfg{
+		DataSourceQueryRetryAttempts:  3,
+		DataSourceQueryRetryBaseDelay: time.Millisecond,
+	}
+	dsService := setupDataSourceService(t)
+
+	// failingClient fails with err on the first failures attempts, then succeeds.
+	failingClient := func(failures int, err error) (*fakePluginsClient, *int) {
+		attempts := 0
+		client := &fakePluginsClient{}
+		client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			attempts++
+			if attempts <= failures {
+				return nil, err
+			}
+			return backend.NewQueryDataResponse(), nil
+		}
+		return client, &attempts
+	}
+
+	t.Run("should succeed after transient errors", func(t *testing.T) {
+		client, attempts := failingClient(2, retryableTestError{retryable: true})
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), cfg)
+
+		res, err := s.HandleRequest(context.Background(), ds, req)
+		require.NoError(t, err)
+		require.NotNil(t, res.Results)
+		require.Equal(t, 3, *attempts)
+	})
+
+	t.Run("should retry an unavailable plugin", func(t *testing.T) {
+		client, attempts := failingClient(1, plugins.ErrPluginUnavailable.Errorf("plugin restarting"))
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), cfg)
+
+		_, err := s.HandleRequest(context.Background(), ds, req)
+		require.NoError(t, err)
+		require.Equal(t, 2, *attempts)
+	})
+
+	t.Run("should return the last error when attempts are exhausted", func(t *testing.T) {
+		client, attempts := failingClient(5, retryableTestError{retryable: true})
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), cfg)
+
+		_, err := s.HandleRequest(context.Background(), ds, req)
+		require.ErrorIs(t, err, retryableTestError{retryable: true})
+		require.Equal(t, 3, *attempts)
+	})
+
+	t.Run("should not retry other errors", func(t *testing.T) {
+		for _, queryErr := range []error{errors.New("bad query"), retryableTestError{retryable: false}} {
+			client, attempts := failingClient(1, queryErr)
+			s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), cfg)
+
+			_, err := s.HandleRequest(context.Background(), ds, req)
+			require.ErrorIs(t, err, queryErr)
+			require.Equal(t, 1, *attempts)
+		}
+	})
+
+	t.Run("should not retry when the deadline is before the next attempt", func(t *testing.T) {
+		client, attempts := failingClient(2, retryableTestError{retryable: true})
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), &setting.Cfg{
+			DataSourceQueryRetryAttempts:  3,
+			DataSourceQueryRetryBaseDelay: time.Hour,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		_, err := s.HandleRequest(ctx, ds, req)
+		require.Error(t, err)
+		require.Equal(t, 1, *attempts)
+	})
+
+	t.Run("should not retry by default", func(t *testing.T) {
+		client, attempts := failingClient(1, retryableTestError{retryable: true})
+		s := ProvideService(client, nil, dsService, tracing.InitializeTracerForTest(), nil)
+
+		_, err := s.HandleRequest(context.Background(), ds, req)
+		require.Error(t, err)
+		require.Equal(t, 1, *attempts)
+	})
+}
@@ -5,11 +5,15 @@ import (
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 
+	"github.com/grafana/grafana/pkg/infra/tracing"
 	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/plugins/adapters"
 	"github.com/grafana/grafana/pkg/services/datasources"
 	"github.com/grafana/grafana/pkg/services/oauthtoken"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/tsdb/legacydata"
 )
 
@@ -17,19 +21,55 @@ type Service struct {
 	pluginsClient      plugins.Client
 	oAuthTokenService  oauthtoken.OAuthTokenService
 	dataSourcesService datasources.DataSourceService
+	tracer             tracing.Tracer
+	rateLimiters       *rateLimiters
+	retryPolicy        retryPolicy
+	responseLimit      responseLimit
+	queryCache         *queryCache
+	typeAliases        map[string]string
 }
 
 func ProvideService(pluginsClient plugins.Client, oAuthTokenService oauthtoken.OAuthTokenService,
-	dataSourcesService datasources.DataSourceService) *Service {
+	dataSourcesService datasources.DataSourceService, tracer tracing.Tracer, cfg *setting.Cfg) *Service {
 	return &Service{
 		pluginsClient:      pluginsClient,
 		oAuthTokenService:  oAuthTokenService,
 		dataSourcesService: dataSourcesService,
+		tracer:             tracer,
+		rateLimiters:       newRateLimiters(cfg),
+		retryPolicy:        newRetryPolicy(cfg),
+		responseLimit:      newResponseLimit(cfg),
+		queryCache:         newQueryCache(cfg),
+		typeAliases:        newTypeAliases(cfg),
 	}
 }
 
 //nolint:staticcheck // legacydata.DataResponse deprecated
-func (h *Service) HandleRequest(ctx context.Context, ds *datasources.DataSource, query legacydata.DataQuery) (legacydata.DataResponse, error) {
+func (h *Service) HandleRequest(ctx context.Context, ds *datasources.DataSource, query legacydata.DataQuery) (resp legacydata.DataResponse, err error) {
+	ctx, span := h.tracer.Start(ctx, "legacydata.HandleRequest")
+	span.SetAttributes("datasource_type", ds.Type, attribute.Key("datasource_type").String(ds.Type))
+	span.SetAttributes("datasource_id", ds.ID, attribute.Key("datasource_id").Int64(ds.ID))
+	span.SetAttributes("datasource_uid", ds.UID, attribute.Key("datasource_uid").String(ds.UID))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return h.handleRequest(ctx, ds, query)
+}
+
+//nolint:staticcheck // legacydata.DataResponse deprecated
+func (h *Service) handleRequest(ctx context.Context, ds *datasources.DataSource, query legacydata.DataQuery) (legacydata.DataResponse, error) {
+	cacheKey, cacheable := h.queryCache.key(ds, query)
+	if cacheable {
+		if resp, ok := h.queryCache.get(cacheKey); ok {
+			return resp, nil
+		}
+	}
+
 	decryptedJsonData, err := h.dataSourcesService.DecryptedValues(ctx, ds)
 	if err != nil {
 		return legacydata.DataResponse{}, err
@@ -39,12 +79,17 @@ func (h *Service) HandleRequest(ctx context.Context, ds *datasources.DataSource,
 	if err != nil {
 		return legacydata.DataResponse{}, err
 	}
+	req.PluginContext.PluginID = h.pluginID(ds.Type)
 
-	resp, err := h.pluginsClient.QueryData(ctx, req)
+	resp, err := h.queryData(ctx, ds, req)
 	if err != nil {
 		return legacydata.DataResponse{}, err
 	}
 
+	if err := h.responseLimit.check(ds, resp); err != nil {
+		return legacydata.DataResponse{}, err
+	}
+
 	tR := legacydata.DataResponse{
 		Results: make(map[string]legacydata.DataQueryResult, len(resp.Responses)),
 	}
@@ -69,6 +114,10 @@ func (h *Service) HandleRequest(ctx context.Context, ds *datasources.DataSource,
 		tR.Results[refID] = qr
 	}
 
+	if cacheable {
+		h.queryCache.set(ds, cacheKey, tR)
+	}
+
 	return tR, nil
 }
 
@@ -2,14 +2,19 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/infra/db"
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/tracing"
 	"github.com/grafana/grafana/pkg/plugins"
 	acmock "github.com/grafana/grafana/pkg/services/accesscontrol/mock"
 	"github.com/grafana/grafana/pkg/services/datasources"
@@ -19,6 +24,7 @@ import (
 	"github.com/grafana/grafana/pkg/services/secrets/fakes"
 	secretskvs "github.com/grafana/grafana/pkg/services/secrets/kvstore"
 	secretsmng "github.com/grafana/grafana/pkg/services/secrets/manager"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/tsdb/legacydata"
 )
 
@@ -30,15 +36,7 @@ func TestHandleRequest(t *testing.T) {
 			actualReq = req
 			return backend.NewQueryDataResponse(), nil
 		}
-		sqlStore := db.InitTestDB(t)
-		secretsService := secretsmng.SetupTestService(t, fakes.NewFakeSecretsStore())
-		secretsStore := secretskvs.NewSQLSecretsKVStore(sqlStore, secretsService, log.New("test.logger"))
-		datasourcePermissions := acmock.NewMockedPermissionsService()
-		quotaService := quotatest.New(false, nil)
-		dsService, err := datasourceservice.ProvideService(nil, secretsService, secretsStore, sqlStore.Cfg, featuremgmt.WithFeatures(), acmock.New(), datasourcePermissions, quotaService)
-		require.NoError(t, err)
-
-		s := ProvideService(client, nil, dsService)
+		s := ProvideService(client, nil, setupDataSourceService(t), tracing.InitializeTracerForTest(), nil)
 
 		ds := &datasources.DataSource{ID: 12, Type: "unregisteredType", JsonData: simplejson.New()}
 		req := legacydata.DataQuery{
@@ -53,6 +51,85 @@ func TestHandleRequest(t *testing.T) {
 		require.NotNil(t, actualReq)
 		require.NotNil(t, res)
 	})
+
+	t.Run("Should record a span for the request", func(t *testing.T) {
+		client := &fakePluginsClient{}
+		client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return nil, errors.New("plugin unavailable")
+		}
+		recorder := tracetest.NewSpanRecorder()
+		s := ProvideService(client, nil, setupDataSourceService(t), tracing.InitializeTracerForTestWithSpanRecorder(recorder), nil)
+
+		ds := &datasources.DataSource{ID: 12, UID: "ds-uid", Type: "graphite", JsonData: simplejson.New()}
+		req := legacydata.DataQuery{
+			TimeRange: &legacydata.DataTimeRange{},
+			Queries: []legacydata.DataSubQuery{
+				{RefID: "A", DataSource: ds, Model: simplejson.New()},
+			},
+		}
+		_, err := s.HandleRequest(context.Background(), ds, req)
+		require.Error(t, err)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+		span := spans[0]
+		require.Equal(t, "legacydata.HandleRequest", span.Name())
+		require.ElementsMatch(t, []attribute.KeyValue{
+			attribute.String("datasource_type", "graphite"),
+			attribute.Int64("datasource_id", 12),
+			attribute.String("datasource_uid", "ds-uid"),
+		}, span.Attributes())
+		require.Equal(t, codes.Error, span.Status().Code)
+		require.Equal(t, "plugin unavailable", span.Status().Description)
+	})
+}
+
+func TestHandleRequest_TypeAliases(t *testing.T) {
+	var actualReq *backend.QueryDataRequest
+	client := &fakePluginsClient{}
+	client.QueryDataHandlerFunc = func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		actualReq = req
+		return backend.NewQueryDataResponse(), nil
+	}
+	s := ProvideService(client, nil, setupDataSourceService(t), tracing.InitializeTracerForTest(), &setting.Cfg{
+		DataSourceTypeAliases: map[string]string{"acme-prometheus-datasource": "prometheus"},
+	})
+
+	tests := []struct {
+		dsType   string
+		pluginID string
+	}{
+		{dsType: "grafana-postgresql-datasource", pluginID: "postgres"},
+		{dsType: "acme-prometheus-datasource", pluginID: "prometheus"},
+		{dsType: "postgres", pluginID: "postgres"},
+		{dsType: "unregisteredType", pluginID: "unregisteredType"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsType, func(t *testing.T) {
+			ds := &datasources.DataSource{ID: 12, Type: tt.dsType, JsonData: simplejson.New()}
+			req := legacydata.DataQuery{
+				TimeRange: &legacydata.DataTimeRange{},
+				Queries: []legacydata.DataSubQuery{
+					{RefID: "A", DataSource: ds, Model: simplejson.New()},
+				},
+			}
+			_, err := s.HandleRequest(context.Background(), ds, req)
+			require.NoError(t, err)
+			require.Equal(t, tt.pluginID, actualReq.PluginContext.PluginID)
+		})
+	}
+}
+
+func setupDataSourceService(t *testing.T) datasources.DataSourceService {
+	t.Helper()
+	sqlStore := db.InitTestDB(t)
+	secretsService := secretsmng.SetupTestService(t, fakes.NewFakeSecretsStore())
+	secretsStore := secretskvs.NewSQLSecretsKVStore(sqlStore, secretsService, log.New("test.logger"))
+	datasourcePermissions := acmock.NewMockedPermissionsService()
+	quotaService := quotatest.New(false, nil)
+	dsService, err := datasourceservice.ProvideService(nil, secretsService, secretsStore, sqlStore.Cfg, featuremgmt.WithFeatures(), acmock.New(), datasourcePermissions, quotaService)
+	require.NoError(t, err)
+	return dsService
 }
 
 type fakePluginsClient struct {